@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -11,7 +12,7 @@ import (
 
 func main() {
 	// Initialize the LSM engine with 1KB MemTable limit for easy testing of flushes
-	db, err := engine.New("./stress_storage", 1024)
+	db, err := engine.New("./stress_storage", &engine.Options{MaxMemSize: 1024})
 	if err != nil {
 		fmt.Printf("Failed to initialize DB: %v\n", err)
 		return
@@ -19,7 +20,7 @@ func main() {
 	defer db.Close()
 
 	fmt.Println("LSM-Tree initialized.")
-	fmt.Println("Commands: SET <key> <val> | GET <key> | COMPACT | EXIT")
+	fmt.Println("Commands: SET <key> <val> | GET <key> | COMPACT [<start> <end>] | STATS [property] | EXIT")
 
 	scanner := bufio.NewScanner(os.Stdin)
 	for {
@@ -77,20 +78,41 @@ func main() {
 			}
 
 		case "COMPACT":
+			if len(parts) != 1 && len(parts) != 3 {
+				fmt.Println("Usage: COMPACT [<start> <end>]")
+				continue
+			}
 			fmt.Println("Starting compaction...")
-			err := db.Compact()
+			var err error
+			if len(parts) == 3 {
+				err = db.CompactRange(context.Background(), []byte(parts[1]), []byte(parts[2]), nil)
+			} else {
+				err = db.Compact()
+			}
 			if err != nil {
 				fmt.Printf("Compaction error: %v\n", err)
 			} else {
 				fmt.Println("Compaction complete.")
 			}
 
+		case "STATS":
+			if len(parts) < 2 {
+				fmt.Print(db.Stats())
+				continue
+			}
+			val, ok := db.GetProperty(parts[1])
+			if !ok {
+				fmt.Printf("Unknown property %q\n", parts[1])
+			} else {
+				fmt.Println(val)
+			}
+
 		case "EXIT":
 			fmt.Println("Shutting down...")
 			return
 
 		default:
-			fmt.Println("Unknown command. Try SET, GET, COMPACT, or EXIT.")
+			fmt.Println("Unknown command. Try SET, GET, COMPACT, STATS, or EXIT.")
 		}
 	}
 }
@@ -6,36 +6,72 @@ import (
 	"os"
 	"strings"
 
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/blob"
 	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/sstable"
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
 )
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Println("Usage: go run ./cmd/lsm-dump <path-to-sstable>")
+		fmt.Println("Usage: go run ./cmd/lsm-dump <path-to-sstable-or-blob-file>")
 		return
 	}
 
 	path := os.Args[1]
-	reader, err := sstable.Open(path)
+	if _, ok := blob.ParseFileName(path); ok {
+		dumpBlobFile(path)
+		return
+	}
+	// A nil comparator accepts tables written with any comparator; we only scan
+	reader, err := sstable.OpenWithComparator(path, nil)
 	if err != nil {
 		log.Fatalf("Failed to open SSTable: %v", err)
 	}
 	defer reader.Close()
 
-	fmt.Printf("--- Dumping SSTable: %s ---\n", path)
+	fmt.Printf("--- Dumping SSTable: %s (comparator: %s) ---\n", path, reader.ComparatorName())
 	fmt.Printf("%-20s | %-20s\n", "KEY", "VALUE")
 	fmt.Println(strings.Repeat("-", 45))
 
-	// We use the GetIndex method we exported in Phase 6 to iterate
-	for _, entry := range reader.GetIndex() {
-		val, found, err := reader.Get(entry.Key)
-		if err != nil {
-			fmt.Printf("Error reading key %s: %v\n", string(entry.Key), err)
-			continue
-		}
-		if found {
-			fmt.Printf("%-20s | %-20s\n", string(entry.Key), string(val))
+	// Scan walks the entries in file order, which is the comparator's order
+	err = reader.Scan(func(key []byte, e sstable.Entry) error {
+		switch e.Type {
+		case sstable.TypeTombstone:
+		case sstable.TypeBlobIndex:
+			// The value lives in a blob file next to the table
+			ref, err := blob.DecodeRef(e.Value)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%-20s | <%s at %d, %d bytes>\n", string(key), blob.FileName(ref.File), ref.Offset, ref.Size)
+		default:
+			fmt.Printf("%-20s | %-20s\n", string(key), string(e.Value))
 		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Error reading SSTable: %v\n", err)
+	}
+	fmt.Println("--- End of Dump ---")
+}
+
+// dumpBlobFile prints the records of a blob file, in the order they were written.
+func dumpBlobFile(path string) {
+	reader, err := blob.Open(vfs.Default, path)
+	if err != nil {
+		log.Fatalf("Failed to open blob file: %v", err)
+	}
+	defer reader.Close()
+
+	fmt.Printf("--- Dumping blob file: %s ---\n", path)
+	fmt.Printf("%-10s | %-20s | %s\n", "OFFSET", "KEY", "VALUE SIZE")
+	fmt.Println(strings.Repeat("-", 50))
+	err = reader.Scan(func(ref blob.Ref, key, value []byte) error {
+		fmt.Printf("%-10d | %-20s | %d\n", ref.Offset, string(key), len(value))
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Error reading blob file: %v\n", err)
 	}
 	fmt.Println("--- End of Dump ---")
 }
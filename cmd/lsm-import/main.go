@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine"
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/dump"
+)
+
+const usage = `Usage:
+  go run ./cmd/lsm-import [flags] <db-dir> [file]
+
+Imports the output of lsm-export, read from file or stdin, into the database,
+creating it and any missing column families. The jsonl and csv formats take
+the columns cf, key, value and expires_at (unix nanoseconds, 0 for none);
+gzipped input is recognised in every format.
+
+Flags:`
+
+// jsonEntry is a line of the jsonl format.
+type jsonEntry struct {
+	CF        string `json:"cf"`
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+func main() {
+	format := flag.String("format", "native", "input format: native, jsonl or csv")
+	b64 := flag.Bool("base64", false, "keys and values in jsonl and csv are base64-encoded")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 && flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var in io.Reader = os.Stdin
+	if flag.NArg() == 2 {
+		f, err := os.Open(flag.Arg(1))
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", flag.Arg(1), err)
+		}
+		defer f.Close()
+		in = f
+	}
+	in = bufio.NewReader(in)
+
+	db, err := engine.New(flag.Arg(0), nil)
+	if err != nil {
+		log.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	switch *format {
+	case "native":
+	case "jsonl", "csv":
+		// Convert to the native format on the fly
+		if in, err = gunzip(in.(*bufio.Reader)); err != nil {
+			log.Fatalf("Failed to read input: %v", err)
+		}
+		pr, pw := io.Pipe()
+		go func(in io.Reader) { pw.CloseWithError(convertText(in, pw, *format, *b64)) }(in)
+		defer pr.Close()
+		in = pr
+	default:
+		log.Fatalf("Unknown format %q", *format)
+	}
+	if err := db.Import(in); err != nil {
+		log.Fatalf("Import failed: %v", err)
+	}
+	fmt.Printf("Imported into %s\n", flag.Arg(0))
+}
+
+// gunzip decompresses br if it holds gzip data.
+func gunzip(br *bufio.Reader) (io.Reader, error) {
+	if peek, err := br.Peek(2); err == nil && peek[0] == 0x1f && peek[1] == 0x8b {
+		return gzip.NewReader(br)
+	}
+	return br, nil
+}
+
+// convertText writes the jsonl or csv entries of in to w as a native dump.
+// Comparators are left out, so the families keep the ones they have.
+func convertText(in io.Reader, w io.Writer, format string, b64 bool) error {
+	dw, err := dump.NewWriter(w, dump.WriterOptions{})
+	if err != nil {
+		return err
+	}
+	decode := func(s string) ([]byte, error) { return []byte(s), nil }
+	if b64 {
+		decode = base64.StdEncoding.DecodeString
+	}
+
+	var next func() (jsonEntry, error)
+	if format == "jsonl" {
+		dec := json.NewDecoder(in)
+		next = func() (e jsonEntry, err error) {
+			err = dec.Decode(&e)
+			return e, err
+		}
+	} else {
+		cr := csv.NewReader(in)
+		cr.FieldsPerRecord = 4
+		if _, err := cr.Read(); err != nil {
+			return fmt.Errorf("no csv header: %w", err)
+		}
+		next = func() (jsonEntry, error) {
+			row, err := cr.Read()
+			if err != nil {
+				return jsonEntry{}, err
+			}
+			expiresAt, err := strconv.ParseInt(row[3], 10, 64)
+			if err != nil {
+				return jsonEntry{}, fmt.Errorf("bad expires_at %q", row[3])
+			}
+			return jsonEntry{CF: row[0], Key: row[1], Value: row[2], ExpiresAt: expiresAt}, nil
+		}
+	}
+
+	cf, started := "", false
+	for {
+		e, err := next()
+		if err == io.EOF {
+			return dw.Close()
+		}
+		if err != nil {
+			return err
+		}
+		if !started || e.CF != cf {
+			if err := dw.StartFamily(dump.Family{Name: e.CF}); err != nil {
+				return err
+			}
+			cf, started = e.CF, true
+		}
+		key, err := decode(e.Key)
+		if err != nil {
+			return fmt.Errorf("bad key %q: %w", e.Key, err)
+		}
+		value, err := decode(e.Value)
+		if err != nil {
+			return fmt.Errorf("bad value of %q: %w", e.Key, err)
+		}
+		if err := dw.Add(dump.Entry{Key: key, Value: value, ExpiresAt: e.ExpiresAt}); err != nil {
+			return err
+		}
+	}
+}
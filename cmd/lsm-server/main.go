@@ -2,16 +2,26 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"flag"
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine"
 )
 
+// knownCommands are the commands the server answers; metrics label every other one UNKNOWN.
+var knownCommands = map[string]bool{"SET": true, "GET": true, "MGET": true, "COMPACT": true, "SIZE": true, "SPLIT": true, "QUIT": true}
+
 func main() {
+	metricsAddr := flag.String("metrics", "", "address to serve /metrics, /healthz and /readyz on, e.g. :9090 (disabled if empty)")
+	flag.Parse()
+
 	// 1. Initialize the Engine
-	db, err := engine.New("./stress_storage", 1024*1024)
+	db, err := engine.New("./stress_storage", &engine.Options{MaxMemSize: 1024 * 1024})
 	if err != nil {
 		fmt.Printf("Failed to start engine: %v\n", err)
 		return
@@ -28,6 +38,17 @@ func main() {
 
 	fmt.Println("LSM-Server listening on :6379")
 
+	// 3. Optionally expose metrics and health checks over HTTP
+	m := newMetrics()
+	if *metricsAddr != "" {
+		go func() {
+			if err := serveMetrics(*metricsAddr, m, db); err != nil {
+				fmt.Printf("Metrics listener failed: %v\n", err)
+			}
+		}()
+		fmt.Printf("Metrics on http://%s/metrics\n", *metricsAddr)
+	}
+
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
@@ -35,11 +56,12 @@ func main() {
 			continue
 		}
 		// Handle each client in a separate goroutine for high performance
-		go handleConnection(conn, db)
+		go handleConnection(conn, db, m)
 	}
 }
 
-func handleConnection(conn net.Conn, db *engine.LSM) {
+func handleConnection(conn net.Conn, db *engine.LSM, m *metrics) {
+	defer m.connectionOpened()()
 	defer conn.Close()
 	scanner := bufio.NewScanner(conn)
 
@@ -51,6 +73,7 @@ func handleConnection(conn net.Conn, db *engine.LSM) {
 		}
 
 		command := strings.ToUpper(parts[0])
+		start := time.Now()
 		var response string
 
 		switch command {
@@ -69,19 +92,93 @@ func handleConnection(conn net.Conn, db *engine.LSM) {
 			if len(parts) < 2 {
 				response = "ERR usage: GET <key>\n"
 			} else {
-				val, found, _ := db.Get([]byte(parts[1]))
-				if !found {
+				val, found, err := db.Get([]byte(parts[1]))
+				if err != nil {
+					response = fmt.Sprintf("ERR %v\n", err)
+				} else if !found {
 					response = "(nil)\n"
 				} else {
 					response = fmt.Sprintf("\"%s\"\n", string(val))
 				}
 			}
+		case "MGET":
+			if len(parts) < 2 {
+				response = "ERR usage: MGET <key> [<key>...]\n"
+				break
+			}
+			keys := make([][]byte, len(parts)-1)
+			for i, p := range parts[1:] {
+				keys[i] = []byte(p)
+			}
+			results, err := db.MultiGet(keys, nil)
+			vals := make([]string, len(results))
+			for i, r := range results {
+				if r.Err != nil && err == nil {
+					err = r.Err
+				}
+				if r.Found {
+					vals[i] = fmt.Sprintf("\"%s\"", string(r.Value))
+				} else {
+					vals[i] = "(nil)"
+				}
+			}
+			if err != nil {
+				response = fmt.Sprintf("ERR %v\n", err)
+			} else {
+				response = strings.Join(vals, " ") + "\n"
+			}
+		case "COMPACT":
+			if len(parts) != 3 {
+				response = "ERR usage: COMPACT <start> <end>\n"
+			} else if err := db.CompactRange(context.Background(), []byte(parts[1]), []byte(parts[2]), nil); err != nil {
+				response = fmt.Sprintf("ERR %v\n", err)
+			} else {
+				response = "OK\n"
+			}
+		case "SIZE":
+			if len(parts) != 3 {
+				response = "ERR usage: SIZE <start> <end>\n"
+				break
+			}
+			r := engine.Range{Start: []byte(parts[1]), End: []byte(parts[2])}
+			sizes, err := db.GetApproximateSizes([]engine.Range{r})
+			if err != nil {
+				response = fmt.Sprintf("ERR %v\n", err)
+				break
+			}
+			keys, err := db.EstimateNumKeys(r)
+			if err != nil {
+				response = fmt.Sprintf("ERR %v\n", err)
+			} else {
+				response = fmt.Sprintf("%d %d\n", sizes[0], keys)
+			}
+		case "SPLIT":
+			n := 0
+			if len(parts) == 2 {
+				n, _ = strconv.Atoi(parts[1])
+			}
+			if n < 1 {
+				response = "ERR usage: SPLIT <n>\n"
+				break
+			}
+			points, err := db.SplitPoints(n)
+			if err != nil {
+				response = fmt.Sprintf("ERR %v\n", err)
+				break
+			}
+			keys := make([]string, len(points))
+			for i, p := range points {
+				keys[i] = string(p)
+			}
+			response = strings.Join(keys, " ") + "\n"
 		case "QUIT":
+			m.observe(command, time.Since(start), false)
 			conn.Write([]byte("BYE\n"))
 			return
 		default:
 			response = "ERR unknown command\n"
 		}
+		m.observe(command, time.Since(start), strings.HasPrefix(response, "ERR"))
 		conn.Write([]byte(response))
 	}
 }
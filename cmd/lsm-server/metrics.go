@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the command latency histogram.
+var latencyBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// histogram counts observations into latencyBuckets. counts[i] holds those
+// at or below latencyBuckets[i] but above the previous bound; the last
+// element holds those above every bound.
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(latencyBuckets, v)
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// metrics collects what the server itself observes; the engine keeps its own statistics.
+type metrics struct {
+	mu                sync.Mutex
+	commands          map[string]*histogram
+	errors            map[string]uint64
+	connectionsTotal  uint64
+	connectionsActive int64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		commands: make(map[string]*histogram),
+		errors:   make(map[string]uint64),
+	}
+}
+
+// connectionOpened records a new client; the returned func records it leaving.
+func (m *metrics) connectionOpened() func() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.connectionsTotal++
+	m.connectionsActive++
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.connectionsActive--
+	}
+}
+
+// observe records one command. Unknown commands share one label, so a client
+// sending garbage cannot grow the set of series without bound.
+func (m *metrics) observe(command string, d time.Duration, failed bool) {
+	if !knownCommands[command] {
+		command = "UNKNOWN"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.commands[command]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets)+1)}
+		m.commands[command] = h
+	}
+	h.observe(d.Seconds())
+	if failed {
+		m.errors[command]++
+	}
+}
+
+// writeTo writes the server's and the engine's metrics in the Prometheus
+// text exposition format.
+func (m *metrics) writeTo(w io.Writer, db *engine.LSM) {
+	m.mu.Lock()
+	names := make([]string, 0, len(m.commands))
+	for name := range m.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	header(w, "lsm_server_command_duration_seconds", "histogram", "Time taken to serve a command.")
+	for _, name := range names {
+		h := m.commands[name]
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "lsm_server_command_duration_seconds_bucket{command=%s,le=%s} %d\n", quote(name), quote(formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "lsm_server_command_duration_seconds_bucket{command=%s,le=\"+Inf\"} %d\n", quote(name), h.count)
+		fmt.Fprintf(w, "lsm_server_command_duration_seconds_sum{command=%s} %s\n", quote(name), formatFloat(h.sum))
+		fmt.Fprintf(w, "lsm_server_command_duration_seconds_count{command=%s} %d\n", quote(name), h.count)
+	}
+	header(w, "lsm_server_command_errors_total", "counter", "Commands answered with an error.")
+	for _, name := range names {
+		fmt.Fprintf(w, "lsm_server_command_errors_total{command=%s} %d\n", quote(name), m.errors[name])
+	}
+	header(w, "lsm_server_connections_total", "counter", "Client connections accepted.")
+	fmt.Fprintf(w, "lsm_server_connections_total %d\n", m.connectionsTotal)
+	header(w, "lsm_server_connections_active", "gauge", "Client connections currently open.")
+	fmt.Fprintf(w, "lsm_server_connections_active %d\n", m.connectionsActive)
+	m.mu.Unlock()
+
+	s := db.Stats()
+	gauge(w, "lsm_memtable_bytes", "Approximate size of the MemTables.", s.MemTableBytes)
+	header(w, "lsm_tables", "gauge", "Live SSTables by level.")
+	for level, n := range s.TablesPerLevel {
+		fmt.Fprintf(w, "lsm_tables{level=\"%d\"} %d\n", level, n)
+	}
+	gauge(w, "lsm_disk_bytes", "Total size of the live SSTables.", s.DiskBytes)
+	gauge(w, "lsm_blob_files", "Live blob files.", int64(s.BlobFiles))
+	gauge(w, "lsm_blob_file_bytes", "Total size of the live blob files.", s.BlobFileBytes)
+	gauge(w, "lsm_blob_live_bytes", "Bytes of blob files still referenced by SSTables.", s.BlobLiveBytes)
+	counter(w, "lsm_user_bytes_total", "Bytes of keys and values written by clients.", s.UserBytes)
+	counter(w, "lsm_flushes_total", "MemTable flushes.", s.Flushes)
+	counter(w, "lsm_flush_bytes_total", "Bytes written by flushes.", s.FlushBytes)
+	counter(w, "lsm_compactions_total", "Compactions.", s.Compactions)
+	counter(w, "lsm_compaction_read_bytes_total", "Bytes read by compactions.", s.CompactionBytesRead)
+	counter(w, "lsm_compaction_written_bytes_total", "Bytes written by compactions.", s.CompactionBytesWritten)
+	counter(w, "lsm_compaction_filter_removed_total", "Entries removed by compaction filters.", s.FilterRemoved)
+	counter(w, "lsm_compaction_filter_changed_total", "Values changed by compaction filters.", s.FilterChanged)
+	counter(w, "lsm_blob_gc_bytes_total", "Bytes moved out of garbage-heavy blob files.", s.BlobGCBytes)
+	counter(w, "lsm_ingested_files_total", "SSTables added by ingestion.", s.IngestedFiles)
+	counter(w, "lsm_ingested_bytes_total", "Bytes of SSTables added by ingestion.", s.IngestedBytes)
+	header(w, "lsm_write_amplification", "gauge", "Bytes written to disk per byte written by clients.")
+	fmt.Fprintf(w, "lsm_write_amplification %s\n", formatFloat(s.WriteAmplification()))
+
+	header(w, "lsm_operations_total", "counter", "Engine operations by type.")
+	for _, op := range []struct {
+		name  string
+		count int64
+	}{{"get", s.Gets}, {"put", s.Puts}, {"delete", s.Deletes}, {"merge", s.Merges}} {
+		fmt.Fprintf(w, "lsm_operations_total{op=%s} %d\n", quote(op.name), op.count)
+	}
+	header(w, "lsm_get_tables_probed_total", "counter", "Gets by the number of SSTables they looked in; the last bucket includes more.")
+	for n, count := range s.TablesProbed {
+		label := strconv.Itoa(n)
+		if n == len(s.TablesProbed)-1 {
+			label += "+"
+		}
+		fmt.Fprintf(w, "lsm_get_tables_probed_total{tables=%s} %d\n", quote(label), count)
+	}
+
+	counter(w, "lsm_block_cache_hits_total", "Block cache hits.", s.CacheHits)
+	counter(w, "lsm_block_cache_misses_total", "Block cache misses.", s.CacheMisses)
+	header(w, "lsm_write_stall_seconds_total", "counter", "Time writes were held back by write stalls.")
+	fmt.Fprintf(w, "lsm_write_stall_seconds_total %s\n", formatFloat(s.StallTime.Seconds()))
+	counter(w, "lsm_delayed_writes_total", "Writes slowed down by a write stall.", s.DelayedWrites)
+	counter(w, "lsm_stopped_writes_total", "Writes blocked by a write stall.", s.StoppedWrites)
+	header(w, "lsm_write_stall", "gauge", "1 for the current write stall condition, with the limit behind it.")
+	for _, c := range []engine.WriteStallCondition{engine.WriteStallNormal, engine.WriteStallDelayed, engine.WriteStallStopped} {
+		v := 0
+		if c == s.WriteStall {
+			v = 1
+		}
+		fmt.Fprintf(w, "lsm_write_stall{condition=%s,cause=%s} %d\n", quote(c.String()), quote(s.WriteStallCause.String()), v)
+	}
+	gauge(w, "lsm_pending_compaction_bytes", "Bytes compaction must read before every family is down to one table.", s.PendingCompactionBytes)
+	up := 1
+	if db.BackgroundError() != nil {
+		up = 0
+	}
+	gauge(w, "lsm_writes_enabled", "1 unless a background error has disabled writes.", int64(up))
+}
+
+func header(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func counter(w io.Writer, name, help string, v int64) {
+	header(w, name, "counter", help)
+	fmt.Fprintf(w, "%s %d\n", name, v)
+}
+
+func gauge(w io.Writer, name, help string, v int64) {
+	header(w, name, "gauge", help)
+	fmt.Fprintf(w, "%s %d\n", name, v)
+}
+
+// labelEscaper escapes what the exposition format does not allow in a
+// label value as it is. Go's %q would escape more, and Prometheus rejects that.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// quote renders v as a label value.
+func quote(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// serveMetrics serves /metrics, /healthz and /readyz on addr.
+func serveMetrics(addr string, m *metrics, db *engine.LSM) error {
+	return http.ListenAndServe(addr, metricsHandler(m, db))
+}
+
+// metricsHandler routes /metrics, /healthz and /readyz.
+func metricsHandler(m *metrics, db *engine.LSM) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.writeTo(w, db)
+	})
+	// Alive as long as the process can answer
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	// Ready only while the engine accepts writes
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := db.BackgroundError(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if s := db.Stats(); s.WriteStall == engine.WriteStallStopped {
+			http.Error(w, fmt.Sprintf("writes stopped until compaction catches up (%v)", s.WriteStallCause), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	return mux
+}
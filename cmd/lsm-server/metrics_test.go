@@ -0,0 +1,148 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine"
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+// get requests path from h and returns the status and body.
+func get(t *testing.T, h http.Handler, path string) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	body, _ := io.ReadAll(rec.Body)
+	return rec.Code, string(body)
+}
+
+// expectLines fails the test for every line of want missing from body.
+func expectLines(t *testing.T, body string, want ...string) {
+	t.Helper()
+	lines := make(map[string]bool)
+	for _, line := range strings.Split(body, "\n") {
+		lines[line] = true
+	}
+	for _, line := range want {
+		if !lines[line] {
+			t.Errorf("Expected %q in the exposition", line)
+		}
+	}
+}
+
+func TestMetrics_Histogram(t *testing.T) {
+	db, err := engine.New("metrics_test", &engine.Options{FS: vfs.NewMem()})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer db.Close()
+
+	m := newMetrics()
+	// A bound is inclusive, just past it is the next bucket, past the last one only +Inf
+	m.observe("GET", 100*time.Microsecond, false)
+	m.observe("GET", 100*time.Microsecond+time.Nanosecond, false)
+	m.observe("GET", time.Second, true)
+	m.observe("GET", 2*time.Second, false)
+	// Commands the server does not know share a label
+	m.observe("FLUSHALL", time.Millisecond, true)
+	m.observe("x\"y", time.Millisecond, false)
+	m.connectionOpened()
+	m.connectionOpened()()
+
+	status, body := get(t, metricsHandler(m, db), "/metrics")
+	if status != http.StatusOK {
+		t.Fatalf("Expected 200 from /metrics, got %d", status)
+	}
+	expectLines(t, body,
+		`lsm_server_command_duration_seconds_bucket{command="GET",le="0.0001"} 1`,
+		`lsm_server_command_duration_seconds_bucket{command="GET",le="0.00025"} 2`,
+		`lsm_server_command_duration_seconds_bucket{command="GET",le="0.5"} 2`,
+		`lsm_server_command_duration_seconds_bucket{command="GET",le="1"} 3`,
+		`lsm_server_command_duration_seconds_bucket{command="GET",le="+Inf"} 4`,
+		`lsm_server_command_duration_seconds_count{command="GET"} 4`,
+		`lsm_server_command_errors_total{command="GET"} 1`,
+		`lsm_server_command_duration_seconds_bucket{command="UNKNOWN",le="0.0005"} 0`,
+		`lsm_server_command_duration_seconds_bucket{command="UNKNOWN",le="0.001"} 2`,
+		`lsm_server_command_duration_seconds_count{command="UNKNOWN"} 2`,
+		`lsm_server_command_errors_total{command="UNKNOWN"} 1`,
+		`lsm_server_connections_total 2`,
+		`lsm_server_connections_active 1`,
+		`lsm_write_stall{condition="normal",cause="none"} 1`,
+		`lsm_writes_enabled 1`,
+	)
+	if strings.Contains(body, "FLUSHALL") {
+		t.Errorf("Expected unknown commands to be folded into UNKNOWN")
+	}
+}
+
+func TestMetrics_LabelEscaping(t *testing.T) {
+	for v, want := range map[string]string{
+		"GET":      `"GET"`,
+		`a"b`:      `"a\"b"`,
+		`a\b`:      `"a\\b"`,
+		"a\nb":     `"a\nb"`,
+		"héllo\tx": "\"héllo\tx\"",
+	} {
+		if got := quote(v); got != want {
+			t.Errorf("quote(%q): expected %s, got %s", v, want, got)
+		}
+	}
+}
+
+func TestMetrics_Readyz(t *testing.T) {
+	fs := vfs.NewFaultFS(vfs.NewMem(), 1)
+
+	// 1. Ready while writes go through
+	db, err := engine.New("readyz_test", &engine.Options{FS: fs})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	h := metricsHandler(newMetrics(), db)
+	if status, _ := get(t, h, "/readyz"); status != http.StatusOK {
+		t.Errorf("Expected 200 from /readyz, got %d", status)
+	}
+
+	// 2. Not ready once a failed WAL write has disabled writes, though still alive
+	fs.FailAfter(vfs.OpWrite, 0)
+	if err := db.Put([]byte("k"), []byte("v")); err == nil {
+		t.Fatal("Expected the Put to fail")
+	}
+	if status, _ := get(t, h, "/readyz"); status != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 from /readyz with writes disabled, got %d", status)
+	}
+	if status, _ := get(t, h, "/healthz"); status != http.StatusOK {
+		t.Errorf("Expected 200 from /healthz, got %d", status)
+	}
+	_, body := get(t, h, "/metrics")
+	expectLines(t, body, `lsm_writes_enabled 0`)
+	db.Close()
+
+	// 3. Not ready while writes are stopped: with a limit of one sorted run,
+	// the first flush stops them and compaction cannot help
+	fs.ClearFaults()
+	db, err = engine.New("readyz_stop_test", &engine.Options{
+		FS:                      fs,
+		MaxMemSize:              16,
+		L0SlowdownWritesTrigger: 1,
+		L0StopWritesTrigger:     1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer db.Close()
+	if err := db.Put([]byte("key"), []byte("a value to fill the MemTable")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	h = metricsHandler(newMetrics(), db)
+	status, body := get(t, h, "/readyz")
+	if status != http.StatusServiceUnavailable || !strings.Contains(body, "writes stopped") {
+		t.Errorf("Expected 503 from /readyz with writes stopped, got %d: %s", status, body)
+	}
+	_, body = get(t, h, "/metrics")
+	expectLines(t, body, `lsm_write_stall{condition="stopped",cause="sorted-runs"} 1`)
+}
@@ -11,10 +11,13 @@ import (
 
 func main() {
 	storageDir := "./stress_storage"
-	os.RemoveAll(storageDir) // Start fresh
+	// Start fresh, unless another process is using the directory
+	if err := engine.Destroy(storageDir, nil); err != nil {
+		log.Fatalf("Failed to clear %s: %v", storageDir, err)
+	}
 
 	// 1. Init DB with a small MemTable (512 bytes) to trigger flushes often
-	db, err := engine.New(storageDir, 512)
+	db, err := engine.New(storageDir, &engine.Options{MaxMemSize: 512})
 	if err != nil {
 		log.Fatalf("Failed to init: %v", err)
 	}
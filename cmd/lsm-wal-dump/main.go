@@ -1,12 +1,13 @@
 package main
 
 import (
-	"encoding/binary"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"strings"
+	"time"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/wal"
 )
 
 func main() {
@@ -16,46 +17,22 @@ func main() {
 	}
 
 	path := os.Args[1]
-	file, err := os.Open(path)
-	if err != nil {
-		log.Fatalf("Failed to open WAL: %v", err)
-	}
-	defer file.Close()
 
 	fmt.Printf("--- Dumping WAL: %s ---\n", path)
-	fmt.Printf("%-20s | %-20s\n", "KEY", "VALUE")
-	fmt.Println(strings.Repeat("-", 45))
-
-	for {
-		// 1. Read the 8-byte header [KeyLen(4)][ValLen(4)]
-		header := make([]byte, 8)
-		_, err := io.ReadFull(file, header)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			fmt.Printf("Error reading header: %v\n", err)
-			break
-		}
-
-		keyLen := binary.LittleEndian.Uint32(header[0:4])
-		valLen := binary.LittleEndian.Uint32(header[4:8])
-
-		// 2. Read the Key
-		key := make([]byte, keyLen)
-		if _, err := io.ReadFull(file, key); err != nil {
-			fmt.Printf("Error reading key: %v\n", err)
-			break
-		}
-
-		// 3. Read the Value
-		value := make([]byte, valLen)
-		if _, err := io.ReadFull(file, value); err != nil {
-			fmt.Printf("Error reading value: %v\n", err)
-			break
+	fmt.Printf("%-6s | %-20s | %-20s | %-20s\n", "FAMILY", "KEY", "VALUE", "EXPIRES")
+	fmt.Println(strings.Repeat("-", 77))
+
+	// The WAL package owns the record format, so let it do the decoding
+	err := wal.Replay(path, func(r wal.Record) error {
+		expires := "-"
+		if r.ExpiresAt != 0 {
+			expires = time.Unix(0, r.ExpiresAt).Format(time.RFC3339)
 		}
-
-		fmt.Printf("%-20s | %-20s\n", string(key), string(value))
+		fmt.Printf("%-6d | %-20s | %-20s | %-20s\n", r.Family, string(r.Key), string(r.Value), expires)
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to read WAL: %v", err)
 	}
 	fmt.Println("--- End of WAL Dump ---")
-}
\ No newline at end of file
+}
@@ -0,0 +1,174 @@
+package engine
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/sstable"
+)
+
+// Range is the interval of keys from Start to End, both inclusive. A nil
+// bound is open, so Range{} covers every key.
+type Range struct {
+	Start, End []byte
+}
+
+// GetApproximateSizes estimates how many bytes of the default column family
+// hold the keys of each range, in its SSTables, the blob files they point at
+// and its MemTable. The estimates come from the tables' indexes and
+// properties, which are kept in memory, so no data blocks are read. Keys
+// still held in several tables count once for each, until compaction
+// merges them.
+func (l *LSM) GetApproximateSizes(ranges []Range) ([]int64, error) {
+	return l.GetApproximateSizesCF(l.defaultCF, ranges)
+}
+
+// GetApproximateSizesCF is like GetApproximateSizes for the column family cf.
+func (l *LSM) GetApproximateSizesCF(cf *ColumnFamily, ranges []Range) ([]int64, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if cf.dropped {
+		return nil, ErrColumnFamilyDropped
+	}
+	sizes := make([]int64, len(ranges))
+	for i, r := range ranges {
+		for _, sst := range cf.sstTables {
+			size, n := sst.ApproximateRange(r.Start, r.End)
+			sizes[i] += size + cf.tableBlobBytes(sst)*int64(n)/int64(max(len(sst.GetIndex()), 1))
+		}
+		size, _ := cf.memTableRange(r)
+		sizes[i] += size
+	}
+	return sizes, nil
+}
+
+// EstimateNumKeys estimates how many keys of the default column family fall
+// in r, from the same in-memory statistics as GetApproximateSizes. Each
+// tombstone is taken to delete a key counted elsewhere, while keys written
+// more than once may be counted more than once, so it is only a guide.
+func (l *LSM) EstimateNumKeys(r Range) (int64, error) {
+	return l.EstimateNumKeysCF(l.defaultCF, r)
+}
+
+// EstimateNumKeysCF is like EstimateNumKeys for the column family cf.
+func (l *LSM) EstimateNumKeysCF(cf *ColumnFamily, r Range) (int64, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if cf.dropped {
+		return 0, ErrColumnFamilyDropped
+	}
+	return cf.estimateNumKeys(r), nil
+}
+
+// estimateNumKeys is EstimateNumKeysCF. The caller must hold l.mu.
+func (cf *ColumnFamily) estimateNumKeys(r Range) int64 {
+	var keys int64
+	for _, sst := range cf.sstTables {
+		_, n := sst.ApproximateRange(r.Start, r.End)
+		if n == 0 {
+			continue
+		}
+		// Tombstones are only counted per table, so assume they are spread evenly
+		tombstones, _ := strconv.ParseInt(sst.Properties()[sstable.PropTombstones], 10, 64)
+		keys += int64(n) - 2*tombstones*int64(n)/int64(len(sst.GetIndex()))
+	}
+	_, n := cf.memTableRange(r)
+	keys += n
+	return max(keys, 0)
+}
+
+// SplitPoints returns up to n-1 keys that divide the default column family
+// into n parts of about the same size: the first part holds the keys before
+// the first point, the next the keys from it up to the second, and so on.
+// They are picked at the granularity of data blocks, so fewer come back when
+// the family is too small to be divided that finely. Like
+// GetApproximateSizes, it reads no data blocks.
+func (l *LSM) SplitPoints(n int) ([][]byte, error) {
+	return l.SplitPointsCF(l.defaultCF, n)
+}
+
+// SplitPointsCF is like SplitPoints for the column family cf.
+func (l *LSM) SplitPointsCF(cf *ColumnFamily, n int) ([][]byte, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if cf.dropped {
+		return nil, ErrColumnFamilyDropped
+	}
+	if n < 2 {
+		return nil, nil
+	}
+
+	// 1. Sample the family: every data block, and every MemTable entry
+	type sample struct {
+		key  []byte
+		size int64
+	}
+	var samples []sample
+	var total int64
+	for _, sst := range cf.sstTables {
+		index := sst.GetIndex()
+		blob := cf.tableBlobBytes(sst)
+		for i := 0; i < len(index); {
+			// A block is the run of index entries sharing its offset. Tables
+			// without blocks have an offset per entry and no lengths.
+			j := i + 1
+			for j < len(index) && index[j].Offset == index[i].Offset {
+				j++
+			}
+			size := int64(index[i].Length)
+			if size == 0 {
+				size = sst.Size() / int64(len(index))
+			}
+			size += blob * int64(j-i) / int64(len(index))
+			samples = append(samples, sample{index[i].Key, size})
+			total += size
+			i = j
+		}
+	}
+	for _, mem := range cf.memTables() {
+		for node := mem.GetIterator(); node != nil; node = node.Next() {
+			size := int64(len(node.Key()) + len(node.Value()))
+			samples = append(samples, sample{node.Key(), size})
+			total += size
+		}
+	}
+
+	// 2. Walk them in key order, cutting wherever another share is complete
+	cmp := cf.opts.Comparator
+	sort.SliceStable(samples, func(i, j int) bool { return cmp.Compare(samples[i].key, samples[j].key) < 0 })
+	var points [][]byte
+	var seen int64
+	for _, s := range samples {
+		if seen >= total*int64(len(points)+1)/int64(n) && seen > 0 &&
+			(len(points) == 0 || cmp.Compare(s.key, points[len(points)-1]) > 0) {
+			points = append(points, append([]byte(nil), s.key...))
+			if len(points) == n-1 {
+				break
+			}
+		}
+		seen += s.size
+	}
+	return points, nil
+}
+
+// memTableRange sums the sizes of the MemTable entries in r and counts them,
+// taking each tombstone to delete a key counted elsewhere. The caller must
+// hold l.mu.
+func (cf *ColumnFamily) memTableRange(r Range) (size, keys int64) {
+	cmp := cf.opts.Comparator
+	for _, mem := range cf.memTables() {
+		node := mem.GetIterator()
+		if r.Start != nil {
+			node = mem.Seek(r.Start)
+		}
+		for ; node != nil && (r.End == nil || cmp.Compare(node.Key(), r.End) <= 0); node = node.Next() {
+			size += int64(len(node.Key()) + len(node.Value()))
+			if node.Type() == sstable.TypeTombstone {
+				keys--
+			} else {
+				keys++
+			}
+		}
+	}
+	return size, keys
+}
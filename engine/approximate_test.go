@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+func TestLSM_ApproximateSizes(t *testing.T) {
+	dir := "approximate_test"
+	fs := vfs.NewMem()
+	lsm, err := New(dir, &Options{FS: fs, MaxMemSize: 1 << 20, BlockSize: 512})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+
+	// 1. 800 keys on disk and 200 in the MemTable, all about the same size
+	value := make([]byte, 100)
+	for i := 0; i < 1000; i++ {
+		lsm.Put([]byte(fmt.Sprintf("key%04d", i)), value)
+		if i == 799 {
+			lsm.flush()
+		}
+	}
+	sizes, err := lsm.GetApproximateSizes([]Range{
+		{},
+		{Start: []byte("key0000"), End: []byte("key0399")},
+		{Start: []byte("key0800"), End: nil},
+		{Start: []byte("zzz"), End: nil},
+	})
+	if err != nil {
+		t.Fatalf("GetApproximateSizes failed: %v", err)
+	}
+	if sizes[0] < 100_000 || sizes[3] != 0 {
+		t.Errorf("Expected at least 100KB in all and nothing past the end, got %v", sizes)
+	}
+	// The first 400 keys sit in the table, the last 200 in the MemTable
+	for i, want := range map[int]int64{1: sizes[0] * 2 / 5, 2: sizes[0] / 5} {
+		if sizes[i] < want*8/10 || sizes[i] > want*12/10 {
+			t.Errorf("Expected range %d to take about %d bytes, got %d", i, want, sizes[i])
+		}
+	}
+
+	// 2. Deletes come off the key estimates
+	for i := 0; i < 100; i++ {
+		lsm.Delete([]byte(fmt.Sprintf("key%04d", i)))
+	}
+	if n, _ := lsm.EstimateNumKeys(Range{}); n != 900 {
+		t.Errorf("Expected 900 keys, got %d", n)
+	}
+	if n, _ := lsm.EstimateNumKeys(Range{Start: []byte("key0100"), End: []byte("key0199")}); n != 100 {
+		t.Errorf("Expected 100 keys in range, got %d", n)
+	}
+	lsm.flush()
+	if val, _ := lsm.GetProperty("lsm.estimate-num-keys"); val != "900" {
+		t.Errorf("Expected lsm.estimate-num-keys to be 900, got %s", val)
+	}
+
+	// 3. Split points cut the keys into even parts
+	points, err := lsm.SplitPoints(4)
+	if err != nil || len(points) != 3 {
+		t.Fatalf("Expected three split points, got %q (%v)", points, err)
+	}
+	for i, p := range points {
+		// Each part holds 250 of the 1000 keys, deleted or not
+		n, _ := strconv.Atoi(string(p[len("key"):]))
+		if want := (i + 1) * 250; n < want-50 || n > want+50 {
+			t.Errorf("Expected split point %d near key%04d, got %s", i, want, p)
+		}
+	}
+	if points, _ := lsm.SplitPoints(1); points != nil {
+		t.Errorf("Expected no split points for one part, got %q", points)
+	}
+}
@@ -0,0 +1,430 @@
+// Package backup keeps numbered, incremental backups of an engine database.
+//
+// A backup directory holds:
+//
+//	shared/<sha256>.sst  SSTables, stored once however many backups hold them
+//	shared/<sha256>.blob blob files, likewise
+//	private/<id>/...     the other files of backup id (MANIFEST, OPTIONS, WAL)
+//	meta/<id>            the list of files in backup id, with their checksums
+//
+// SSTables and blob files never change once written, so a daily backup only
+// stores the files flushed or compacted since the previous one.
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine"
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/blob"
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+var (
+	// ErrNoBackups is returned by RestoreLatest when there is nothing to restore.
+	ErrNoBackups = errors.New("backup: no backups")
+	// ErrNotFound is returned for a backup id that does not exist.
+	ErrNotFound = errors.New("backup: backup not found")
+	// ErrCorrupt is returned by Restore and Verify when a file no longer matches its checksum.
+	ErrCorrupt = errors.New("backup: checksum mismatch")
+	// ErrNotEmpty is returned by Restore when the target directory holds files.
+	ErrNotEmpty = errors.New("backup: target directory is not empty")
+)
+
+const (
+	sharedDir  = "shared"
+	privateDir = "private"
+	metaDir    = "meta"
+	tmpDir     = "tmp"
+)
+
+// Info describes one backup.
+type Info struct {
+	ID        uint32    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Files     []File    `json:"files"`
+}
+
+// Size is the total size of the database the backup holds.
+func (i Info) Size() int64 {
+	var n int64
+	for _, f := range i.Files {
+		n += f.Size
+	}
+	return n
+}
+
+// File is one file of a backed up database.
+type File struct {
+	// Path is relative to the database directory, e.g. "cf_1/123.sst"
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	// Shared files live in the shared directory, under their checksum
+	Shared bool `json:"shared"`
+}
+
+// Engine manages the backups in one directory.
+type Engine struct {
+	dir string
+	fs  vfs.FS
+}
+
+// Open opens, or creates, the backup directory dir in fs. A nil fs means
+// vfs.Default. Databases must be stored in the same fs, so that their
+// SSTables can be hard-linked into backups.
+func Open(dir string, fs vfs.FS) (*Engine, error) {
+	if fs == nil {
+		fs = vfs.Default
+	}
+	for _, sub := range []string{sharedDir, privateDir, metaDir} {
+		if err := fs.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &Engine{dir: dir, fs: fs}, nil
+}
+
+// CreateBackup backs up db, which keeps running meanwhile, as the backup
+// following the newest one.
+func (e *Engine) CreateBackup(db *engine.LSM) (Info, error) {
+	backups, err := e.GetBackupInfo()
+	if err != nil {
+		return Info{}, err
+	}
+	info := Info{ID: 1, Timestamp: time.Now().UTC()}
+	if len(backups) > 0 {
+		info.ID = backups[len(backups)-1].ID + 1
+	}
+
+	// 1. Take a checkpoint: a consistent copy that mostly costs hard links
+	tmp := filepath.Join(e.dir, tmpDir)
+	if err := e.fs.RemoveAll(tmp); err != nil {
+		return Info{}, err
+	}
+	defer e.fs.RemoveAll(tmp)
+	if err := db.Checkpoint(tmp); err != nil {
+		return Info{}, err
+	}
+	paths, err := e.listFiles(tmp, "")
+	if err != nil {
+		return Info{}, err
+	}
+
+	// 2. Move its files in, storing every SSTable and blob file only once
+	private := filepath.Join(e.dir, privateDir, strconv.FormatUint(uint64(info.ID), 10))
+	if err := e.fs.RemoveAll(private); err != nil {
+		return Info{}, err
+	}
+	for _, path := range paths {
+		src := filepath.Join(tmp, path)
+		sum, size, err := e.checksum(src)
+		if err != nil {
+			return Info{}, err
+		}
+		f := File{Path: path, SHA256: sum, Size: size, Shared: isImmutable(path)}
+		dst := e.location(info.ID, f)
+		if _, err := e.fs.Stat(dst); err == nil && f.Shared {
+			info.Files = append(info.Files, f)
+			continue
+		}
+		if err := e.fs.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return Info{}, err
+		}
+		if err := e.fs.Rename(src, dst); err != nil {
+			return Info{}, err
+		}
+		info.Files = append(info.Files, f)
+	}
+
+	// 3. The meta file goes last: until it exists, the backup does not
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return Info{}, err
+	}
+	if err := writeFileAtomic(e.fs, e.metaPath(info.ID), data); err != nil {
+		return Info{}, err
+	}
+	return info, nil
+}
+
+// GetBackupInfo lists the backups, oldest first.
+func (e *Engine) GetBackupInfo() ([]Info, error) {
+	names, err := e.fs.List(filepath.Join(e.dir, metaDir))
+	if err != nil {
+		return nil, err
+	}
+	var backups []Info
+	for _, name := range names {
+		id, err := strconv.ParseUint(name, 10, 32)
+		if err != nil {
+			continue
+		}
+		info, err := e.readInfo(uint32(id))
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, info)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].ID < backups[j].ID })
+	return backups, nil
+}
+
+// PurgeOldBackups deletes all but the newest keep backups, and the shared
+// SSTables only they held.
+func (e *Engine) PurgeOldBackups(keep int) error {
+	backups, err := e.GetBackupInfo()
+	if err != nil {
+		return err
+	}
+	if keep < 0 {
+		keep = 0
+	}
+	for len(backups) > keep {
+		if err := e.deleteBackup(backups[0].ID); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return e.collectGarbage(backups)
+}
+
+// DeleteBackup deletes one backup, and the shared SSTables only it held.
+func (e *Engine) DeleteBackup(id uint32) error {
+	if _, err := e.readInfo(id); err != nil {
+		return err
+	}
+	if err := e.deleteBackup(id); err != nil {
+		return err
+	}
+	backups, err := e.GetBackupInfo()
+	if err != nil {
+		return err
+	}
+	return e.collectGarbage(backups)
+}
+
+// deleteBackup removes the meta file first, so a crash halfway leaves
+// unreferenced files rather than a backup with holes in it.
+func (e *Engine) deleteBackup(id uint32) error {
+	if err := e.fs.Remove(e.metaPath(id)); err != nil {
+		return err
+	}
+	return e.fs.RemoveAll(filepath.Join(e.dir, privateDir, strconv.FormatUint(uint64(id), 10)))
+}
+
+// collectGarbage removes shared files that none of backups refers to.
+func (e *Engine) collectGarbage(backups []Info) error {
+	live := make(map[string]bool)
+	for _, b := range backups {
+		for _, f := range b.Files {
+			if f.Shared {
+				live[filepath.Base(e.location(b.ID, f))] = true
+			}
+		}
+	}
+	names, err := e.fs.List(filepath.Join(e.dir, sharedDir))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if !live[name] {
+			if err := e.fs.Remove(filepath.Join(e.dir, sharedDir, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RestoreLatest restores the newest backup into dir, see Restore.
+func (e *Engine) RestoreLatest(dir string) error {
+	backups, err := e.GetBackupInfo()
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		return ErrNoBackups
+	}
+	return e.Restore(backups[len(backups)-1].ID, dir)
+}
+
+// Restore copies backup id into dir, which must be empty or missing, checking
+// every file against its checksum. engine.New can then open dir. If a
+// file is corrupt, Restore fails with ErrCorrupt and leaves dir empty.
+func (e *Engine) Restore(id uint32, dir string) error {
+	info, err := e.readInfo(id)
+	if err != nil {
+		return err
+	}
+	if names, err := e.fs.List(dir); err == nil && len(names) > 0 {
+		return fmt.Errorf("%w: %s", ErrNotEmpty, dir)
+	}
+	if err := e.restore(info, dir); err != nil {
+		e.fs.RemoveAll(dir)
+		return err
+	}
+	return nil
+}
+
+func (e *Engine) restore(info Info, dir string) error {
+	for _, f := range info.Files {
+		dst := filepath.Join(dir, f.Path)
+		if err := e.fs.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := e.copyVerified(e.location(info.ID, f), dst, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Verify checks that every file of backup id is present and matches its checksum.
+func (e *Engine) Verify(id uint32) error {
+	info, err := e.readInfo(id)
+	if err != nil {
+		return err
+	}
+	for _, f := range info.Files {
+		sum, size, err := e.checksum(e.location(id, f))
+		if err != nil {
+			return err
+		}
+		if sum != f.SHA256 || size != f.Size {
+			return fmt.Errorf("%w: %s in backup %d", ErrCorrupt, f.Path, id)
+		}
+	}
+	return nil
+}
+
+// copyVerified copies src to dst, checking the data against f on the way.
+func (e *Engine) copyVerified(src, dst string, f File) error {
+	in, err := e.fs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := e.fs.Create(dst)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, h), in)
+	if err == nil && (hex.EncodeToString(h.Sum(nil)) != f.SHA256 || size != f.Size) {
+		err = fmt.Errorf("%w: %s", ErrCorrupt, f.Path)
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// isImmutable reports whether the file at path never changes once written,
+// so backups can share it.
+func isImmutable(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".sst" || ext == blob.Ext
+}
+
+// location is where the backup keeps f.
+func (e *Engine) location(id uint32, f File) string {
+	if f.Shared {
+		return filepath.Join(e.dir, sharedDir, f.SHA256+filepath.Ext(f.Path))
+	}
+	return filepath.Join(e.dir, privateDir, strconv.FormatUint(uint64(id), 10), f.Path)
+}
+
+func (e *Engine) metaPath(id uint32) string {
+	return filepath.Join(e.dir, metaDir, strconv.FormatUint(uint64(id), 10))
+}
+
+func (e *Engine) readInfo(id uint32) (Info, error) {
+	data, err := vfs.ReadFile(e.fs, e.metaPath(id))
+	if os.IsNotExist(err) {
+		return Info{}, fmt.Errorf("%w: %d", ErrNotFound, id)
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	var info Info
+	if err := json.Unmarshal(data, &info); err != nil {
+		return Info{}, fmt.Errorf("corrupt meta file for backup %d: %w", id, err)
+	}
+	return info, nil
+}
+
+// checksum returns the SHA-256 and size of the named file.
+func (e *Engine) checksum(name string) (string, int64, error) {
+	f, err := e.fs.Open(name)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// listFiles returns the files under dir/rel, relative to dir.
+func (e *Engine) listFiles(dir, rel string) ([]string, error) {
+	names, err := e.fs.List(filepath.Join(dir, rel))
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, name := range names {
+		path := filepath.Join(rel, name)
+		info, err := e.fs.Stat(filepath.Join(dir, path))
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, path)
+			continue
+		}
+		sub, err := e.listFiles(dir, path)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, sub...)
+	}
+	return paths, nil
+}
+
+// writeFileAtomic replaces path with data through a synced temp file.
+func writeFileAtomic(fs vfs.FS, path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	f, err := fs.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return fs.Rename(tmpPath, path)
+}
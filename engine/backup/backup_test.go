@@ -0,0 +1,140 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine"
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+// expectKeys opens the database in dir and checks key00..key<n-1> hold value.
+func expectKeys(t *testing.T, fs vfs.FS, dir string, n int, value string) {
+	t.Helper()
+	db, err := engine.New(dir, &engine.Options{FS: fs})
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", dir, err)
+	}
+	defer db.Close()
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("key%02d", i)
+		if val, found, _ := db.Get([]byte(key)); !found || string(val) != value {
+			t.Errorf("%s: expected %s=%s, got %q (found %v)", dir, key, value, val, found)
+		}
+	}
+}
+
+func TestBackup_CreateRestorePurge(t *testing.T) {
+	fs := vfs.NewMem()
+	db, err := engine.New("db", &engine.Options{FS: fs, MaxMemSize: 256})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer db.Close()
+	be, err := Open("backups", fs)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if err := be.RestoreLatest("nothing"); !errors.Is(err, ErrNoBackups) {
+		t.Errorf("Expected ErrNoBackups, got %v", err)
+	}
+
+	// 1. Two backups, the second after more flushes: the tables both hold are stored once
+	for i := 0; i < 20; i++ {
+		db.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("v1"))
+	}
+	first, err := be.CreateBackup(db)
+	if err != nil {
+		t.Fatalf("CreateBackup failed: %v", err)
+	}
+	for i := 20; i < 40; i++ {
+		db.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("v1"))
+	}
+	second, err := be.CreateBackup(db)
+	if err != nil {
+		t.Fatalf("CreateBackup failed: %v", err)
+	}
+	if first.ID != 1 || second.ID != 2 {
+		t.Errorf("Expected backups 1 and 2, got %d and %d", first.ID, second.ID)
+	}
+	tables := make(map[string]bool)
+	refs := 0
+	for _, b := range []Info{first, second} {
+		for _, f := range b.Files {
+			if f.Shared {
+				tables[f.SHA256] = true
+				refs++
+			}
+		}
+	}
+	shared, _ := fs.List(filepath.Join("backups", sharedDir))
+	if len(shared) != len(tables) || len(tables) >= refs {
+		t.Errorf("Expected %d shared tables for %d references, found %d", len(tables), refs, len(shared))
+	}
+
+	// 2. Both restore to what they held
+	if err := be.RestoreLatest("restored2"); err != nil {
+		t.Fatalf("RestoreLatest failed: %v", err)
+	}
+	expectKeys(t, fs, "restored2", 40, "v1")
+	if err := be.Restore(first.ID, "restored1"); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	expectKeys(t, fs, "restored1", 20, "v1")
+	if err := be.Restore(first.ID, "restored1"); !errors.Is(err, ErrNotEmpty) {
+		t.Errorf("Expected ErrNotEmpty, got %v", err)
+	}
+
+	// 3. Purging keeps the newest backups and the tables they still need
+	if err := be.PurgeOldBackups(1); err != nil {
+		t.Fatalf("PurgeOldBackups failed: %v", err)
+	}
+	backups, _ := be.GetBackupInfo()
+	if len(backups) != 1 || backups[0].ID != second.ID {
+		t.Fatalf("Expected only backup %d to remain, got %+v", second.ID, backups)
+	}
+	if err := be.Verify(second.ID); err != nil {
+		t.Errorf("Verify after purge failed: %v", err)
+	}
+	if err := be.Restore(first.ID, "restored_gone"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a purged backup, got %v", err)
+	}
+}
+
+func TestBackup_CorruptionIsDetected(t *testing.T) {
+	fs := vfs.NewMem()
+	db, err := engine.New("db", &engine.Options{FS: fs, MaxMemSize: 256})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer db.Close()
+	for i := 0; i < 20; i++ {
+		db.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("v1"))
+	}
+	be, _ := Open("backups", fs)
+	info, err := be.CreateBackup(db)
+	if err != nil {
+		t.Fatalf("CreateBackup failed: %v", err)
+	}
+
+	// Flip the content of one shared table
+	for _, f := range info.Files {
+		if f.Shared {
+			w, _ := fs.Create(be.location(info.ID, f))
+			w.Write([]byte("garbage"))
+			w.Close()
+			break
+		}
+	}
+	if err := be.Verify(info.ID); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected Verify to report ErrCorrupt, got %v", err)
+	}
+	if err := be.RestoreLatest("restored"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected RestoreLatest to report ErrCorrupt, got %v", err)
+	}
+	if names, _ := fs.List("restored"); len(names) != 0 {
+		t.Errorf("Expected a failed restore to leave nothing behind, found %v", names)
+	}
+}
@@ -0,0 +1,261 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/sstable"
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/wal"
+)
+
+// WriteBatch collects writes, possibly across column families, that Write
+// applies atomically: after a crash either all of them are recovered or none.
+// The zero value is an empty batch ready to use.
+type WriteBatch struct {
+	ops []batchOp
+}
+
+// batchOp is a single write. kind is the sstable entry type the write logs
+// as: TypeValue for a put, TypeTombstone for a delete, TypeMerge for a merge operand.
+type batchOp struct {
+	cf        *ColumnFamily
+	key       []byte
+	value     []byte
+	kind      byte
+	expiresAt int64
+}
+
+// Put queues a put into the default column family.
+func (b *WriteBatch) Put(key, value []byte) {
+	b.PutCF(nil, key, value)
+}
+
+// PutCF queues a put into cf.
+func (b *WriteBatch) PutCF(cf *ColumnFamily, key, value []byte) {
+	b.ops = append(b.ops, batchOp{cf: cf, key: key, value: value, kind: sstable.TypeValue})
+}
+
+// Delete queues a delete from the default column family.
+func (b *WriteBatch) Delete(key []byte) {
+	b.DeleteCF(nil, key)
+}
+
+// DeleteCF queues a delete from cf.
+func (b *WriteBatch) DeleteCF(cf *ColumnFamily, key []byte) {
+	b.ops = append(b.ops, batchOp{cf: cf, key: key, kind: sstable.TypeTombstone})
+}
+
+// Merge queues a merge operand for the default column family.
+func (b *WriteBatch) Merge(key, operand []byte) {
+	b.MergeCF(nil, key, operand)
+}
+
+// MergeCF queues a merge operand for cf.
+func (b *WriteBatch) MergeCF(cf *ColumnFamily, key, operand []byte) {
+	b.ops = append(b.ops, batchOp{cf: cf, key: key, value: operand, kind: sstable.TypeMerge})
+}
+
+// Len returns the number of queued writes.
+func (b *WriteBatch) Len() int {
+	return len(b.ops)
+}
+
+// Write applies every write in b atomically.
+func (l *LSM) Write(b *WriteBatch) error {
+	ops := make([]batchOp, len(b.ops))
+	for i, op := range b.ops {
+		if op.cf == nil {
+			op.cf = l.defaultCF
+		}
+		ops[i] = op
+	}
+	return l.write(ops)
+}
+
+// write waits out any write stall, then applies ops under the lock. A
+// MemTable that fills up is flushed once the lock is released, so reads and
+// other writes go on meanwhile. Events are delivered last, so listeners never
+// run under the lock.
+func (l *LSM) write(ops []batchOp) error {
+	defer l.events.deliver()
+	n := 0
+	for _, op := range ops {
+		n += len(op.key) + len(op.value)
+	}
+	if err := l.throttle(n); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	frozen, err := l.writeLocked(ops)
+	l.mu.Unlock()
+	if err != nil || !frozen {
+		return err
+	}
+	l.flushMu.Lock()
+	defer l.flushMu.Unlock()
+	return l.flushFrozen()
+}
+
+// writeLocked logs ops to the WAL as one batch and applies them to the
+// MemTables, freezing them if one fills up. It reports whether it did, in
+// which case the caller must flush them. The caller must hold l.mu.
+func (l *LSM) writeLocked(ops []batchOp) (bool, error) {
+	if l.opts.ReadOnly {
+		return false, ErrReadOnly
+	}
+	if l.walErr != nil {
+		return false, l.walErr
+	}
+	if len(ops) == 0 {
+		return false, nil
+	}
+	for _, op := range ops {
+		if op.cf.dropped {
+			return false, ErrColumnFamilyDropped
+		}
+	}
+
+	// 1. Work out what every key will hold before touching anything, so a
+	// failing merge leaves neither the WAL nor the MemTables half updated
+	states, err := l.prepare(ops, l.clock.Now())
+	if err != nil {
+		return false, err
+	}
+
+	// 2. Log the whole batch as one WAL record
+	records := make([]wal.Record, len(ops))
+	for i, op := range ops {
+		records[i] = wal.Record{Key: op.key, Value: op.value, Type: op.kind, Family: op.cf.id, ExpiresAt: op.expiresAt}
+	}
+	if err := l.wal.WriteBatch(records); err != nil {
+		// The batch may be partly on disk, and a later successful sync
+		// would make it durable even though it was never acknowledged
+		l.setWALErr(ErrorDuringWrite, fmt.Errorf("engine: WAL write failed, writes are disabled: %w", err))
+		return false, err
+	}
+
+	// 3. Count, then apply to the MemTables
+	for _, op := range ops {
+		l.stats.userBytes.Add(int64(len(op.key) + len(op.value)))
+		switch op.kind {
+		case sstable.TypeTombstone:
+			l.stats.deletes.Add(1)
+		case sstable.TypeMerge:
+			l.stats.merges.Add(1)
+		default:
+			l.stats.puts.Add(1)
+		}
+	}
+	return l.apply(ops, states)
+}
+
+// prepare computes the entry each op leaves in its family's MemTable. Merge
+// operands are folded onto what the MemTable (or an earlier op in the same
+// batch) holds for the key.
+func (l *LSM) prepare(ops []batchOp, now time.Time) ([]sstable.Entry, error) {
+	type slot struct {
+		family uint32
+		key    string
+	}
+	pending := make(map[slot]sstable.Entry)
+	states := make([]sstable.Entry, len(ops))
+	for i, op := range ops {
+		s := slot{op.cf.id, string(op.key)}
+		var e sstable.Entry
+		switch op.kind {
+		case sstable.TypeTombstone:
+			e = sstable.Entry{Type: sstable.TypeTombstone}
+		case sstable.TypeMerge:
+			if op.cf.opts.MergeOperator == nil {
+				return nil, ErrNoMergeOperator
+			}
+			e = sstable.Entry{Type: sstable.TypeMerge, Value: encodeOperands([][]byte{op.value})}
+			current, found := pending[s]
+			if !found {
+				if node, ok := op.cf.memTable.GetNode(op.key); ok {
+					current, found = memEntry(node), true
+				}
+			}
+			if found {
+				var err error
+				if e, err = op.cf.foldEntries(op.key, e, current, now); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			e = sstable.Entry{Value: op.value, Type: sstable.TypeValue, ExpiresAt: op.expiresAt}
+		}
+		pending[s] = e
+		states[i] = e
+	}
+	return states, nil
+}
+
+// apply stores prepared states in the MemTables and freezes them if one is
+// full, reporting whether it did.
+func (l *LSM) apply(ops []batchOp, states []sstable.Entry) (bool, error) {
+	full := false
+	for i, op := range ops {
+		e := states[i]
+		if err := op.cf.memTable.PutEntry(op.key, e.Value, e.Type, e.ExpiresAt); err != nil {
+			return false, err
+		}
+		full = full || op.cf.memTable.IsFull()
+	}
+	// check if a memTable is full and freeze it for a flush if needed
+	if full {
+		return l.freeze()
+	}
+	return false, nil
+}
+
+// replayWAL rebuilds the MemTables from the WALs after a restart, starting
+// where the last replay stopped: at walOffset in WAL walNumber. Every WAL
+// from the manifest's log number on holds writes that are not in an SSTable
+// yet, the current one and those of MemTables frozen for a flush that never
+// finished. Writes to families that have since been dropped are skipped.
+func (l *LSM) replayWAL() error {
+	names, err := l.fs.List(l.dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var numbers []uint64
+	for _, name := range names {
+		if n, ok := parseWALName(name); ok && n >= l.walNumber {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+
+	now := l.clock.Now()
+	apply := func(r wal.Record) error {
+		cf, ok := l.families[r.Family]
+		if !ok {
+			return nil
+		}
+		ops := []batchOp{{cf: cf, key: r.Key, value: r.Value, kind: r.Type, expiresAt: r.ExpiresAt}}
+		states, err := l.prepare(ops, now)
+		if err != nil {
+			return err
+		}
+		for i, op := range ops {
+			if err := op.cf.memTable.PutEntry(op.key, states[i].Value, states[i].Type, states[i].ExpiresAt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, n := range numbers {
+		if n > l.walNumber {
+			l.walNumber, l.walOffset = n, 0
+		}
+		end, err := wal.ReplayFrom(l.fs, walPath(l.dir, n), l.walOffset, apply)
+		l.walOffset = end
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+// Package blob stores large values apart from the SSTables, in append-only
+// blob files, so that compaction can rewrite the tables without copying the
+// values along. The tables hold a Ref to each value instead.
+//
+// A blob file is a sequence of records, each framed as
+// [CRC32(4)][KeyLen(4)][ValueLen(4)][Key][Value], the checksum covering
+// everything after itself. Keeping the key lets tools and the garbage
+// collector tell what a record belongs to without the table that points at it.
+package blob
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/ratelimit"
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+// Ext is the extension of blob files, which are named <number>.blob.
+const Ext = ".blob"
+
+// recordHeaderSize is [CRC32(4)][KeyLen(4)][ValueLen(4)]
+const recordHeaderSize = 12
+
+// ErrCorrupt is returned for a record that fails its checksum or does not
+// match the reference pointing at it.
+var ErrCorrupt = errors.New("blob: corrupt record")
+
+// FileName names the blob file with the given number.
+func FileName(number uint64) string {
+	return strconv.FormatUint(number, 10) + Ext
+}
+
+// ParseFileName is the inverse of FileName, ignoring any directory.
+func ParseFileName(path string) (uint64, bool) {
+	name, ok := strings.CutSuffix(filepath.Base(path), Ext)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(name, 10, 64)
+	return n, err == nil
+}
+
+// Ref locates a record: the number of its file, where it starts and how
+// long it is, header included.
+type Ref struct {
+	File   uint64
+	Offset int64
+	Size   uint32
+}
+
+// Encode packs the reference as three uvarints.
+func (r Ref) Encode() []byte {
+	buf := binary.AppendUvarint(nil, r.File)
+	buf = binary.AppendUvarint(buf, uint64(r.Offset))
+	return binary.AppendUvarint(buf, uint64(r.Size))
+}
+
+// DecodeRef is the inverse of Ref.Encode.
+func DecodeRef(buf []byte) (Ref, error) {
+	var fields [3]uint64
+	for i := range fields {
+		n, size := binary.Uvarint(buf)
+		if size <= 0 {
+			return Ref{}, fmt.Errorf("%w: bad reference", ErrCorrupt)
+		}
+		fields[i], buf = n, buf[size:]
+	}
+	if len(buf) != 0 || fields[2] > 1<<32-1 {
+		return Ref{}, fmt.Errorf("%w: bad reference", ErrCorrupt)
+	}
+	return Ref{File: fields[0], Offset: int64(fields[1]), Size: uint32(fields[2])}, nil
+}
+
+// WriterOptions configures a Writer.
+type WriterOptions struct {
+	// FS is where the file is created. Nil means vfs.Default.
+	FS vfs.FS
+	// RateLimiter, when set, paces the writes at IOPriority.
+	RateLimiter *ratelimit.Limiter
+	IOPriority  ratelimit.Priority
+}
+
+// Writer appends records to a new blob file.
+type Writer struct {
+	file   vfs.File
+	number uint64
+	offset int64
+	opts   WriterOptions
+}
+
+// NewWriter creates the blob file at path, numbered number.
+func NewWriter(path string, number uint64, opts WriterOptions) (*Writer, error) {
+	if opts.FS == nil {
+		opts.FS = vfs.Default
+	}
+	f, err := opts.FS.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create blob file: %w", err)
+	}
+	return &Writer{file: f, number: number, opts: opts}, nil
+}
+
+// Add appends the value of key and returns where it went.
+func (w *Writer) Add(key, value []byte) (Ref, error) {
+	rec := make([]byte, recordHeaderSize, recordHeaderSize+len(key)+len(value))
+	binary.LittleEndian.PutUint32(rec[4:8], uint32(len(key)))
+	binary.LittleEndian.PutUint32(rec[8:12], uint32(len(value)))
+	rec = append(append(rec, key...), value...)
+	binary.LittleEndian.PutUint32(rec[0:4], crc32.ChecksumIEEE(rec[4:]))
+
+	w.opts.RateLimiter.Request(int64(len(rec)), w.opts.IOPriority)
+	if _, err := w.file.Write(rec); err != nil {
+		return Ref{}, err
+	}
+	ref := Ref{File: w.number, Offset: w.offset, Size: uint32(len(rec))}
+	w.offset += int64(len(rec))
+	return ref, nil
+}
+
+// Size is how many bytes have been written so far.
+func (w *Writer) Size() int64 {
+	return w.offset
+}
+
+// Close syncs the file, which must be durable before a table points into it, and closes it.
+func (w *Writer) Close() error {
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// Reader reads the records of a blob file. It is safe for concurrent use.
+type Reader struct {
+	file vfs.File
+	path string
+	size int64
+}
+
+// Open opens the blob file at path in fs.
+func Open(fs vfs.FS, path string) (*Reader, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Reader{file: f, path: path, size: info.Size()}, nil
+}
+
+// Read returns the value ref points at, and the key it was stored under.
+func (r *Reader) Read(ref Ref) (key, value []byte, err error) {
+	if ref.Size < recordHeaderSize || ref.Offset < 0 || ref.Offset+int64(ref.Size) > r.size {
+		return nil, nil, fmt.Errorf("%w: reference %+v outside %s", ErrCorrupt, ref, r.path)
+	}
+	rec := make([]byte, ref.Size)
+	if _, err := r.file.ReadAt(rec, ref.Offset); err != nil {
+		return nil, nil, err
+	}
+	key, value, err = decodeRecord(rec)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s at %d: %w", r.path, ref.Offset, err)
+	}
+	return key, value, nil
+}
+
+// decodeRecord checks a whole record and splits it into key and value.
+func decodeRecord(rec []byte) (key, value []byte, err error) {
+	keyLen := int64(binary.LittleEndian.Uint32(rec[4:8]))
+	valueLen := int64(binary.LittleEndian.Uint32(rec[8:12]))
+	if recordHeaderSize+keyLen+valueLen != int64(len(rec)) {
+		return nil, nil, ErrCorrupt
+	}
+	if crc32.ChecksumIEEE(rec[4:]) != binary.LittleEndian.Uint32(rec[0:4]) {
+		return nil, nil, ErrCorrupt
+	}
+	return rec[recordHeaderSize : recordHeaderSize+keyLen], rec[recordHeaderSize+keyLen:], nil
+}
+
+// Scan calls fn for every record of the file, in the order they were written.
+func (r *Reader) Scan(fn func(ref Ref, key, value []byte) error) error {
+	number, _ := ParseFileName(r.path)
+	header := make([]byte, recordHeaderSize)
+	for offset := int64(0); offset < r.size; {
+		if _, err := r.file.ReadAt(header, offset); err != nil {
+			return fmt.Errorf("%s at %d: %w", r.path, offset, err)
+		}
+		size := recordHeaderSize + int64(binary.LittleEndian.Uint32(header[4:8])) + int64(binary.LittleEndian.Uint32(header[8:12]))
+		ref := Ref{File: number, Offset: offset, Size: uint32(size)}
+		key, value, err := r.Read(ref)
+		if err != nil {
+			return err
+		}
+		if err := fn(ref, key, value); err != nil {
+			return err
+		}
+		offset += size
+	}
+	return nil
+}
+
+// Path is where the file lives.
+func (r *Reader) Path() string {
+	return r.path
+}
+
+// Size is the length of the file.
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+// Close releases the file.
+func (r *Reader) Close() error {
+	return r.file.Close()
+}
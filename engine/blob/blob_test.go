@@ -0,0 +1,87 @@
+package blob
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+func TestBlob_WriteRead(t *testing.T) {
+	fs := vfs.NewMem()
+	path := FileName(42)
+	w, err := NewWriter(path, 42, WriterOptions{FS: fs})
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	var refs []Ref
+	for i := 0; i < 3; i++ {
+		ref, err := w.Add([]byte(fmt.Sprintf("key%d", i)), bytes.Repeat([]byte{byte('a' + i)}, 100*(i+1)))
+		if err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+		refs = append(refs, ref)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// References survive encoding, and point at their values
+	r, err := Open(fs, path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer r.Close()
+	for i, ref := range refs {
+		decoded, err := DecodeRef(ref.Encode())
+		if err != nil || decoded != ref || ref.File != 42 {
+			t.Fatalf("Reference %+v decoded to %+v (%v)", ref, decoded, err)
+		}
+		key, value, err := r.Read(decoded)
+		if err != nil || string(key) != fmt.Sprintf("key%d", i) || len(value) != 100*(i+1) {
+			t.Errorf("Read %+v: got %q, %d bytes (%v)", ref, key, len(value), err)
+		}
+	}
+	var scanned []Ref
+	r.Scan(func(ref Ref, key, value []byte) error {
+		scanned = append(scanned, ref)
+		return nil
+	})
+	if fmt.Sprint(scanned) != fmt.Sprint(refs) || r.Size() != w.Size() {
+		t.Errorf("Scan found %v, expected %v", scanned, refs)
+	}
+	if n, ok := ParseFileName("cf_1/" + path); !ok || n != 42 {
+		t.Errorf("ParseFileName: got %d, %v", n, ok)
+	}
+}
+
+func TestBlob_Corruption(t *testing.T) {
+	fs := vfs.NewMem()
+	w, _ := NewWriter("1.blob", 1, WriterOptions{FS: fs})
+	ref, _ := w.Add([]byte("key"), []byte("value"))
+	w.Close()
+
+	data, _ := vfs.ReadFile(fs, "1.blob")
+	data[len(data)-1] ^= 0xff
+	f, _ := fs.Create("1.blob")
+	f.Write(data)
+	f.Close()
+
+	r, err := Open(fs, "1.blob")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer r.Close()
+	if _, _, err := r.Read(ref); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for a flipped byte, got %v", err)
+	}
+	ref.Size++
+	if _, _, err := r.Read(ref); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt past the end of the file, got %v", err)
+	}
+	if _, err := DecodeRef([]byte{0xff}); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for a truncated reference, got %v", err)
+	}
+}
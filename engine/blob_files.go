@@ -0,0 +1,356 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/blob"
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/ratelimit"
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/sstable"
+)
+
+// DefaultBlobGCThreshold is the live ratio below which blob files are
+// garbage collected, applied to a zero Options.BlobGCThreshold.
+const DefaultBlobGCThreshold = 0.5
+
+// propBlobRefs is the table property that says how many bytes of each blob
+// file the table references, as space-separated <number>:<bytes> pairs.
+// The live bytes of a blob file are the sum over the live tables, so nothing
+// else has to keep track of them.
+const propBlobRefs = "blob.refs"
+
+// blobReaders holds the open blob files of a family, opened on first use.
+type blobReaders struct {
+	mu   sync.Mutex
+	open map[uint64]*blob.Reader
+}
+
+// blobPath is where the blob file numbered number of the family lives.
+func (cf *ColumnFamily) blobPath(number uint64) string {
+	return filepath.Join(cf.dir, blob.FileName(number))
+}
+
+// blobFileSizes looks up the sizes of the family's blob files, given by name,
+// and returns them by number.
+func (cf *ColumnFamily) blobFileSizes(names []string) (map[uint64]int64, error) {
+	files := make(map[uint64]int64, len(names))
+	for _, name := range names {
+		number, ok := blob.ParseFileName(name)
+		if !ok {
+			return nil, fmt.Errorf("bad blob file name %q", name)
+		}
+		info, err := cf.writerOpts.FS.Stat(cf.blobPath(number))
+		if err != nil {
+			return nil, err
+		}
+		files[number] = info.Size()
+	}
+	return files, nil
+}
+
+// blobFileNames lists the family's live blob files, oldest first.
+func (cf *ColumnFamily) blobFileNames() []string {
+	names := make([]string, 0, len(cf.blobFiles))
+	for number := range cf.blobFiles {
+		names = append(names, blob.FileName(number))
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, _ := blob.ParseFileName(names[i])
+		b, _ := blob.ParseFileName(names[j])
+		return a < b
+	})
+	return names
+}
+
+// readBlob replaces a reference to a blob with the value it points at.
+func (cf *ColumnFamily) readBlob(key []byte, e sstable.Entry) (sstable.Entry, error) {
+	ref, err := blob.DecodeRef(e.Value)
+	if err != nil {
+		return e, err
+	}
+	cf.blobs.mu.Lock()
+	r, ok := cf.blobs.open[ref.File]
+	if !ok {
+		if r, err = blob.Open(cf.writerOpts.FS, cf.blobPath(ref.File)); err != nil {
+			cf.blobs.mu.Unlock()
+			return e, err
+		}
+		if cf.blobs.open == nil {
+			cf.blobs.open = make(map[uint64]*blob.Reader)
+		}
+		cf.blobs.open[ref.File] = r
+	}
+	cf.blobs.mu.Unlock()
+
+	storedKey, value, err := r.Read(ref)
+	if err != nil {
+		return e, err
+	}
+	if !bytes.Equal(storedKey, key) {
+		return e, fmt.Errorf("%w: %s at %d holds %q, not %q", blob.ErrCorrupt, r.Path(), ref.Offset, storedKey, key)
+	}
+	return sstable.Entry{Type: sstable.TypeValue, Value: value, ExpiresAt: e.ExpiresAt}, nil
+}
+
+// closeBlob closes the blob file numbered number if it is open.
+func (cf *ColumnFamily) closeBlob(number uint64) {
+	cf.blobs.mu.Lock()
+	defer cf.blobs.mu.Unlock()
+	if r, ok := cf.blobs.open[number]; ok {
+		r.Close()
+		delete(cf.blobs.open, number)
+	}
+}
+
+// closeBlobs releases every open blob file of the family.
+func (cf *ColumnFamily) closeBlobs() {
+	cf.blobs.mu.Lock()
+	defer cf.blobs.mu.Unlock()
+	for number, r := range cf.blobs.open {
+		r.Close()
+		delete(cf.blobs.open, number)
+	}
+}
+
+// blobRefs reads the propBlobRefs property of a table.
+func blobRefs(sst *sstable.Reader) map[uint64]int64 {
+	refs := make(map[uint64]int64)
+	for _, pair := range strings.Fields(sst.Properties()[propBlobRefs]) {
+		number, size, _ := strings.Cut(pair, ":")
+		n, err1 := strconv.ParseUint(number, 10, 64)
+		b, err2 := strconv.ParseInt(size, 10, 64)
+		if err1 == nil && err2 == nil {
+			refs[n] += b
+		}
+	}
+	return refs
+}
+
+// encodeBlobRefs is the inverse of blobRefs.
+func encodeBlobRefs(refs map[uint64]int64) string {
+	numbers := make([]uint64, 0, len(refs))
+	for n := range refs {
+		numbers = append(numbers, n)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	pairs := make([]string, len(numbers))
+	for i, n := range numbers {
+		pairs[i] = fmt.Sprintf("%d:%d", n, refs[n])
+	}
+	return strings.Join(pairs, " ")
+}
+
+// blobLiveBytes is how many bytes of each blob file the family's tables
+// still reference, not to be changed. The caller must hold the engine's lock.
+func (cf *ColumnFamily) blobLiveBytes() map[uint64]int64 {
+	return cf.blobLive
+}
+
+// tableBlobBytes is how many bytes of blob files sst, one of the family's
+// tables, points at. The caller must hold the engine's lock.
+func (cf *ColumnFamily) tableBlobBytes(sst *sstable.Reader) int64 {
+	var n int64
+	for _, size := range cf.tableBlobRefs[sst] {
+		n += size
+	}
+	return n
+}
+
+// blobGarbage returns the blob files whose live ratio is below threshold,
+// and those nothing references any more. The caller must hold the engine's lock.
+func (cf *ColumnFamily) blobGarbage(threshold float64) (collect, dead map[uint64]bool) {
+	collect, dead = make(map[uint64]bool), make(map[uint64]bool)
+	live := cf.blobLiveBytes()
+	for n, size := range cf.blobFiles {
+		switch {
+		case live[n] == 0:
+			dead[n] = true
+		case size > 0 && float64(live[n])/float64(size) < threshold:
+			collect[n] = true
+		}
+	}
+	return collect, dead
+}
+
+// blobGCInputs is the shortest run of the family's tables, newest first,
+// holding every reference into the blob files in collect: compacting it
+// leaves them dead. The caller must hold the engine's lock.
+func (cf *ColumnFamily) blobGCInputs(collect map[uint64]bool) []*sstable.Reader {
+	first, last := -1, -1
+	for i, sst := range cf.sstTables {
+		for n := range cf.tableBlobRefs[sst] {
+			if collect[n] {
+				if first < 0 {
+					first = i
+				}
+				last = i
+				break
+			}
+		}
+	}
+	if first < 0 {
+		return nil
+	}
+	return cf.sstTables[first : last+1]
+}
+
+// blobOutput moves the large values of a table being written into a blob
+// file of its own, created on first use, and counts the table's references
+// for propBlobRefs.
+type blobOutput struct {
+	cf     *ColumnFamily
+	number uint64
+	opts   blob.WriterOptions
+	// minSize is the smallest value moved out of the table, 0 for none
+	minSize int
+	// collect lists the blob files whose referenced values are moved to the
+	// new file too, see blobGarbage
+	collect map[uint64]bool
+	w       *blob.Writer
+	size    int64
+	refs    map[uint64]int64
+	// relocated counts the bytes moved out of collected files
+	relocated int64
+}
+
+// newBlobOutput prepares the blob file numbered number for a table of cf.
+func (cf *ColumnFamily) newBlobOutput(number uint64, priority ratelimit.Priority, collect map[uint64]bool) *blobOutput {
+	return &blobOutput{
+		cf:      cf,
+		number:  number,
+		opts:    blob.WriterOptions{FS: cf.writerOpts.FS, RateLimiter: cf.writerOpts.RateLimiter, IOPriority: priority},
+		minSize: cf.minBlobSize,
+		collect: collect,
+		refs:    make(map[uint64]int64),
+	}
+}
+
+// store returns the entry to write for key: large values are moved to the
+// blob file, and values in collected files are moved again.
+func (o *blobOutput) store(key []byte, e sstable.Entry) (sstable.Entry, error) {
+	switch {
+	case e.Type == sstable.TypeValue && e.ExpiresAt == 0 && o.minSize > 0 && len(e.Value) >= o.minSize:
+	case e.Type == sstable.TypeBlobIndex:
+		ref, err := blob.DecodeRef(e.Value)
+		if err != nil {
+			return e, err
+		}
+		if !o.collect[ref.File] {
+			o.refs[ref.File] += int64(ref.Size)
+			return e, nil
+		}
+		o.cf.writerOpts.RateLimiter.Request(int64(ref.Size), ratelimit.Low)
+		if e, err = o.cf.readBlob(key, e); err != nil {
+			return e, err
+		}
+		o.relocated += int64(ref.Size)
+	default:
+		return e, nil
+	}
+
+	if o.w == nil {
+		w, err := blob.NewWriter(o.cf.blobPath(o.number), o.number, o.opts)
+		if err != nil {
+			return e, err
+		}
+		o.w = w
+	}
+	ref, err := o.w.Add(key, e.Value)
+	if err != nil {
+		return e, err
+	}
+	o.refs[ref.File] += int64(ref.Size)
+	return sstable.Entry{Type: sstable.TypeBlobIndex, Value: ref.Encode()}, nil
+}
+
+// finish makes the blob file durable and records the references in the
+// table, before it is closed.
+func (o *blobOutput) finish(w *sstable.Writer) error {
+	if len(o.refs) > 0 {
+		w.SetProperty(propBlobRefs, encodeBlobRefs(o.refs))
+	}
+	if o.w == nil {
+		return nil
+	}
+	o.size = o.w.Size()
+	err := o.w.Close()
+	o.w = nil
+	return err
+}
+
+// created reports the size of the finished blob file, if one was written.
+func (o *blobOutput) created() (int64, bool) {
+	if o == nil || o.size == 0 {
+		return 0, false
+	}
+	return o.size, true
+}
+
+// addBlobFile records the blob file of o, if it wrote one, as live. The
+// caller must hold the engine's lock.
+func (cf *ColumnFamily) addBlobFile(o *blobOutput) {
+	size, ok := o.created()
+	if !ok {
+		return
+	}
+	if cf.blobFiles == nil {
+		cf.blobFiles = make(map[uint64]int64)
+	}
+	cf.blobFiles[o.number] = size
+}
+
+// abandon removes the blob file, whatever state it is in.
+func (o *blobOutput) abandon() {
+	if o == nil {
+		return
+	}
+	if o.w != nil {
+		o.w.Close()
+		o.w = nil
+	}
+	o.cf.writerOpts.FS.Remove(o.cf.blobPath(o.number))
+}
+
+// collectBlobGarbage compacts every table of the first family, in id order,
+// holding blob files whose live ratio fell below Options.BlobGCThreshold, so
+// the values still in use move to a new file and the old ones can go. It
+// returns false when there was nothing to do or compaction failed.
+func (l *LSM) collectBlobGarbage() bool {
+	defer l.events.deliver()
+	l.compactMu.Lock()
+	defer l.compactMu.Unlock()
+
+	l.mu.RLock()
+	var target *ColumnFamily
+	var inputs []*sstable.Reader
+	for _, cf := range l.familyList() {
+		// Skip families a CompactRange call is busy with
+		if !cf.compactMu.TryLock() {
+			continue
+		}
+		collect, _ := cf.blobGarbage(l.opts.BlobGCThreshold)
+		if inputs = cf.blobGCInputs(collect); len(inputs) > 0 {
+			target = cf
+			break
+		}
+		cf.compactMu.Unlock()
+	}
+	l.mu.RUnlock()
+	if target == nil {
+		return false
+	}
+	defer target.compactMu.Unlock()
+	if err := l.compactRange(context.Background(), target, inputs, CompactionBlobGarbage); err != nil {
+		l.opts.Logger.Printf("blob garbage collection of column family %q failed: %v", target.name, err)
+		info := BackgroundErrorInfo{Reason: ErrorDuringCompaction, Err: err}
+		l.events.push(func(el EventListener) { el.OnBackgroundError(info) })
+		return false
+	}
+	return true
+}
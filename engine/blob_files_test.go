@@ -0,0 +1,228 @@
+package engine
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/sstable"
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+// bigValue is a value well over the MinBlobSize the tests use.
+func bigValue(key, version string) []byte {
+	return []byte(key + "=" + version + ":" + strings.Repeat("x", 200))
+}
+
+func TestLSM_BlobFiles(t *testing.T) {
+	dir := "blob_files_test"
+	fs := vfs.NewMem()
+	opts := &Options{FS: fs, MaxMemSize: 1 << 20, MinBlobSize: 100, MergeOperator: StringAppendOperator{Delimiter: ","}}
+	lsm, err := New(dir, opts)
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	flush := func() {
+		lsm.flush()
+	}
+
+	// 1. Large values go to a blob file, small and expiring ones stay inline
+	lsm.Put([]byte("big"), bigValue("big", "v1"))
+	lsm.Put([]byte("small"), []byte("tiny"))
+	lsm.PutWithTTL([]byte("ttl"), bigValue("ttl", "v1"), time.Hour)
+	flush()
+	if n := len(lsm.defaultCF.blobFiles); n != 1 {
+		t.Fatalf("Expected one blob file after the flush, got %d", n)
+	}
+	sst := lsm.defaultCF.sstTables[0]
+	for key, want := range map[string]byte{"big": sstable.TypeBlobIndex, "small": sstable.TypeValue, "ttl": sstable.TypeValue} {
+		if e, _, _ := sst.GetEntry([]byte(key)); e.Type != want {
+			t.Errorf("Expected %s stored as type %d, got %d", key, want, e.Type)
+		}
+	}
+
+	// 2. Reads follow the reference, merges fold onto the stored value
+	if val, found, err := lsm.Get([]byte("big")); err != nil || !found || string(val) != string(bigValue("big", "v1")) {
+		t.Errorf("Get big: got %d bytes (found %v, err %v)", len(val), found, err)
+	}
+	lsm.Merge([]byte("big"), []byte("tail"))
+	want := string(bigValue("big", "v1")) + ",tail"
+	if val, _, err := lsm.Get([]byte("big")); string(val) != want {
+		t.Errorf("Expected the operand appended to the blob value, got %d bytes (%v)", len(val), err)
+	}
+	it, err := lsm.NewIterator()
+	if err != nil {
+		t.Fatalf("NewIterator failed: %v", err)
+	}
+	defer it.Close()
+	for it.Next() {
+		if string(it.Key()) == "big" && string(it.Value()) != want {
+			t.Errorf("Iterator: got %d bytes for big", len(it.Value()))
+		}
+	}
+	if v, ok := lsm.GetProperty("lsm.num-blob-files"); !ok || v != "1" {
+		t.Errorf("Expected lsm.num-blob-files 1, got %q", v)
+	}
+
+	// 3. Reopening keeps the live blob file and removes strays
+	lsm.Close()
+	stray := filepath.Join(dir, "7.blob")
+	f, _ := fs.Create(stray)
+	f.Close()
+	if lsm, err = New(dir, opts); err != nil {
+		t.Fatalf("Failed to reopen: %v", err)
+	}
+	defer lsm.Close()
+	if _, err := fs.Stat(stray); err == nil {
+		t.Error("Expected the blob file missing from the manifest to be removed")
+	}
+	if val, _, err := lsm.Get([]byte("big")); string(val) != want {
+		t.Errorf("After reopen: got %d bytes for big (%v)", len(val), err)
+	}
+}
+
+func TestLSM_BlobGarbageCollection(t *testing.T) {
+	fs := vfs.NewMem()
+	lsm, err := New("blob_gc_test", &Options{FS: fs, MaxMemSize: 1 << 20, MinBlobSize: 100})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+	flush := func() {
+		lsm.flush()
+	}
+	// checkLive compares the live bytes kept as tables come and go with the
+	// tables' own properties
+	checkLive := func(when string) {
+		t.Helper()
+		lsm.mu.RLock()
+		defer lsm.mu.RUnlock()
+		want := make(map[uint64]int64)
+		for _, sst := range lsm.defaultCF.sstTables {
+			for n, b := range blobRefs(sst) {
+				want[n] += b
+			}
+		}
+		if got := lsm.defaultCF.blobLiveBytes(); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: expected live blob bytes %v, got %v", when, want, got)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key%d", i)
+		lsm.Put([]byte(key), bigValue(key, "v1"))
+	}
+	flush()
+	var first uint64
+	for number := range lsm.defaultCF.blobFiles {
+		first = number
+	}
+
+	// 1. Overwriting most keys leaves the first file mostly garbage once
+	// compaction drops the old references
+	for i := 0; i < 8; i++ {
+		key := fmt.Sprintf("key%d", i)
+		lsm.Put([]byte(key), bigValue(key, "v2"))
+	}
+	flush()
+	if err := lsm.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	checkLive("After compaction")
+
+	// 2. Garbage collection moves the two live values on and deletes the file.
+	// The background worker may have beaten us to it.
+	lsm.collectBlobGarbage()
+	lsm.mu.RLock()
+	_, live := lsm.defaultCF.blobFiles[first]
+	lsm.mu.RUnlock()
+	if live {
+		t.Fatal("Expected the mostly dead blob file to be collected")
+	}
+	if _, err := fs.Stat(lsm.defaultCF.blobPath(first)); err == nil {
+		t.Error("Expected the collected blob file to be deleted")
+	}
+	checkLive("After collection")
+	s := lsm.Stats()
+	if s.BlobGCBytes == 0 || s.BlobFiles != 2 || s.BlobLiveBytes != s.BlobFileBytes {
+		t.Errorf("Unexpected blob stats after collection: %+v", s)
+	}
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key%d", i)
+		version := "v2"
+		if i >= 8 {
+			version = "v1"
+		}
+		if val, _, err := lsm.Get([]byte(key)); string(val) != string(bigValue(key, version)) {
+			t.Errorf("Expected %s=%s after collection, got %d bytes (%v)", key, version, len(val), err)
+		}
+	}
+}
+
+func TestLSM_BlobGarbageCollectionSpan(t *testing.T) {
+	rec := &recordingListener{}
+	lsm, err := New("blob_gc_span_test", &Options{
+		FS:              vfs.NewMem(),
+		MaxMemSize:      1 << 20,
+		MinBlobSize:     100,
+		BlobGCThreshold: -1,
+		EventListeners:  []EventListener{rec},
+	})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+
+	// 1. A compacted table left referencing a mostly dead file, with newer
+	// tables on top that do not reference it
+	for _, version := range []string{"v1", "v2"} {
+		for i := 0; i < 10; i++ {
+			key := fmt.Sprintf("key%d", i)
+			if version == "v1" || i < 8 {
+				lsm.Put([]byte(key), bigValue(key, version))
+			}
+		}
+		lsm.flush()
+	}
+	if err := lsm.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	lsm.Put([]byte("inline"), []byte("small"))
+	lsm.flush()
+	lsm.Put([]byte("newer"), bigValue("newer", "v1"))
+	lsm.flush()
+	lsm.mu.Lock()
+	lsm.opts.BlobGCThreshold = DefaultBlobGCThreshold
+	newer := append([]*sstable.Reader(nil), lsm.defaultCF.sstTables[:2]...)
+	lsm.mu.Unlock()
+	rec.take()
+
+	// 2. Collection rewrites the compacted table alone
+	if !lsm.collectBlobGarbage() {
+		t.Fatal("Expected a blob garbage collection")
+	}
+	events, infos := rec.take()
+	for i, e := range events {
+		if info, ok := infos[i].(CompactionInfo); ok && e == "compaction-begin" && len(info.Inputs) != 1 {
+			t.Errorf("Expected one input table, got %v", info.Inputs)
+		}
+	}
+	lsm.mu.RLock()
+	tables := lsm.defaultCF.sstTables
+	if len(tables) != 3 || tables[0] != newer[0] || tables[1] != newer[1] {
+		t.Errorf("Expected the two newer tables untouched, got %d tables", len(tables))
+	}
+	lsm.mu.RUnlock()
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key%d", i)
+		version := "v2"
+		if i >= 8 {
+			version = "v1"
+		}
+		if val, _, err := lsm.Get([]byte(key)); string(val) != string(bigValue(key, version)) {
+			t.Errorf("Expected %s=%s after collection, got %d bytes (%v)", key, version, len(val), err)
+		}
+	}
+}
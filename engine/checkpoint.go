@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+// Checkpoint writes a consistent snapshot of the open database to dir, which
+// must not exist yet. New can open the result like any other database.
+//
+// The MemTables are flushed first, so the snapshot is made of SSTables and
+// blob files. Those never change once written, so they are hard-linked rather
+// than copied: the checkpoint is cheap, and only takes space of its own once
+// compaction replaces the originals. A read-only instance cannot flush, so
+// its checkpoint carries a copy of the WAL instead.
+func (l *LSM) Checkpoint(dir string) error {
+	if _, err := l.fs.Stat(dir); err == nil {
+		return fmt.Errorf("%w: %s", ErrDBExists, dir)
+	}
+	defer l.events.deliver()
+
+	// 1. Capture the MemTables. Writes that come in after the flush are in
+	// the WAL, which is copied.
+	if !l.opts.ReadOnly {
+		if err := l.flush(); err != nil {
+			return err
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// 2. Build the checkpoint next to its final place and move it there
+	// once complete, so dir never holds half a database
+	tmp := dir + ".tmp"
+	if err := l.fs.RemoveAll(tmp); err != nil {
+		return err
+	}
+	if err := l.writeCheckpoint(tmp); err != nil {
+		l.fs.RemoveAll(tmp)
+		return err
+	}
+	return l.fs.Rename(tmp, dir)
+}
+
+// writeCheckpoint fills dir with the files of the current state. The caller must hold l.mu.
+func (l *LSM) writeCheckpoint(dir string) error {
+	if err := l.fs.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	// 1. Link every live SSTable and blob file
+	for _, cf := range l.familyList() {
+		cfDir := dir
+		if cf.id != 0 {
+			cfDir = filepath.Join(dir, filepath.Base(cf.dir))
+			if err := l.fs.MkdirAll(cfDir, 0755); err != nil {
+				return err
+			}
+		}
+		for _, sst := range cf.sstTables {
+			if err := linkOrCopy(l.fs, sst.Path(), filepath.Join(cfDir, filepath.Base(sst.Path()))); err != nil {
+				return err
+			}
+		}
+		for _, name := range cf.blobFileNames() {
+			if err := linkOrCopy(l.fs, filepath.Join(cf.dir, name), filepath.Join(cfDir, name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 2. Copy the files that keep changing: the WALs, which hold what was
+	// written since the flush, and the options
+	names := []string{optionsName}
+	for n := l.logNumber; n <= l.walNumber; n++ {
+		names = append(names, filepath.Base(walPath(l.dir, n)))
+	}
+	for _, name := range names {
+		err := copyFile(l.fs, filepath.Join(l.dir, name), filepath.Join(dir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	// 3. The manifest goes last: it is what makes the directory a database
+	return writeManifest(l.fs, dir, l.currentManifest())
+}
+
+// linkOrCopy hard-links src to dst, and copies it where links are not
+// possible, e.g. across filesystems.
+func linkOrCopy(fs vfs.FS, src, dst string) error {
+	if err := fs.Link(src, dst); err == nil {
+		return nil
+	}
+	return copyFile(fs, src, dst)
+}
+
+// copyFile copies src to dst and syncs the copy.
+func copyFile(fs vfs.FS, src, dst string) error {
+	in, err := fs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := fs.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+func TestLSM_Checkpoint(t *testing.T) {
+	dir := "checkpoint_test"
+	fs := vfs.NewMem()
+
+	lsm, err := New(dir, &Options{FS: fs, MaxMemSize: 256})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+	users, err := lsm.CreateColumnFamily("users", ColumnFamilyOptions{})
+	if err != nil {
+		t.Fatalf("CreateColumnFamily failed: %v", err)
+	}
+
+	// Some keys are flushed, the last ones are only in the MemTable
+	for i := 0; i < 30; i++ {
+		lsm.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("before"))
+	}
+	lsm.PutCF(users, []byte("u"), []byte("alice"))
+
+	if err := lsm.Checkpoint("checkpoint_snap"); err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+	if err := lsm.Checkpoint("checkpoint_snap"); !errors.Is(err, ErrDBExists) {
+		t.Errorf("Expected ErrDBExists for an existing target, got %v", err)
+	}
+
+	// Changes after the checkpoint, including a compaction that removes the
+	// linked originals, must not reach it
+	for i := 0; i < 30; i++ {
+		lsm.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("after"))
+	}
+	lsm.Delete([]byte("key00"))
+	if err := lsm.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+
+	snap, err := New("checkpoint_snap", &Options{FS: fs})
+	if err != nil {
+		t.Fatalf("Failed to open checkpoint: %v", err)
+	}
+	defer snap.Close()
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprintf("key%02d", i)
+		if val, found, _ := snap.Get([]byte(key)); !found || string(val) != "before" {
+			t.Errorf("Checkpoint: expected %s=before, got %q (found %v)", key, val, found)
+		}
+	}
+	scf, ok := snap.GetColumnFamily("users")
+	if !ok {
+		t.Fatal("Checkpoint lost the users column family")
+	}
+	if val, _, _ := snap.GetCF(scf, []byte("u")); string(val) != "alice" {
+		t.Errorf("Checkpoint: expected u=alice, got %q", val)
+	}
+}
+
+func TestLSM_CheckpointReadOnly(t *testing.T) {
+	dir := "checkpoint_ro_test"
+	fs := vfs.NewMem()
+
+	lsm, err := New(dir, &Options{FS: fs})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	lsm.Put([]byte("k"), []byte("v"))
+	lsm.Close()
+
+	// A read-only instance cannot flush, so the WAL carries its MemTable
+	ro, err := OpenReadOnly(dir, &Options{FS: fs})
+	if err != nil {
+		t.Fatalf("OpenReadOnly failed: %v", err)
+	}
+	defer ro.Close()
+	if err := ro.Checkpoint("checkpoint_ro_snap"); err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+
+	snap, err := New("checkpoint_ro_snap", &Options{FS: fs})
+	if err != nil {
+		t.Fatalf("Failed to open checkpoint: %v", err)
+	}
+	defer snap.Close()
+	if val, found, _ := snap.Get([]byte("k")); !found || string(val) != "v" {
+		t.Errorf("Expected k=v in the checkpoint, got %q (found %v)", val, found)
+	}
+}
@@ -0,0 +1,16 @@
+package engine
+
+import "time"
+
+// Clock tells the engine what time it is. TTL expiry is measured against it,
+// so tests can swap in a clock they advance by hand.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the default Clock backed by the wall clock.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,406 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/memtable"
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/sstable"
+)
+
+// DefaultColumnFamilyName is the family used by Get, Put and Delete. It always
+// exists, keeps its SSTables directly in the data directory and cannot be dropped.
+const DefaultColumnFamilyName = "default"
+
+var (
+	// ErrColumnFamilyExists is returned when creating a family whose name is taken.
+	ErrColumnFamilyExists = errors.New("engine: column family already exists")
+	// ErrColumnFamilyDropped is returned when using a handle after its family was dropped.
+	ErrColumnFamilyDropped = errors.New("engine: column family has been dropped")
+)
+
+// CompactionStrategy decides which tables Compact merges.
+type CompactionStrategy int
+
+const (
+	// CompactOldestPair merges the two oldest tables. It is the default.
+	CompactOldestPair CompactionStrategy = iota
+	// CompactAll merges every table of the family into one.
+	CompactAll
+)
+
+// ColumnFamilyOptions tunes a single column family.
+type ColumnFamilyOptions struct {
+	// MaxMemSize is how many bytes the family's MemTable buffers before a
+	// flush. Families share one WAL, so they are always flushed together.
+	// Zero means the size the engine was opened with.
+	MaxMemSize int
+	// Comparator orders the family's keys. Nil means BytewiseComparator.
+	Comparator Comparator
+	// MergeOperator folds values written with Merge. Nil disables Merge.
+	MergeOperator MergeOperator
+	// CompactionStrategy decides what Compact merges.
+	CompactionStrategy CompactionStrategy
+	// CompactionFilterFactory creates the CompactionFilter of each flush
+	// and compaction of the family. Nil keeps every entry.
+	CompactionFilterFactory CompactionFilterFactory
+}
+
+// ColumnFamily is a handle to an independent keyspace inside the engine. Each
+// family has its own MemTable, SSTables and options, while all of them share
+// the engine's WAL so a WriteBatch across families is atomic.
+type ColumnFamily struct {
+	id       uint32
+	name     string
+	dir      string
+	opts     ColumnFamilyOptions
+	memTable *memtable.MemTable
+	// imm are the family's MemTables frozen for a flush, newest first
+	imm       []*memtable.MemTable
+	sstTables []*sstable.Reader
+	dropped   bool
+	// blobFiles are the live blob files of the family, by number, with
+	// their sizes. Changed under the engine's lock, like sstTables.
+	blobFiles   map[uint64]int64
+	blobs       blobReaders
+	minBlobSize int
+	// tableBlobRefs are the blob bytes each table references, read once
+	// from its properties, and blobLive their totals per blob file. Kept
+	// up to date by setTables.
+	tableBlobRefs map[*sstable.Reader]map[uint64]int64
+	blobLive      map[uint64]int64
+	// pinnedTables and pinnedBlobs count the pins readers working without
+	// l.mu hold on each table and blob file, see pin. Those that left the
+	// family while pinned wait in retiredTables and retiredBlobs until the
+	// last pin goes. Changed under the engine's lock.
+	pinnedTables  map[*sstable.Reader]int
+	pinnedBlobs   map[uint64]int
+	retiredTables []*sstable.Reader
+	retiredBlobs  []uint64
+	// droppedTables are the tables of a dropped family whose directory is
+	// still to be removed, which waits for the last pin too
+	droppedTables []*sstable.Reader
+	removeDir     bool
+	// compactMu serialises the family's compactions. Non-exclusive
+	// CompactRange calls take only this one, see LSM.compactMu.
+	compactMu sync.Mutex
+
+	// writerOpts and readerOpts combine the family's comparator with the
+	// engine-wide table settings
+	writerOpts sstable.WriterOptions
+	readerOpts sstable.ReaderOptions
+}
+
+// Name returns the family's name.
+func (cf *ColumnFamily) Name() string {
+	return cf.name
+}
+
+// newColumnFamily builds the in-memory state of a family, filling in default options.
+func (l *LSM) newColumnFamily(id uint32, name string, opts ColumnFamilyOptions) *ColumnFamily {
+	if opts.MaxMemSize <= 0 {
+		opts.MaxMemSize = l.opts.MaxMemSize
+	}
+	if opts.Comparator == nil {
+		opts.Comparator = BytewiseComparator
+	}
+	dir := l.dir
+	if id != 0 {
+		dir = filepath.Join(l.dir, fmt.Sprintf("cf_%d", id))
+	}
+	return &ColumnFamily{
+		id:       id,
+		name:     name,
+		dir:      dir,
+		opts:     opts,
+		memTable: memtable.New(opts.MaxMemSize, opts.Comparator.Compare),
+
+		minBlobSize: l.opts.MinBlobSize,
+		writerOpts:  l.opts.writerOptions(opts.Comparator),
+		readerOpts:  sstable.ReaderOptions{Comparator: opts.Comparator, Cache: l.cache, FS: l.fs},
+	}
+}
+
+// memTables returns the family's MemTables, newest first: the one taking
+// writes, then those waiting to be flushed. The caller must hold l.mu.
+func (cf *ColumnFamily) memTables() []*memtable.MemTable {
+	return append([]*memtable.MemTable{cf.memTable}, cf.imm...)
+}
+
+// loadTables opens the family's SSTables, given newest first.
+func (cf *ColumnFamily) loadTables(names []string) error {
+	for _, name := range names {
+		reader, err := sstable.OpenWithOptions(filepath.Join(cf.dir, name), cf.readerOpts)
+		if err != nil {
+			return err
+		}
+		cf.setTables(append(cf.sstTables, reader))
+	}
+	return nil
+}
+
+// setTables replaces the family's tables, newest first, reading the blob
+// references of those new to the family and dropping those of the ones that
+// left from the totals. The caller must hold l.mu.
+func (cf *ColumnFamily) setTables(tables []*sstable.Reader) {
+	if cf.tableBlobRefs == nil {
+		cf.tableBlobRefs = make(map[*sstable.Reader]map[uint64]int64)
+		cf.blobLive = make(map[uint64]int64)
+	}
+	live := make(map[*sstable.Reader]bool, len(tables))
+	for _, sst := range tables {
+		live[sst] = true
+		if _, ok := cf.tableBlobRefs[sst]; ok {
+			continue
+		}
+		refs := blobRefs(sst)
+		cf.tableBlobRefs[sst] = refs
+		for n, b := range refs {
+			cf.blobLive[n] += b
+		}
+	}
+	for sst, refs := range cf.tableBlobRefs {
+		if live[sst] {
+			continue
+		}
+		for n, b := range refs {
+			if cf.blobLive[n] -= b; cf.blobLive[n] == 0 {
+				delete(cf.blobLive, n)
+			}
+		}
+		delete(cf.tableBlobRefs, sst)
+	}
+	cf.sstTables = tables
+}
+
+// closeTables releases the family's open SSTables and blob files, pinned
+// ones included.
+func (cf *ColumnFamily) closeTables() error {
+	cf.closeBlobs()
+	var firstErr error
+	for _, sst := range append(cf.sstTables, cf.retiredTables...) {
+		if err := sst.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// tablePins are the tables and blob files of a family pinned by pin.
+type tablePins struct {
+	cf     *ColumnFamily
+	tables []*sstable.Reader
+	blobs  []uint64
+}
+
+// pin keeps the family's tables, newest first as ever, and its blob files
+// open and on disk until unpin, even once compaction replaces them, so they
+// can be read without holding l.mu. The caller must hold l.mu for writing.
+func (cf *ColumnFamily) pin() *tablePins {
+	if cf.pinnedTables == nil {
+		cf.pinnedTables = make(map[*sstable.Reader]int)
+		cf.pinnedBlobs = make(map[uint64]int)
+	}
+	p := &tablePins{cf: cf, tables: cf.sstTables}
+	for _, sst := range cf.sstTables {
+		cf.pinnedTables[sst]++
+	}
+	for number := range cf.blobFiles {
+		cf.pinnedBlobs[number]++
+		p.blobs = append(p.blobs, number)
+	}
+	return p
+}
+
+// unpin releases the pins of p, retiring what left the family meanwhile once
+// nothing pins it any more. The caller must hold l.mu for writing.
+func (l *LSM) unpin(p *tablePins) {
+	cf := p.cf
+	for _, sst := range p.tables {
+		if cf.pinnedTables[sst]--; cf.pinnedTables[sst] == 0 {
+			delete(cf.pinnedTables, sst)
+		}
+	}
+	for _, number := range p.blobs {
+		if cf.pinnedBlobs[number]--; cf.pinnedBlobs[number] == 0 {
+			delete(cf.pinnedBlobs, number)
+		}
+	}
+	// Close has released every file already
+	if l.closed {
+		return
+	}
+	tables, blobs := cf.retiredTables, cf.retiredBlobs
+	cf.retiredTables, cf.retiredBlobs = nil, nil
+	for _, sst := range tables {
+		l.retireTable(cf, sst)
+	}
+	for _, number := range blobs {
+		l.retireBlob(cf, number)
+	}
+	if err := l.removeDropped(cf); err != nil {
+		l.opts.Logger.Printf("failed to remove dropped column family %q: %v", cf.name, err)
+	}
+}
+
+// retireTable closes and deletes a table that left the family, or leaves
+// that to unpin while the table is pinned. A secondary instance only closes
+// it: the files are the primary's to delete. The caller must hold l.mu.
+func (l *LSM) retireTable(cf *ColumnFamily, sst *sstable.Reader) {
+	if cf.pinnedTables[sst] > 0 {
+		cf.retiredTables = append(cf.retiredTables, sst)
+		return
+	}
+	sst.Close()
+	if l.secondary {
+		return
+	}
+	// A dropped family reports its tables itself
+	if l.fs.Remove(sst.Path()) == nil && !cf.dropped {
+		deleted := TableFileInfo{ColumnFamily: cf.name, Path: sst.Path(), Size: sst.Size(), Reason: TableCompaction}
+		l.events.push(func(el EventListener) { el.OnTableFileDeleted(deleted) })
+	}
+}
+
+// retireBlob is like retireTable for the blob file numbered number.
+func (l *LSM) retireBlob(cf *ColumnFamily, number uint64) {
+	if cf.pinnedBlobs[number] > 0 {
+		cf.retiredBlobs = append(cf.retiredBlobs, number)
+		return
+	}
+	cf.closeBlob(number)
+	if !l.secondary {
+		l.fs.Remove(cf.blobPath(number))
+	}
+}
+
+// familyList returns the live families ordered by id. The caller must hold l.mu.
+func (l *LSM) familyList() []*ColumnFamily {
+	list := make([]*ColumnFamily, 0, len(l.families))
+	for _, cf := range l.families {
+		list = append(list, cf)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].id < list[j].id })
+	return list
+}
+
+// DefaultColumnFamily returns the handle of the default family.
+func (l *LSM) DefaultColumnFamily() *ColumnFamily {
+	return l.defaultCF
+}
+
+// GetColumnFamily returns the handle of the family called name.
+func (l *LSM) GetColumnFamily(name string) (*ColumnFamily, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, cf := range l.families {
+		if cf.name == name {
+			return cf, true
+		}
+	}
+	return nil, false
+}
+
+// CreateColumnFamily adds a new, empty family. Its options are recorded in
+// the OPTIONS file by name only: a custom comparator or merge operator must be
+// passed again through Options.ColumnFamilies when the engine is reopened.
+func (l *LSM) CreateColumnFamily(name string, opts ColumnFamilyOptions) (*ColumnFamily, error) {
+	if l.opts.ReadOnly {
+		return nil, ErrReadOnly
+	}
+	if err := validateStrategy(opts.CompactionStrategy); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOptions, err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, cf := range l.families {
+		if cf.name == name {
+			return nil, fmt.Errorf("%w: %q", ErrColumnFamilyExists, name)
+		}
+	}
+
+	cf := l.newColumnFamily(l.nextFamilyID, name, opts)
+	// 0755 means the owner can read/write/execute, and others can read/execute
+	if err := l.fs.MkdirAll(cf.dir, 0755); err != nil {
+		return nil, err
+	}
+	l.families[cf.id] = cf
+	l.nextFamilyID++
+	if err := l.saveManifest(); err != nil {
+		delete(l.families, cf.id)
+		l.nextFamilyID--
+		return nil, err
+	}
+	if err := l.saveOptions(); err != nil {
+		l.opts.Logger.Printf("failed to update %s: %v", optionsName, err)
+	}
+	return cf, nil
+}
+
+// DropColumnFamily deletes a family and all of its data. The handle, and any
+// copy of it, fails with ErrColumnFamilyDropped from then on. Files an
+// export still reads are deleted once it is done.
+func (l *LSM) DropColumnFamily(cf *ColumnFamily) error {
+	if cf.id == 0 {
+		return fmt.Errorf("engine: the default column family cannot be dropped")
+	}
+	if l.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	defer l.events.deliver()
+	// Keep compaction off the family's tables while they are removed
+	l.compactMu.Lock()
+	defer l.compactMu.Unlock()
+	cf.compactMu.Lock()
+	defer cf.compactMu.Unlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if cf.dropped {
+		return ErrColumnFamilyDropped
+	}
+
+	// 1. Forget the family in the manifest first, so a crash past this point
+	// can only leave unreferenced files behind
+	delete(l.families, cf.id)
+	if err := l.saveManifest(); err != nil {
+		l.families[cf.id] = cf
+		return err
+	}
+	cf.dropped = true
+	if err := l.saveOptions(); err != nil {
+		l.opts.Logger.Printf("failed to update %s: %v", optionsName, err)
+	}
+
+	// 2. Release its files, those an export still reads once it is done.
+	// Records still in the WAL are skipped on replay.
+	cf.droppedTables, cf.removeDir = cf.sstTables, true
+	cf.setTables(nil)
+	for _, sst := range cf.droppedTables {
+		l.retireTable(cf, sst)
+	}
+	for number := range cf.blobFiles {
+		l.retireBlob(cf, number)
+	}
+	l.updateWriteStall()
+	return l.removeDropped(cf)
+}
+
+// removeDropped deletes the directory of a dropped family and reports its
+// tables deleted, unless something still pins them. The caller must hold l.mu.
+func (l *LSM) removeDropped(cf *ColumnFamily) error {
+	if !cf.removeDir || len(cf.pinnedTables) > 0 || len(cf.pinnedBlobs) > 0 {
+		return nil
+	}
+	if err := l.fs.RemoveAll(cf.dir); err != nil {
+		return err
+	}
+	for _, sst := range cf.droppedTables {
+		info := TableFileInfo{ColumnFamily: cf.name, Path: sst.Path(), Size: sst.Size(), Reason: TableDropped}
+		l.events.push(func(el EventListener) { el.OnTableFileDeleted(info) })
+	}
+	cf.droppedTables, cf.removeDir = nil, false
+	return nil
+}
@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+func TestLSM_ColumnFamilies(t *testing.T) {
+	dir := "column_family_test"
+	fs := vfs.NewMem()
+
+	lsm, err := New(dir, &Options{FS: fs, MaxMemSize: 1024 * 1024})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+
+	users, err := lsm.CreateColumnFamily("users", ColumnFamilyOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create column family: %v", err)
+	}
+	if _, err := lsm.CreateColumnFamily("users", ColumnFamilyOptions{}); !errors.Is(err, ErrColumnFamilyExists) {
+		t.Fatalf("Expected ErrColumnFamilyExists, got %v", err)
+	}
+
+	// 1. The same key lives independently in each family
+	lsm.Put([]byte("k"), []byte("default"))
+	lsm.PutCF(users, []byte("k"), []byte("users"))
+	if val, _, _ := lsm.Get([]byte("k")); string(val) != "default" {
+		t.Errorf("Expected 'default', got '%s'", val)
+	}
+	if val, _, _ := lsm.GetCF(users, []byte("k")); string(val) != "users" {
+		t.Errorf("Expected 'users', got '%s'", val)
+	}
+
+	// 2. A batch spans families, with part of the data already on disk
+	lsm.flush()
+	var b WriteBatch
+	b.Put([]byte("a"), []byte("1"))
+	b.PutCF(users, []byte("b"), []byte("2"))
+	b.DeleteCF(users, []byte("k"))
+	if err := lsm.Write(&b); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	lsm.Close()
+
+	// 3. Reopen: the manifest restores the family and the WAL the unflushed batch
+	lsm, err = New(dir, &Options{FS: fs, MaxMemSize: 1024 * 1024})
+	if err != nil {
+		t.Fatalf("Failed to reopen LSM: %v", err)
+	}
+	defer lsm.Close()
+	users, ok := lsm.GetColumnFamily("users")
+	if !ok {
+		t.Fatal("Expected column family 'users' after reopen")
+	}
+	if val, _, _ := lsm.Get([]byte("a")); string(val) != "1" {
+		t.Errorf("Expected '1', got '%s'", val)
+	}
+	if val, _, _ := lsm.GetCF(users, []byte("b")); string(val) != "2" {
+		t.Errorf("Expected '2', got '%s'", val)
+	}
+	if _, found, _ := lsm.GetCF(users, []byte("k")); found {
+		t.Error("Expected 'k' to be deleted from 'users'")
+	}
+	if val, _, _ := lsm.Get([]byte("k")); string(val) != "default" {
+		t.Errorf("Expected 'default', got '%s'", val)
+	}
+
+	// 4. Dropping a family removes its data and invalidates the handle
+	if err := lsm.DropColumnFamily(users); err != nil {
+		t.Fatalf("Failed to drop column family: %v", err)
+	}
+	if _, _, err := lsm.GetCF(users, []byte("b")); !errors.Is(err, ErrColumnFamilyDropped) {
+		t.Errorf("Expected ErrColumnFamilyDropped, got %v", err)
+	}
+	if _, ok := lsm.GetColumnFamily("users"); ok {
+		t.Error("Expected 'users' to be gone after drop")
+	}
+	if err := lsm.DropColumnFamily(lsm.DefaultColumnFamily()); err == nil {
+		t.Error("Expected dropping the default family to fail")
+	}
+}
+
+func TestLSM_DropPinnedColumnFamily(t *testing.T) {
+	fs := vfs.NewMem()
+	rec := &recordingListener{}
+	lsm, err := New("drop_pinned_test", &Options{FS: fs, MaxMemSize: 1024 * 1024, EventListeners: []EventListener{rec}})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+	users, err := lsm.CreateColumnFamily("users", ColumnFamilyOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create column family: %v", err)
+	}
+	lsm.PutCF(users, []byte("u"), []byte("alice"))
+	lsm.flush()
+	dropped := func() int {
+		n := 0
+		events, _ := rec.take()
+		for _, e := range events {
+			if e == "deleted-dropped" {
+				n++
+			}
+		}
+		return n
+	}
+
+	// 1. Dropping a family an export is reading leaves its files until it is done
+	lsm.mu.Lock()
+	pins := users.pin()
+	lsm.mu.Unlock()
+	rec.take()
+	if err := lsm.DropColumnFamily(users); err != nil {
+		t.Fatalf("DropColumnFamily failed: %v", err)
+	}
+	if _, _, err := lsm.GetCF(users, []byte("u")); !errors.Is(err, ErrColumnFamilyDropped) {
+		t.Errorf("Expected ErrColumnFamilyDropped, got %v", err)
+	}
+	if e, _, err := pins.tables[0].GetEntry([]byte("u")); err != nil || string(e.Value) != "alice" {
+		t.Errorf("Expected the pinned table to read u=alice, got %q (%v)", e.Value, err)
+	}
+	if n := dropped(); n != 0 {
+		t.Errorf("Expected no tables reported deleted while pinned, got %d", n)
+	}
+
+	// 2. Unpinning removes them
+	lsm.mu.Lock()
+	lsm.unpin(pins)
+	lsm.mu.Unlock()
+	lsm.events.deliver()
+	if _, err := fs.Stat(users.dir); err == nil {
+		t.Error("Expected the family's directory removed once unpinned")
+	}
+	if n := dropped(); n != 1 {
+		t.Errorf("Expected the table reported deleted once unpinned, got %d", n)
+	}
+}
@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/sstable"
+)
+
+// FilterDecision is what a CompactionFilter wants done with an entry.
+type FilterDecision int
+
+const (
+	// FilterKeep leaves the entry as it is.
+	FilterKeep FilterDecision = iota
+	// FilterRemove deletes the key. Older versions may still sit in tables
+	// the job does not read, so the entry becomes a tombstone, dropped once
+	// it reaches the bottom.
+	FilterRemove
+	// FilterChangeValue replaces the value with the one Filter returned.
+	FilterChangeValue
+)
+
+func (d FilterDecision) String() string {
+	switch d {
+	case FilterKeep:
+		return "keep"
+	case FilterRemove:
+		return "remove"
+	case FilterChangeValue:
+		return "change-value"
+	default:
+		return fmt.Sprintf("FilterDecision(%d)", int(d))
+	}
+}
+
+// CompactionFilter drops or rewrites entries as flushes and compactions copy
+// them, which purges data or migrates its encoding without a pass of its
+// own. A filter belongs to a single job, so it may keep state between calls
+// and is never called concurrently.
+type CompactionFilter interface {
+	// Filter decides what happens to the value of key. It sees values only,
+	// in key order: not tombstones, nor merge operands the job could not
+	// fold. newValue is used with FilterChangeValue, and the filter may not
+	// keep value or key after returning.
+	Filter(key, value []byte) (decision FilterDecision, newValue []byte)
+}
+
+// CompactionFilterContext describes the job a filter is created for.
+type CompactionFilterContext struct {
+	ColumnFamily string
+	// Flush is set for flushes, whose output is the newest table rather than
+	// the result of merging older ones.
+	Flush bool
+	// Reason is why a compaction runs. It is meaningless for flushes.
+	Reason CompactionReason
+	// Bottommost is set for compactions whose output is the oldest table
+	// of the family, where removed entries are dropped straight away.
+	Bottommost bool
+	// Subcompaction numbers the key ranges of a compaction split up by
+	// Options.MaxSubcompactions, from 0. Each range gets a filter of its own.
+	Subcompaction int
+}
+
+// CompactionFilterFactory creates the filter of each flush and compaction.
+type CompactionFilterFactory interface {
+	// Name identifies the factory in the OPTIONS file.
+	Name() string
+	// CreateCompactionFilter returns the filter for the job described by
+	// ctx, or nil to leave the job's entries alone, for example to skip
+	// flushes.
+	CreateCompactionFilter(ctx CompactionFilterContext) CompactionFilter
+}
+
+// filterStats counts the decisions of compaction filters.
+type filterStats struct {
+	removed, changed int64
+}
+
+// filterRun applies the filter of a single job, counting what it does. A nil
+// *filterRun keeps everything.
+type filterRun struct {
+	cf     *ColumnFamily
+	filter CompactionFilter
+	filterStats
+}
+
+// newFilterRun creates the filter for a job of cf, nil if there is none.
+func (cf *ColumnFamily) newFilterRun(ctx CompactionFilterContext) *filterRun {
+	if cf.opts.CompactionFilterFactory == nil {
+		return nil
+	}
+	ctx.ColumnFamily = cf.name
+	filter := cf.opts.CompactionFilterFactory.CreateCompactionFilter(ctx)
+	if filter == nil {
+		return nil
+	}
+	return &filterRun{cf: cf, filter: filter}
+}
+
+// apply returns the entry for key as the filter wants it written. Values
+// in blob files are read for the filter, and keep their place unless changed.
+func (r *filterRun) apply(key []byte, e sstable.Entry) (sstable.Entry, error) {
+	if r == nil || (e.Type != sstable.TypeValue && e.Type != sstable.TypeBlobIndex) {
+		return e, nil
+	}
+	value := e.Value
+	if e.Type == sstable.TypeBlobIndex {
+		stored, err := r.cf.readBlob(key, e)
+		if err != nil {
+			return e, err
+		}
+		value = stored.Value
+	}
+	switch decision, newValue := r.filter.Filter(key, value); decision {
+	case FilterRemove:
+		r.removed++
+		return sstable.Entry{Type: sstable.TypeTombstone}, nil
+	case FilterChangeValue:
+		r.changed++
+		return sstable.Entry{Type: sstable.TypeValue, Value: newValue, ExpiresAt: e.ExpiresAt}, nil
+	}
+	return e, nil
+}
+
+// stats is what the filter did, zero for a nil run.
+func (r *filterRun) stats() filterStats {
+	if r == nil {
+		return filterStats{}
+	}
+	return r.filterStats
+}
+
+// recordFilter adds the decisions of a job's filter to the engine's counters.
+func (s *engineStats) recordFilter(f filterStats) {
+	s.filterRemoved.Add(f.removed)
+	s.filterChanged.Add(f.changed)
+}
@@ -0,0 +1,148 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+// tenantFilter purges the keys of a deleted tenant and upgrades v1 values to v2.
+type tenantFilter struct {
+	last []byte
+	seen int
+	// outOfOrder is set if keys ever arrive out of order
+	outOfOrder bool
+}
+
+func (f *tenantFilter) Filter(key, value []byte) (FilterDecision, []byte) {
+	if f.last != nil && bytes.Compare(key, f.last) <= 0 {
+		f.outOfOrder = true
+	}
+	f.last = append(f.last[:0], key...)
+	f.seen++
+	switch {
+	case bytes.HasPrefix(key, []byte("deleted/")):
+		return FilterRemove, nil
+	case bytes.HasPrefix(value, []byte("v1:")):
+		return FilterChangeValue, append([]byte("v2:"), value[3:]...)
+	}
+	return FilterKeep, nil
+}
+
+// tenantFilterFactory hands out tenantFilters, to flushes too if flushes is set.
+type tenantFilterFactory struct {
+	flushes bool
+	mu      sync.Mutex
+	jobs    []CompactionFilterContext
+	filters []*tenantFilter
+}
+
+func (*tenantFilterFactory) Name() string { return "tenants" }
+
+func (ff *tenantFilterFactory) CreateCompactionFilter(ctx CompactionFilterContext) CompactionFilter {
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	ff.jobs = append(ff.jobs, ctx)
+	if ctx.Flush && !ff.flushes {
+		return nil
+	}
+	f := &tenantFilter{}
+	ff.filters = append(ff.filters, f)
+	return f
+}
+
+func TestLSM_CompactionFilter(t *testing.T) {
+	ff := &tenantFilterFactory{}
+	lsm, err := New("compaction_filter_test", &Options{FS: vfs.NewMem(), MaxMemSize: 1 << 20, CompactionFilterFactory: ff})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+	flush := func() {
+		lsm.flush()
+	}
+
+	// 1. Flushes are left alone when the factory says so
+	for i := 0; i < 10; i++ {
+		lsm.Put([]byte(fmt.Sprintf("deleted/%d", i)), []byte("v1:old"))
+		lsm.Put([]byte(fmt.Sprintf("live/%d", i)), []byte("v1:old"))
+	}
+	flush()
+	lsm.Put([]byte("live/0"), []byte("v1:new"))
+	lsm.Delete([]byte("live/1"))
+	flush()
+	if len(ff.jobs) != 2 || !ff.jobs[0].Flush || len(ff.filters) != 0 {
+		t.Fatalf("Expected two flushes without filters, got %+v", ff.jobs)
+	}
+	if val, _, _ := lsm.Get([]byte("deleted/3")); string(val) != "v1:old" {
+		t.Errorf("Expected the flush to keep deleted/3, got %q", val)
+	}
+
+	// 2. Compaction purges the tenant and rewrites the rest, in key order
+	if err := lsm.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	job := ff.jobs[2]
+	if job.Flush || job.ColumnFamily != DefaultColumnFamilyName || job.Reason != CompactionManual || !job.Bottommost {
+		t.Errorf("Unexpected compaction context %+v", job)
+	}
+	f := ff.filters[0]
+	if f.seen != 19 || f.outOfOrder {
+		t.Errorf("Expected the 19 live values in order, saw %d (out of order: %v)", f.seen, f.outOfOrder)
+	}
+	for i := 0; i < 10; i++ {
+		if _, found, _ := lsm.Get([]byte(fmt.Sprintf("deleted/%d", i))); found {
+			t.Errorf("Expected deleted/%d to be purged", i)
+		}
+	}
+	if val, _, _ := lsm.Get([]byte("live/0")); string(val) != "v2:new" {
+		t.Errorf("Expected live/0 rewritten to v2:new, got %q", val)
+	}
+	if val, _, _ := lsm.Get([]byte("live/5")); string(val) != "v2:old" {
+		t.Errorf("Expected live/5 rewritten to v2:old, got %q", val)
+	}
+	if _, found, _ := lsm.Get([]byte("live/1")); found {
+		t.Error("Expected live/1 to stay deleted")
+	}
+	if tombstones, _ := lsm.defaultCF.sstTables[0].TombstoneCount(); tombstones != 0 {
+		t.Errorf("Expected removed entries to be dropped at the bottom, %d tombstones left", tombstones)
+	}
+	if s := lsm.Stats(); s.FilterRemoved != 10 || s.FilterChanged != 9 {
+		t.Errorf("Expected 10 removed and 9 changed, got %d and %d", s.FilterRemoved, s.FilterChanged)
+	}
+}
+
+func TestLSM_CompactionFilterOnFlush(t *testing.T) {
+	ff := &tenantFilterFactory{flushes: true}
+	lsm, err := New("compaction_filter_flush_test", &Options{FS: vfs.NewMem(), MaxMemSize: 1 << 20})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+	cf, err := lsm.CreateColumnFamily("tenants", ColumnFamilyOptions{CompactionFilterFactory: ff})
+	if err != nil {
+		t.Fatalf("CreateColumnFamily failed: %v", err)
+	}
+
+	// An older table still holds the key, so the removal has to shadow it
+	lsm.PutCF(cf, []byte("deleted/1"), []byte("kept by the first flush"))
+	ff.mu.Lock()
+	ff.flushes = false
+	ff.mu.Unlock()
+	lsm.flush()
+	ff.mu.Lock()
+	ff.flushes = true
+	ff.mu.Unlock()
+	lsm.PutCF(cf, []byte("deleted/1"), []byte("v1:newer"))
+	lsm.flush()
+
+	if _, found, _ := lsm.GetCF(cf, []byte("deleted/1")); found {
+		t.Error("Expected the flush to remove deleted/1 without resurrecting the older value")
+	}
+	if s := lsm.Stats(); s.FilterRemoved != 1 {
+		t.Errorf("Expected the flush to count one removal, got %d", s.FilterRemoved)
+	}
+}
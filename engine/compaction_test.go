@@ -1,15 +1,22 @@
 package engine
 
 import (
-	"os"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
 )
 
 func TestLSM_Compaction(t *testing.T) {
 	dir := "compaction_test"
-	defer os.RemoveAll(dir)
+	fs := vfs.NewMem()
 
-	lsm, _ := New(dir, 100)
+	lsm, _ := New(dir, &Options{FS: fs, MaxMemSize: 100})
 
 	// 1. Force two flushes by writing data
 	lsm.Put([]byte("a"), []byte("1"))
@@ -17,8 +24,8 @@ func TestLSM_Compaction(t *testing.T) {
 	lsm.Put([]byte("b"), []byte("2"))
 	lsm.flush()
 
-	if len(lsm.sstTables) != 2 {
-		t.Fatalf("Expected 2 SSTables, got %d", len(lsm.sstTables))
+	if len(lsm.defaultCF.sstTables) != 2 {
+		t.Fatalf("Expected 2 SSTables, got %d", len(lsm.defaultCF.sstTables))
 	}
 
 	// 2. Run Compaction
@@ -28,8 +35,8 @@ func TestLSM_Compaction(t *testing.T) {
 	}
 
 	// 3. Verify
-	if len(lsm.sstTables) != 1 {
-		t.Errorf("Expected 1 SSTable after compaction, got %d", len(lsm.sstTables))
+	if len(lsm.defaultCF.sstTables) != 1 {
+		t.Errorf("Expected 1 SSTable after compaction, got %d", len(lsm.defaultCF.sstTables))
 	}
 
 	val, _, _ := lsm.Get([]byte("a"))
@@ -37,3 +44,302 @@ func TestLSM_Compaction(t *testing.T) {
 		t.Errorf("Data lost during compaction")
 	}
 }
+
+func TestLSM_CompactionDropsTombstones(t *testing.T) {
+	dir := "compaction_tombstone_test"
+	fs := vfs.NewMem()
+
+	lsm, err := New(dir, &Options{FS: fs, MaxMemSize: 1024 * 1024})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+
+	// 1. Older table holds two live keys, newer table deletes one of them
+	lsm.Put([]byte("a"), []byte("1"))
+	lsm.Put([]byte("b"), []byte("2"))
+	lsm.flush()
+	lsm.Delete([]byte("a"))
+	lsm.flush()
+
+	// 2. Merging the two oldest tables produces the bottom-most table
+	if err := lsm.Compact(); err != nil {
+		t.Fatalf("Compaction failed: %v", err)
+	}
+
+	// 3. Verify the tombstone and the value it shadowed are both gone
+	if _, found, _ := lsm.Get([]byte("a")); found {
+		t.Error("Deleted key resurrected after compaction")
+	}
+	if val, _, _ := lsm.Get([]byte("b")); string(val) != "2" {
+		t.Errorf("Expected 2 for b, got %s", string(val))
+	}
+	lsm.mu.RLock()
+	defer lsm.mu.RUnlock()
+	if len(lsm.defaultCF.sstTables) != 1 || len(lsm.defaultCF.sstTables[0].GetIndex()) != 1 {
+		t.Errorf("Expected a single table with one entry after tombstone GC")
+	}
+
+	files, _ := fs.List(dir)
+	sstCount := 0
+	for _, name := range files {
+		if filepath.Ext(name) == ".sst" {
+			sstCount++
+		}
+	}
+	if sstCount != 1 {
+		t.Errorf("Expected compacted inputs to be removed, found %d .sst files", sstCount)
+	}
+}
+
+func TestLSM_TombstoneDensityTriggersCompaction(t *testing.T) {
+	dir := "compaction_density_test"
+	fs := vfs.NewMem()
+
+	lsm, err := New(dir, &Options{FS: fs, MaxMemSize: 1024 * 1024})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+
+	lsm.Put([]byte("a"), []byte("1"))
+	lsm.Put([]byte("b"), []byte("2"))
+	lsm.flush()
+
+	// A table made only of deletes should be picked up by the background worker
+	lsm.Delete([]byte("a"))
+	lsm.Delete([]byte("b"))
+	lsm.flush()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		lsm.mu.RLock()
+		n := len(lsm.defaultCF.sstTables)
+		lsm.mu.RUnlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected delete-dominated tables to be compacted away, %d left", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, found, _ := lsm.Get([]byte("b")); found {
+		t.Error("Deleted key resurrected after tombstone compaction")
+	}
+}
+
+func TestLSM_Subcompactions(t *testing.T) {
+	dir := "subcompaction_test"
+	fs := vfs.NewMem()
+	rec := &recordingListener{}
+	opts := &Options{FS: fs, MaxMemSize: 1 << 20, BlockSize: 64, CompactionStrategy: CompactAll, MaxSubcompactions: 4, EventListeners: []EventListener{rec}}
+	lsm, err := New(dir, opts)
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+
+	// 1. Three overlapping tables of small blocks, the newest deleting every tenth key
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 300; i++ {
+			key := []byte(fmt.Sprintf("key%03d", i))
+			if round == 2 && i%10 == 0 {
+				lsm.Delete(key)
+				continue
+			}
+			lsm.Put(key, []byte(fmt.Sprintf("value%d-%d", round, i)))
+		}
+		lsm.flush()
+	}
+	rec.take()
+
+	// 2. The compaction is split four ways into disjoint tables forming a single run
+	if err := lsm.Compact(); err != nil {
+		t.Fatalf("Compaction failed: %v", err)
+	}
+	tables := lsm.defaultCF.sstTables
+	if len(tables) != 4 || lsm.defaultCF.sortedRuns() != 1 {
+		t.Fatalf("Expected 4 tables in 1 sorted run, got %d in %d", len(tables), lsm.defaultCF.sortedRuns())
+	}
+	events, infos := rec.take()
+	var info CompactionInfo
+	created := 0
+	for i, e := range events {
+		switch e {
+		case "compaction-completed":
+			info = infos[i].(CompactionInfo)
+		case "created-compaction":
+			created++
+		}
+	}
+	if len(info.Inputs) != 3 || len(info.Outputs) != 4 || created != 4 || info.Err != nil {
+		t.Errorf("Expected 3 inputs and 4 outputs, got %+v and %d created tables", info, created)
+	}
+	if s := lsm.Stats(); s.WriteStall != WriteStallNormal || s.PendingCompactionBytes != 0 || s.CompactionBytesWritten != info.BytesWritten {
+		t.Errorf("Expected no compaction debt left, got %+v", s)
+	}
+
+	// 3. Nothing was lost or resurrected, before or after reopening
+	check := func() {
+		t.Helper()
+		for i := 0; i < 300; i++ {
+			val, found, _ := lsm.Get([]byte(fmt.Sprintf("key%03d", i)))
+			switch {
+			case i%10 == 0 && found:
+				t.Fatalf("key%03d was deleted but reads %q", i, val)
+			case i%10 != 0 && string(val) != fmt.Sprintf("value2-%d", i):
+				t.Fatalf("key%03d: expected value2-%d, got %q", i, i, val)
+			}
+		}
+	}
+	check()
+	lsm.Close()
+	if lsm, err = New(dir, opts); err != nil {
+		t.Fatalf("Failed to reopen: %v", err)
+	}
+	defer lsm.Close()
+	if len(lsm.defaultCF.sstTables) != 4 {
+		t.Errorf("Expected the 4 tables back after reopening, got %d", len(lsm.defaultCF.sstTables))
+	}
+	check()
+}
+
+func TestLSM_CompactRange(t *testing.T) {
+	fs := vfs.NewMem()
+	lsm, err := New("compact_range_test", &Options{FS: fs, MaxMemSize: 1 << 20})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+	flush := func() {
+		lsm.flush()
+	}
+
+	// 1. Two disjoint tables, then a newer one deleting keys of the oldest
+	for i := 0; i < 100; i++ {
+		lsm.Put([]byte(fmt.Sprintf("k%02d", i)), []byte("v"))
+		if i == 49 || i == 99 {
+			flush()
+		}
+	}
+	for i := 10; i < 20; i++ {
+		lsm.Delete([]byte(fmt.Sprintf("k%02d", i)))
+	}
+	flush()
+	oldest := lsm.defaultCF.sstTables[2]
+
+	// 2. Only the tables from the newest overlapping one down are merged
+	ctx := context.Background()
+	if err := lsm.CompactRange(ctx, []byte("k60"), []byte("k70"), nil); err != nil {
+		t.Fatalf("CompactRange failed: %v", err)
+	}
+	if n := len(lsm.defaultCF.sstTables); n != 2 {
+		t.Fatalf("Expected the newest table and the merged pair, got %d tables", n)
+	}
+	if _, found, _ := lsm.Get([]byte("k15")); found {
+		t.Error("Expected k15 to stay deleted")
+	}
+
+	// 3. A range that only the bottom overlaps is left alone unless forced
+	if err := lsm.CompactRange(ctx, []byte("k60"), []byte("k70"), nil); err != nil {
+		t.Fatalf("CompactRange failed: %v", err)
+	}
+	if s := lsm.Stats(); s.Compactions != 1 {
+		t.Errorf("Expected the bottom run to be left alone, got %d compactions", s.Compactions)
+	}
+	if err := lsm.CompactRange(ctx, []byte("k60"), []byte("k70"), &CompactRangeOptions{ForceBottommost: true}); err != nil {
+		t.Fatalf("CompactRange failed: %v", err)
+	}
+	if s := lsm.Stats(); s.Compactions != 2 {
+		t.Errorf("Expected a forced rewrite, got %d compactions", s.Compactions)
+	}
+
+	// 4. The MemTable is flushed first, and the whole range ends up in one table without tombstones
+	lsm.Put([]byte("k05"), []byte("new"))
+	if err := lsm.CompactRange(ctx, nil, nil, nil); err != nil {
+		t.Fatalf("CompactRange failed: %v", err)
+	}
+	if !lsm.defaultCF.memTable.IsEmpty() || len(lsm.defaultCF.sstTables) != 1 {
+		t.Fatalf("Expected everything in a single table, got %d tables", len(lsm.defaultCF.sstTables))
+	}
+	if tombstones, _ := lsm.defaultCF.sstTables[0].TombstoneCount(); tombstones != 0 {
+		t.Errorf("Expected the tombstones to be dropped, %d left", tombstones)
+	}
+	if val, _, _ := lsm.Get([]byte("k05")); string(val) != "new" {
+		t.Errorf("Expected k05 to read new, got %q", val)
+	}
+	if _, err := fs.Stat(oldest.Path()); err == nil {
+		t.Error("Expected the inputs to be removed")
+	}
+}
+
+func TestLSM_CompactRangeCancel(t *testing.T) {
+	fs := vfs.NewMem()
+	dir := "compact_range_cancel_test"
+	lsm, err := New(dir, &Options{FS: fs, MaxMemSize: 1 << 20})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+	for round := 0; round < 2; round++ {
+		lsm.Put([]byte("key"), []byte(fmt.Sprint(round)))
+		lsm.flush()
+	}
+
+	// 1. A cancelled call waiting for its turn gives up once it gets it
+	ctx, cancel := context.WithCancel(context.Background())
+	lsm.defaultCF.compactMu.Lock()
+	done := make(chan error)
+	go func() { done <- lsm.CompactRange(ctx, nil, nil, nil) }()
+	cancel()
+	lsm.defaultCF.compactMu.Unlock()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	// 2. A cancelled merge leaves the tables as they were and no output behind
+	lsm.defaultCF.compactMu.Lock()
+	err = lsm.compactRange(ctx, lsm.defaultCF, lsm.defaultCF.sstTables, CompactionManual)
+	lsm.defaultCF.compactMu.Unlock()
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if n := len(lsm.defaultCF.sstTables); n != 2 {
+		t.Errorf("Expected both tables to stay, got %d", n)
+	}
+	names, _ := fs.List(dir)
+	for _, name := range names {
+		if strings.HasPrefix(name, "compacted_") {
+			t.Errorf("Cancelled compaction left %s behind", name)
+		}
+	}
+}
+
+func TestLSM_CompactRangeExclusive(t *testing.T) {
+	lsm, err := New("compact_range_exclusive_test", &Options{FS: vfs.NewMem(), MaxMemSize: 1 << 20})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+	lsm.Put([]byte("key"), []byte("value"))
+
+	// Background compaction of another family holds compactMu meanwhile
+	lsm.compactMu.Lock()
+	if err := lsm.CompactRange(context.Background(), nil, nil, nil); err != nil {
+		t.Fatalf("Non-exclusive CompactRange failed: %v", err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- lsm.CompactRange(context.Background(), nil, nil, &CompactRangeOptions{Exclusive: true})
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("Expected the exclusive CompactRange to wait, it returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	lsm.compactMu.Unlock()
+	if err := <-done; err != nil {
+		t.Fatalf("Exclusive CompactRange failed: %v", err)
+	}
+}
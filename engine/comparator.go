@@ -0,0 +1,30 @@
+package engine
+
+import (
+	"bytes"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/sstable"
+)
+
+// Comparator defines the order of keys across the MemTable, SSTables and
+// compaction. Its Name is recorded in every SSTable, and a directory can only
+// be reopened with a comparator of the same name.
+type Comparator interface {
+	Compare(a, b []byte) int
+	Name() string
+}
+
+// ErrComparatorMismatch is returned when opening a directory whose tables were
+// written with a different comparator.
+var ErrComparatorMismatch = sstable.ErrComparatorMismatch
+
+// BytewiseComparator orders keys lexicographically by byte. It is the default.
+var BytewiseComparator Comparator = sstable.BytewiseComparator
+
+type reverseBytewiseComparator struct{}
+
+func (reverseBytewiseComparator) Compare(a, b []byte) int { return bytes.Compare(b, a) }
+func (reverseBytewiseComparator) Name() string            { return "reverse-bytewise" }
+
+// ReverseBytewiseComparator orders keys by byte, largest first.
+var ReverseBytewiseComparator Comparator = reverseBytewiseComparator{}
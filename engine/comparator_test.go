@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+// numericComparator orders decimal keys by their integer value.
+type numericComparator struct{}
+
+func (numericComparator) Compare(a, b []byte) int {
+	x, _ := strconv.Atoi(string(a))
+	y, _ := strconv.Atoi(string(b))
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func (numericComparator) Name() string { return "numeric" }
+
+func TestLSM_CustomComparator(t *testing.T) {
+	dir := "comparator_test"
+	fs := vfs.NewMem()
+
+	lsm, err := New(dir, &Options{FS: fs, MaxMemSize: 1024 * 1024, Comparator: numericComparator{}})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+
+	// 1. Spread keys over two tables so compaction has to merge them
+	lsm.Put([]byte("100"), []byte("c"))
+	lsm.Put([]byte("9"), []byte("b"))
+	lsm.flush()
+	lsm.Put([]byte("10"), []byte("x"))
+	lsm.Put([]byte("2"), []byte("a"))
+	lsm.flush()
+	if err := lsm.Compact(); err != nil {
+		t.Fatalf("Compaction failed: %v", err)
+	}
+
+	// 2. Lookups binary search in numeric order
+	if val, found, _ := lsm.Get([]byte("10")); !found || string(val) != "x" {
+		t.Errorf("Expected x for 10, got %s", string(val))
+	}
+
+	it, err := lsm.NewIterator()
+	if err != nil {
+		t.Fatalf("Failed to create iterator: %v", err)
+	}
+	defer it.Close()
+	var keys []string
+	for it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+	want := []string{"2", "9", "10", "100"}
+	if len(keys) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, keys)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, keys)
+		}
+	}
+	lsm.Close()
+
+	// 3. Reopening with another comparator is rejected
+	if _, err := New(dir, &Options{FS: fs, MaxMemSize: 1024 * 1024}); !errors.Is(err, ErrComparatorMismatch) {
+		t.Errorf("Expected ErrComparatorMismatch, got %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+// discardLogger swallows the errors a crashed engine's background work runs into.
+type discardLogger struct{}
+
+func (discardLogger) Printf(string, ...any) {}
+
+// crash simulates a power loss under lsm and reopens the database on what survived.
+func crash(t *testing.T, lsm *LSM, fs *vfs.FaultFS, dir string) (*LSM, *vfs.FaultFS) {
+	t.Helper()
+	after, err := fs.Crash()
+	if err != nil {
+		t.Fatalf("Crash failed: %v", err)
+	}
+	// Only stops the old engine's goroutines; its files are already gone
+	lsm.Close()
+	reopened, err := New(dir, &Options{FS: after, MaxMemSize: 512, Logger: discardLogger{}})
+	if err != nil {
+		t.Fatalf("Failed to reopen after crash: %v", err)
+	}
+	return reopened, after
+}
+
+func TestLSM_CrashRecovery(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		t.Run(fmt.Sprintf("seed=%d", seed), func(t *testing.T) {
+			runCrashTest(t, seed)
+		})
+	}
+}
+
+// runCrashTest runs random writes, flushes and compactions, some of them hit
+// by injected faults, and crashes every so often. Every acknowledged write
+// must survive each crash; a write that failed may or may not, but nothing
+// else may show up.
+func runCrashTest(t *testing.T, seed int64) {
+	dir := "crash_test"
+	rng := rand.New(rand.NewSource(seed))
+	fs := vfs.NewFaultFS(vfs.NewMem(), seed)
+	fs.SetTornWrites(seed%2 == 0)
+
+	lsm, err := New(dir, &Options{FS: fs, MaxMemSize: 512, Logger: discardLogger{}})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+
+	// acked holds what every key must read after a crash; failed holds, per
+	// key, what the writes that failed since the last acknowledged one wrote
+	// (nil for a delete)
+	acked := make(map[string]string)
+	failed := make(map[string][]*string)
+
+	for round := 0; round < 10; round++ {
+		for i := 0; i < 100; i++ {
+			if rng.Intn(40) == 0 {
+				fs.FailAfter(vfs.Op(rng.Intn(int(vfs.OpRemove)+1)), rng.Intn(5))
+			}
+
+			key := fmt.Sprintf("key%02d", rng.Intn(40))
+			switch r := rng.Intn(100); {
+			case r < 70:
+				value := fmt.Sprintf("value-%d-%d", round, i)
+				if err := lsm.Put([]byte(key), []byte(value)); err != nil {
+					failed[key] = append(failed[key], &value)
+				} else {
+					acked[key] = value
+					delete(failed, key)
+				}
+			case r < 90:
+				if err := lsm.Delete([]byte(key)); err != nil {
+					failed[key] = append(failed[key], nil)
+				} else {
+					delete(acked, key)
+					delete(failed, key)
+				}
+			case r < 95:
+				// Neither a flush nor a compaction changes what keys read, so
+				// their errors only matter through what the crash leaves behind
+				lsm.flush()
+			default:
+				lsm.Compact()
+			}
+		}
+
+		lsm, fs = crash(t, lsm, fs, dir)
+
+		for k := 0; k < 40; k++ {
+			key := fmt.Sprintf("key%02d", k)
+			val, found, err := lsm.Get([]byte(key))
+			if err != nil {
+				t.Fatalf("Round %d: Get(%s) failed: %v", round, key, err)
+			}
+			want, wantFound := acked[key]
+			ok := found == wantFound && (!found || string(val) == want)
+			for _, v := range failed[key] {
+				ok = ok || (v == nil && !found) || (v != nil && found && string(val) == *v)
+			}
+			if !ok {
+				t.Fatalf("Round %d: %s = %q (found %v), expected %q (found %v) or one of %d failed writes",
+					round, key, val, found, want, wantFound, len(failed[key]))
+			}
+
+			// Whatever survived is what later rounds build on
+			if found {
+				acked[key] = string(val)
+			} else {
+				delete(acked, key)
+			}
+		}
+		failed = make(map[string][]*string)
+	}
+	lsm.Close()
+}
+
+func TestLSM_CrashDropsUnacknowledgedWrites(t *testing.T) {
+	dir := "crash_unacked_test"
+	fs := vfs.NewFaultFS(vfs.NewMem(), 1)
+	fs.SetTornWrites(true)
+
+	lsm, err := New(dir, &Options{FS: fs, MaxMemSize: 512, Logger: discardLogger{}})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	lsm.Put([]byte("a"), []byte("1"))
+
+	// A write whose WAL sync fails is not acknowledged, and the engine stops
+	// taking writes: a later successful sync would make it durable
+	fs.FailAfter(vfs.OpSync, 0)
+	if err := lsm.Put([]byte("b"), []byte("2")); !errors.Is(err, vfs.ErrInjected) {
+		t.Fatalf("Expected the injected sync failure, got %v", err)
+	}
+	fs.ClearFaults()
+	if err := lsm.Put([]byte("c"), []byte("3")); err == nil {
+		t.Fatal("Expected writes to stay disabled after a WAL failure")
+	}
+	if err := lsm.BackgroundError(); !errors.Is(err, vfs.ErrInjected) {
+		t.Errorf("Expected BackgroundError to report the WAL failure, got %v", err)
+	}
+
+	lsm, _ = crash(t, lsm, fs, dir)
+	defer lsm.Close()
+
+	if val, found, _ := lsm.Get([]byte("a")); !found || string(val) != "1" {
+		t.Errorf("Expected acknowledged 'a' to survive, got %q (found %v)", val, found)
+	}
+	for _, key := range []string{"b", "c"} {
+		if _, found, _ := lsm.Get([]byte(key)); found {
+			t.Errorf("Unacknowledged write %q survived the crash", key)
+		}
+	}
+	if err := lsm.Put([]byte("d"), []byte("4")); err != nil {
+		t.Errorf("Expected writes to work again after reopening, got %v", err)
+	}
+}
@@ -0,0 +1,288 @@
+// Package dump reads and writes the portable export format of the engine: a
+// stream of column families and their keys and values that does not depend
+// on how the data was laid out on disk, so it survives changes to the table
+// and WAL formats and moves between environments.
+//
+// A dump starts with the 8-byte magic "LSM-DUMP" and a version, as
+// [Version(4)]. Records follow, each framed as
+// [Kind(1)][PayloadLen(4)][CRC32(4)][Payload], the checksum covering the kind
+// and the payload. A family record opens a column family, and the entry
+// records after it belong to it. The dump ends with a trailer record that
+// counts what came before, so a truncated dump is told apart from a short one.
+// The whole stream may be gzip-compressed; readers detect that themselves.
+package dump
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Version is the version of the format Writer produces. Readers accept
+// every version up to it.
+const Version = 1
+
+// magic opens every dump.
+const magic = "LSM-DUMP"
+
+// frameHeaderSize is [Kind(1)][PayloadLen(4)][CRC32(4)]
+const frameHeaderSize = 9
+
+// entryHeaderSize is [KeyLen(4)][ValueLen(4)][ExpiresAt(8)]
+const entryHeaderSize = 16
+
+var (
+	// ErrCorrupt is returned for a dump that fails a checksum, is cut
+	// short, or does not follow the format.
+	ErrCorrupt = errors.New("dump: corrupt")
+	// ErrVersion is returned for a dump written by a newer version of the format.
+	ErrVersion = errors.New("dump: unsupported version")
+)
+
+// Kind says what a record holds.
+type Kind byte
+
+const (
+	// KindFamily opens a column family.
+	KindFamily Kind = 'F'
+	// KindEntry is a key and its value.
+	KindEntry Kind = 'K'
+	// kindTrailer ends the dump.
+	kindTrailer Kind = 'E'
+)
+
+// Family describes a column family, by name and the name of its comparator.
+// The comparator is empty in dumps converted from formats that do not record it.
+type Family struct {
+	Name       string
+	Comparator string
+}
+
+// Entry is a key with its value.
+type Entry struct {
+	Key   []byte
+	Value []byte
+	// ExpiresAt is a unix timestamp in nanoseconds, 0 means the entry never expires.
+	ExpiresAt int64
+}
+
+// Record is an item of a dump: Family for KindFamily, Entry for KindEntry.
+type Record struct {
+	Kind   Kind
+	Family Family
+	Entry  Entry
+}
+
+// WriterOptions configures a Writer.
+type WriterOptions struct {
+	// Gzip compresses the dump.
+	Gzip bool
+}
+
+// Writer writes a dump. Entries must follow the family they belong to.
+type Writer struct {
+	w        io.Writer
+	gz       *gzip.Writer
+	families uint32
+	entries  uint64
+	inFamily bool
+	buf      []byte
+}
+
+// NewWriter starts a dump on w.
+func NewWriter(w io.Writer, opts WriterOptions) (*Writer, error) {
+	dw := &Writer{w: w}
+	if opts.Gzip {
+		dw.gz = gzip.NewWriter(w)
+		dw.w = dw.gz
+	}
+	header := binary.LittleEndian.AppendUint32([]byte(magic), Version)
+	if _, err := dw.w.Write(header); err != nil {
+		return nil, err
+	}
+	return dw, nil
+}
+
+// StartFamily opens the column family the following entries belong to.
+func (w *Writer) StartFamily(f Family) error {
+	payload := binary.LittleEndian.AppendUint32(nil, uint32(len(f.Name)))
+	payload = append(payload, f.Name...)
+	payload = binary.LittleEndian.AppendUint32(payload, uint32(len(f.Comparator)))
+	payload = append(payload, f.Comparator...)
+	w.families++
+	w.inFamily = true
+	return w.writeRecord(KindFamily, payload)
+}
+
+// Add writes an entry of the current family.
+func (w *Writer) Add(e Entry) error {
+	if !w.inFamily {
+		return errors.New("dump: entry before any family")
+	}
+	payload := w.buf[:0]
+	payload = binary.LittleEndian.AppendUint32(payload, uint32(len(e.Key)))
+	payload = binary.LittleEndian.AppendUint32(payload, uint32(len(e.Value)))
+	payload = binary.LittleEndian.AppendUint64(payload, uint64(e.ExpiresAt))
+	payload = append(append(payload, e.Key...), e.Value...)
+	w.buf = payload
+	w.entries++
+	return w.writeRecord(KindEntry, payload)
+}
+
+// Close writes the trailer and flushes any compression. It does not close
+// the underlying writer.
+func (w *Writer) Close() error {
+	payload := binary.LittleEndian.AppendUint32(nil, w.families)
+	payload = binary.LittleEndian.AppendUint64(payload, w.entries)
+	if err := w.writeRecord(kindTrailer, payload); err != nil {
+		return err
+	}
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+	return nil
+}
+
+func (w *Writer) writeRecord(kind Kind, payload []byte) error {
+	frame := make([]byte, frameHeaderSize, frameHeaderSize+len(payload))
+	frame[0] = byte(kind)
+	binary.LittleEndian.PutUint32(frame[1:5], uint32(len(payload)))
+	crc := crc32.Update(crc32.ChecksumIEEE(frame[:1]), crc32.IEEETable, payload)
+	binary.LittleEndian.PutUint32(frame[5:9], crc)
+	_, err := w.w.Write(append(frame, payload...))
+	return err
+}
+
+// Reader reads a dump record by record.
+type Reader struct {
+	r        *bufio.Reader
+	version  uint32
+	families uint32
+	entries  uint64
+	done     bool
+}
+
+// NewReader reads the header of the dump on r, decompressing it if needed.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	if peek, err := br.Peek(2); err == nil && peek[0] == 0x1f && peek[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		br = bufio.NewReader(gz)
+	}
+	header := make([]byte, len(magic)+4)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("%w: no header: %v", ErrCorrupt, err)
+	}
+	if !bytes.Equal(header[:len(magic)], []byte(magic)) {
+		return nil, fmt.Errorf("%w: not a dump", ErrCorrupt)
+	}
+	version := binary.LittleEndian.Uint32(header[len(magic):])
+	if version == 0 || version > Version {
+		return nil, fmt.Errorf("%w: %d, expected at most %d", ErrVersion, version, Version)
+	}
+	return &Reader{r: br, version: version}, nil
+}
+
+// Version is the version of the format the dump was written in.
+func (r *Reader) Version() uint32 {
+	return r.version
+}
+
+// Next returns the next record, and io.EOF once the trailer has confirmed
+// that the whole dump was read.
+func (r *Reader) Next() (Record, error) {
+	if r.done {
+		return Record{}, io.EOF
+	}
+	header := make([]byte, frameHeaderSize)
+	if _, err := io.ReadFull(r.r, header); err != nil {
+		return Record{}, fmt.Errorf("%w: cut short before the trailer: %v", ErrCorrupt, err)
+	}
+	kind := Kind(header[0])
+	payload, err := readPayload(r.r, int64(binary.LittleEndian.Uint32(header[1:5])))
+	if err != nil {
+		return Record{}, fmt.Errorf("%w: cut short inside a record: %v", ErrCorrupt, err)
+	}
+	crc := crc32.Update(crc32.ChecksumIEEE(header[:1]), crc32.IEEETable, payload)
+	if crc != binary.LittleEndian.Uint32(header[5:9]) {
+		return Record{}, fmt.Errorf("%w: checksum mismatch", ErrCorrupt)
+	}
+
+	switch kind {
+	case KindFamily:
+		name, rest, ok := cutField(payload)
+		cmp, rest, ok2 := cutField(rest)
+		if !ok || !ok2 || len(rest) != 0 {
+			return Record{}, fmt.Errorf("%w: bad family record", ErrCorrupt)
+		}
+		r.families++
+		return Record{Kind: KindFamily, Family: Family{Name: string(name), Comparator: string(cmp)}}, nil
+	case KindEntry:
+		if r.families == 0 || len(payload) < entryHeaderSize {
+			return Record{}, fmt.Errorf("%w: bad entry record", ErrCorrupt)
+		}
+		keyLen := uint64(binary.LittleEndian.Uint32(payload[0:4]))
+		valueLen := uint64(binary.LittleEndian.Uint32(payload[4:8]))
+		if entryHeaderSize+keyLen+valueLen != uint64(len(payload)) {
+			return Record{}, fmt.Errorf("%w: bad entry record", ErrCorrupt)
+		}
+		r.entries++
+		return Record{Kind: KindEntry, Entry: Entry{
+			Key:       payload[entryHeaderSize : entryHeaderSize+keyLen],
+			Value:     payload[entryHeaderSize+keyLen:],
+			ExpiresAt: int64(binary.LittleEndian.Uint64(payload[8:16])),
+		}}, nil
+	case kindTrailer:
+		if len(payload) != 12 {
+			return Record{}, fmt.Errorf("%w: bad trailer", ErrCorrupt)
+		}
+		families, entries := binary.LittleEndian.Uint32(payload[0:4]), binary.LittleEndian.Uint64(payload[4:12])
+		if families != r.families || entries != r.entries {
+			return Record{}, fmt.Errorf("%w: trailer counts %d families and %d entries, read %d and %d",
+				ErrCorrupt, families, entries, r.families, r.entries)
+		}
+		r.done = true
+		return Record{}, io.EOF
+	default:
+		return Record{}, fmt.Errorf("%w: unknown record kind %q", ErrCorrupt, kind)
+	}
+}
+
+// maxPayloadPrealloc is the most readPayload allocates up front. The length
+// comes from the stream before the checksum can vouch for it.
+const maxPayloadPrealloc = 64 << 10
+
+// readPayload reads the n bytes of a record's payload. Past
+// maxPayloadPrealloc the buffer grows as the bytes arrive, so a garbage
+// length in a short stream cannot make it allocate gigabytes.
+func readPayload(r io.Reader, n int64) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(int(min(n, maxPayloadPrealloc)))
+	if _, err := io.CopyN(&buf, r, n); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// cutField splits a [Len(4)][Bytes] field off the front of buf.
+func cutField(buf []byte) (field, rest []byte, ok bool) {
+	if len(buf) < 4 {
+		return nil, nil, false
+	}
+	n := uint64(binary.LittleEndian.Uint32(buf))
+	if uint64(len(buf)-4) < n {
+		return nil, nil, false
+	}
+	return buf[4 : 4+n], buf[4+n:], true
+}
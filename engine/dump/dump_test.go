@@ -0,0 +1,98 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// writeDump produces a dump of two families, the second with n entries.
+func writeDump(t *testing.T, gzip bool, n int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, WriterOptions{Gzip: gzip})
+	if err != nil {
+		t.Fatalf("NewWriter failed: %v", err)
+	}
+	w.StartFamily(Family{Name: "default", Comparator: "bytewise"})
+	w.StartFamily(Family{Name: "users", Comparator: "reverse-bytewise"})
+	for i := 0; i < n; i++ {
+		if err := w.Add(Entry{Key: []byte(fmt.Sprintf("key%d", i)), Value: []byte("value"), ExpiresAt: int64(i)}); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// readDump reads every record of data.
+func readDump(data []byte) ([]Record, error) {
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, rec)
+	}
+}
+
+func TestDump_RoundTrip(t *testing.T) {
+	for _, gzip := range []bool{false, true} {
+		records, err := readDump(writeDump(t, gzip, 100))
+		if err != nil {
+			t.Fatalf("gzip=%v: read failed: %v", gzip, err)
+		}
+		if len(records) != 102 || records[1].Family != (Family{Name: "users", Comparator: "reverse-bytewise"}) {
+			t.Fatalf("gzip=%v: unexpected records %+v", gzip, records[:2])
+		}
+		e := records[101].Entry
+		if records[101].Kind != KindEntry || string(e.Key) != "key99" || string(e.Value) != "value" || e.ExpiresAt != 99 {
+			t.Errorf("gzip=%v: unexpected last entry %+v", gzip, records[101])
+		}
+	}
+}
+
+func TestDump_Corruption(t *testing.T) {
+	data := writeDump(t, false, 10)
+
+	// A flipped byte fails its record's checksum
+	flipped := append([]byte(nil), data...)
+	flipped[len(flipped)/2] ^= 0xff
+	if _, err := readDump(flipped); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for a flipped byte, got %v", err)
+	}
+	// A dump cut short at a record boundary is missing its trailer
+	for _, cut := range []int{len(data) - 1, len(data) - 21, 12} {
+		if _, err := readDump(data[:cut]); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("Expected ErrCorrupt for a dump cut at %d, got %v", cut, err)
+		}
+	}
+	// A garbage length is caught by the stream running out, not by
+	// allocating what it claims
+	huge := append(append([]byte(nil), data[:len(magic)+4]...), byte(KindEntry), 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 1, 2, 3)
+	if _, err := readDump(huge); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for a record claiming 4 GiB, got %v", err)
+	}
+	// Newer versions are refused rather than misread
+	newer := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(newer[len(magic):], Version+1)
+	if _, err := NewReader(bytes.NewReader(newer)); !errors.Is(err, ErrVersion) {
+		t.Errorf("Expected ErrVersion, got %v", err)
+	}
+	if _, err := NewReader(bytes.NewReader([]byte("not a dump at all"))); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for something else, got %v", err)
+	}
+}
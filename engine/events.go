@@ -0,0 +1,279 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// EventListener is told about the engine's flushes, compactions and table
+// files, for monitoring and auditing. Register listeners through
+// Options.EventListeners; embed BaseEventListener to implement only the
+// callbacks of interest.
+//
+// Callbacks run after the engine has released its lock, in the order the
+// events happened, one at a time. They may read and write the database, but
+// must not call Compact: a compaction's callbacks can run while it still
+// holds the right to compact. Work that happens under the lock, such as a
+// flush triggered by a Put, is reported once the lock is released, so
+// OnFlushBegin arrives together with OnFlushCompleted.
+type EventListener interface {
+	// OnFlushBegin and OnFlushCompleted bracket a flush of the MemTables.
+	OnFlushBegin(FlushInfo)
+	OnFlushCompleted(FlushInfo)
+	// OnCompactionBegin and OnCompactionCompleted bracket a compaction.
+	OnCompactionBegin(CompactionInfo)
+	OnCompactionCompleted(CompactionInfo)
+	// OnTableFileCreated reports an SSTable that became live, and
+	// OnTableFileDeleted one that was removed from the directory.
+	OnTableFileCreated(TableFileInfo)
+	OnTableFileDeleted(TableFileInfo)
+	// OnWriteStall reports writes starting or stopping to be held back,
+	// see Options.L0SlowdownWritesTrigger.
+	OnWriteStall(WriteStallInfo)
+	// OnBackgroundError reports a failure no caller saw returned, or one
+	// that disabled writes, see LSM.BackgroundError.
+	OnBackgroundError(BackgroundErrorInfo)
+}
+
+// BaseEventListener implements every EventListener callback as a no-op.
+type BaseEventListener struct{}
+
+func (BaseEventListener) OnFlushBegin(FlushInfo)                {}
+func (BaseEventListener) OnFlushCompleted(FlushInfo)            {}
+func (BaseEventListener) OnCompactionBegin(CompactionInfo)      {}
+func (BaseEventListener) OnCompactionCompleted(CompactionInfo)  {}
+func (BaseEventListener) OnTableFileCreated(TableFileInfo)      {}
+func (BaseEventListener) OnTableFileDeleted(TableFileInfo)      {}
+func (BaseEventListener) OnWriteStall(WriteStallInfo)           {}
+func (BaseEventListener) OnBackgroundError(BackgroundErrorInfo) {}
+
+// FlushInfo describes a flush. The MemTables of every family are flushed together.
+type FlushInfo struct {
+	// ColumnFamilies names the families whose MemTables are flushed.
+	ColumnFamilies []string
+	// Outputs are the paths of the tables written, and Bytes their total size.
+	Outputs []string
+	Bytes   int64
+	// Duration is how long the flush took, and Err why it failed. Both are
+	// only set on completion.
+	Duration time.Duration
+	Err      error
+}
+
+// CompactionReason says why a compaction ran.
+type CompactionReason int
+
+const (
+	// CompactionManual is a compaction asked for through Compact, CompactCF
+	// or CompactRange.
+	CompactionManual CompactionReason = iota
+	// CompactionTombstones is a background compaction of a table dominated by deletes.
+	CompactionTombstones
+	// CompactionWriteStall is a background compaction of a column family
+	// over the write stall limits.
+	CompactionWriteStall
+	// CompactionBlobGarbage is a background compaction moving the live
+	// values out of blob files that are mostly garbage.
+	CompactionBlobGarbage
+)
+
+func (r CompactionReason) String() string {
+	switch r {
+	case CompactionManual:
+		return "manual"
+	case CompactionTombstones:
+		return "tombstones"
+	case CompactionWriteStall:
+		return "write-stall"
+	case CompactionBlobGarbage:
+		return "blob-garbage"
+	default:
+		return fmt.Sprintf("CompactionReason(%d)", int(r))
+	}
+}
+
+// CompactionInfo describes a compaction of one column family.
+type CompactionInfo struct {
+	ColumnFamily string
+	Reason       CompactionReason
+	// Inputs are the paths of the tables merged, newest first, and
+	// BytesRead their total size.
+	Inputs    []string
+	BytesRead int64
+	// Outputs are the paths of the tables written, and BytesWritten their
+	// total size. Only set on completion; there is no output when every
+	// entry was dropped.
+	Outputs      []string
+	BytesWritten int64
+	// Duration is how long the compaction took, and Err why it failed. Both
+	// are only set on completion.
+	Duration time.Duration
+	Err      error
+}
+
+// TableFileReason says why an SSTable was created or deleted.
+type TableFileReason int
+
+const (
+	// TableFlush is a table written by a flush.
+	TableFlush TableFileReason = iota
+	// TableCompaction is a table written or replaced by a compaction.
+	TableCompaction
+	// TableDropped is a table of a dropped column family.
+	TableDropped
+	// TableObsolete is a table found at open that the manifest does not
+	// reference, left behind by an interrupted flush or compaction.
+	TableObsolete
+	// TableIngested is a table added by IngestExternalFile.
+	TableIngested
+)
+
+func (r TableFileReason) String() string {
+	switch r {
+	case TableFlush:
+		return "flush"
+	case TableCompaction:
+		return "compaction"
+	case TableDropped:
+		return "dropped"
+	case TableObsolete:
+		return "obsolete"
+	case TableIngested:
+		return "ingested"
+	default:
+		return fmt.Sprintf("TableFileReason(%d)", int(r))
+	}
+}
+
+// TableFileInfo describes an SSTable file.
+type TableFileInfo struct {
+	ColumnFamily string
+	Path         string
+	// Size is the size of the file, 0 when it was deleted without being opened.
+	Size   int64
+	Reason TableFileReason
+}
+
+// WriteStallCondition is how much writes are being held back.
+type WriteStallCondition int
+
+const (
+	// WriteStallNormal lets writes through unhindered.
+	WriteStallNormal WriteStallCondition = iota
+	// WriteStallDelayed slows writes down.
+	WriteStallDelayed
+	// WriteStallStopped blocks writes until background work catches up.
+	WriteStallStopped
+)
+
+func (c WriteStallCondition) String() string {
+	switch c {
+	case WriteStallNormal:
+		return "normal"
+	case WriteStallDelayed:
+		return "delayed"
+	case WriteStallStopped:
+		return "stopped"
+	default:
+		return fmt.Sprintf("WriteStallCondition(%d)", int(c))
+	}
+}
+
+// WriteStallInfo describes a change in how much writes are held back.
+type WriteStallInfo struct {
+	Condition WriteStallCondition
+	Previous  WriteStallCondition
+	// Cause is the limit behind Condition, StallNone once writes flow freely again.
+	Cause WriteStallCause
+}
+
+// BackgroundErrorReason says which work failed.
+type BackgroundErrorReason int
+
+const (
+	// ErrorDuringWrite is a WAL failure that disabled writes.
+	ErrorDuringWrite BackgroundErrorReason = iota
+	// ErrorDuringFlush is a WAL that could not be synced when its
+	// MemTables were frozen for a flush, which also disables writes.
+	ErrorDuringFlush
+	// ErrorDuringCompaction is a failed background compaction. Writes go on.
+	ErrorDuringCompaction
+)
+
+func (r BackgroundErrorReason) String() string {
+	switch r {
+	case ErrorDuringWrite:
+		return "write"
+	case ErrorDuringFlush:
+		return "flush"
+	case ErrorDuringCompaction:
+		return "compaction"
+	default:
+		return fmt.Sprintf("BackgroundErrorReason(%d)", int(r))
+	}
+}
+
+// BackgroundErrorInfo describes a background failure.
+type BackgroundErrorInfo struct {
+	Reason BackgroundErrorReason
+	Err    error
+}
+
+// eventQueue holds the events that happened under the engine's lock until
+// they can be delivered without it.
+type eventQueue struct {
+	listeners []EventListener
+	mu        sync.Mutex
+	pending   []func(EventListener)
+	// delivering is held by the goroutine calling listeners, so callbacks
+	// never overlap and stay in order
+	delivering sync.Mutex
+}
+
+// push queues an event for every listener.
+func (q *eventQueue) push(fn func(EventListener)) {
+	if len(q.listeners) == 0 {
+		return
+	}
+	q.mu.Lock()
+	q.pending = append(q.pending, fn)
+	q.mu.Unlock()
+}
+
+// deliver calls the listeners for every queued event. If another goroutine
+// is already delivering, including a listener that wrote to the database
+// from a callback, that goroutine delivers these events too.
+func (q *eventQueue) deliver() {
+	if len(q.listeners) == 0 {
+		return
+	}
+	for {
+		if !q.delivering.TryLock() {
+			return
+		}
+		for {
+			q.mu.Lock()
+			events := q.pending
+			q.pending = nil
+			q.mu.Unlock()
+			if len(events) == 0 {
+				break
+			}
+			for _, fn := range events {
+				for _, el := range q.listeners {
+					fn(el)
+				}
+			}
+		}
+		q.delivering.Unlock()
+		// An event pushed after the last check but before the unlock would
+		// otherwise wait for the next delivery
+		q.mu.Lock()
+		more := len(q.pending) > 0
+		q.mu.Unlock()
+		if !more {
+			return
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+// recordingListener logs every event as one line, and reads the database
+// from inside the callbacks to prove the engine's lock is not held.
+type recordingListener struct {
+	BaseEventListener
+	db     *LSM
+	mu     sync.Mutex
+	events []string
+	infos  []any
+}
+
+func (r *recordingListener) record(event string, info any) {
+	if r.db != nil {
+		r.db.Get([]byte("probe"))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	r.infos = append(r.infos, info)
+}
+
+func (r *recordingListener) OnFlushBegin(i FlushInfo)           { r.record("flush-begin", i) }
+func (r *recordingListener) OnFlushCompleted(i FlushInfo)       { r.record("flush-completed", i) }
+func (r *recordingListener) OnCompactionBegin(i CompactionInfo) { r.record("compaction-begin", i) }
+func (r *recordingListener) OnCompactionCompleted(i CompactionInfo) {
+	r.record("compaction-completed", i)
+}
+func (r *recordingListener) OnTableFileCreated(i TableFileInfo) {
+	r.record("created-"+i.Reason.String(), i)
+}
+func (r *recordingListener) OnTableFileDeleted(i TableFileInfo) {
+	r.record("deleted-"+i.Reason.String(), i)
+}
+func (r *recordingListener) OnWriteStall(i WriteStallInfo) {
+	r.record("stall-"+i.Condition.String(), i)
+}
+func (r *recordingListener) OnBackgroundError(i BackgroundErrorInfo) {
+	r.record("error-"+i.Reason.String(), i)
+}
+
+// take returns the events recorded so far and forgets them.
+func (r *recordingListener) take() ([]string, []any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events, infos := r.events, r.infos
+	r.events, r.infos = nil, nil
+	return events, infos
+}
+
+func TestLSM_EventListener(t *testing.T) {
+	fs := vfs.NewMem()
+	rec := &recordingListener{}
+	lsm, err := New("events_test", &Options{FS: fs, MaxMemSize: 256, CompactionStrategy: CompactAll, EventListeners: []EventListener{rec}})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+	rec.db = lsm
+
+	// 1. Every flush is bracketed and announces the table it wrote
+	for i := 0; i < 100; i++ {
+		if err := lsm.Put([]byte(fmt.Sprintf("key%03d", i)), []byte("value")); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	events, infos := rec.take()
+	var tables []string
+	for i := 0; i+2 < len(events); i += 3 {
+		if events[i] != "flush-begin" || events[i+1] != "created-flush" || events[i+2] != "flush-completed" {
+			t.Fatalf("Expected flush-begin, created-flush, flush-completed, got %v", events[i:i+3])
+		}
+		created := infos[i+1].(TableFileInfo)
+		done := infos[i+2].(FlushInfo)
+		if done.Err != nil || len(done.Outputs) != 1 || done.Outputs[0] != created.Path || done.Bytes != created.Size {
+			t.Errorf("Flush info %+v does not match the table created, %+v", done, created)
+		}
+		tables = append([]string{created.Path}, tables...)
+	}
+	if len(tables) < 2 || len(events) != 3*len(tables) {
+		t.Fatalf("Expected several complete flushes, got %v", events)
+	}
+
+	// 2. A compaction names its inputs, and the tables it created and deleted
+	if err := lsm.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	events, infos = rec.take()
+	want := []string{"compaction-begin", "created-compaction"}
+	for range tables {
+		want = append(want, "deleted-compaction")
+	}
+	want = append(want, "compaction-completed")
+	if strings.Join(events, ",") != strings.Join(want, ",") {
+		t.Fatalf("Expected %v, got %v", want, events)
+	}
+	begin := infos[0].(CompactionInfo)
+	done := infos[len(infos)-1].(CompactionInfo)
+	if strings.Join(begin.Inputs, ",") != strings.Join(tables, ",") || begin.Reason != CompactionManual {
+		t.Errorf("Expected a manual compaction of %v, got %+v", tables, begin)
+	}
+	created := infos[1].(TableFileInfo)
+	if done.Err != nil || len(done.Outputs) != 1 || done.Outputs[0] != created.Path ||
+		done.BytesWritten != created.Size || done.BytesRead != begin.BytesRead || done.Duration <= 0 {
+		t.Errorf("Unexpected completion %+v", done)
+	}
+	for i, path := range tables {
+		if deleted := infos[2+i].(TableFileInfo); deleted.Path != path {
+			t.Errorf("Expected %s to be deleted, got %s", path, deleted.Path)
+		}
+	}
+
+	// 3. Dropping a family deletes its tables
+	cf, _ := lsm.CreateColumnFamily("doomed", ColumnFamilyOptions{})
+	lsm.PutCF(cf, []byte("k"), []byte("v"))
+	lsm.flush()
+	lsm.events.deliver()
+	rec.take()
+	if err := lsm.DropColumnFamily(cf); err != nil {
+		t.Fatalf("DropColumnFamily failed: %v", err)
+	}
+	if events, infos := rec.take(); len(events) != 1 || events[0] != "deleted-dropped" || infos[0].(TableFileInfo).ColumnFamily != "doomed" {
+		t.Errorf("Expected one deleted-dropped event for doomed, got %v %+v", events, infos)
+	}
+}
+
+func TestLSM_EventListenerBackgroundError(t *testing.T) {
+	fs := vfs.NewFaultFS(vfs.NewMem(), 1)
+	rec := &recordingListener{}
+	lsm, err := New("events_error_test", &Options{FS: fs, Logger: discardLogger{}, EventListeners: []EventListener{rec}})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+
+	fs.FailAfter(vfs.OpSync, 0)
+	if err := lsm.Put([]byte("k"), []byte("v")); err == nil {
+		t.Fatal("Expected the Put to fail")
+	}
+	events, infos := rec.take()
+	if len(events) != 1 || events[0] != "error-write" {
+		t.Fatalf("Expected one error-write event, got %v", events)
+	}
+	if info := infos[0].(BackgroundErrorInfo); !errors.Is(info.Err, vfs.ErrInjected) || info.Err.Error() != lsm.BackgroundError().Error() {
+		t.Errorf("Expected the background error, got %v", info.Err)
+	}
+}
@@ -0,0 +1,247 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/dump"
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/memtable"
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/sstable"
+)
+
+// importBatchBytes is roughly how much Import writes per batch.
+const importBatchBytes = 1 << 20
+
+// ExportOptions configures Export.
+type ExportOptions struct {
+	// Gzip compresses the export. Import recognises compressed exports by itself.
+	Gzip bool
+	// ColumnFamilies names the families to export. Nil exports all of them.
+	ColumnFamilies []string
+}
+
+// Export writes the live data of the database to w in the portable format of
+// package dump: every column family with its keys, in the comparator's order,
+// their values and expiry times. Merge operands are folded into values and
+// deleted or expired keys left out, so the export does not depend on the
+// on-disk format and can be imported by other versions of the engine.
+//
+// Every family is read at the same point in time: its tables are pinned and
+// its MemTables copied, then the export is written as the tables are read,
+// without holding up reads, writes or compactions of the database. Tables
+// compaction replaces in the meantime stay on disk until the export is done.
+// A nil opts means the defaults.
+func (l *LSM) Export(w io.Writer, opts *ExportOptions) error {
+	if opts == nil {
+		opts = &ExportOptions{}
+	}
+	defer l.events.deliver()
+
+	// 1. Pin the tables of the families, with a copy of their MemTables
+	type familySnapshot struct {
+		pins *tablePins
+		mems []*memtable.MemTable
+	}
+	var snapshots []familySnapshot
+	defer func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for _, s := range snapshots {
+			l.unpin(s.pins)
+		}
+	}()
+	l.mu.Lock()
+	wanted := make(map[string]bool)
+	for _, name := range opts.ColumnFamilies {
+		wanted[name] = true
+	}
+	now := l.clock.Now()
+	for _, cf := range l.familyList() {
+		if opts.ColumnFamilies != nil && !wanted[cf.name] {
+			continue
+		}
+		delete(wanted, cf.name)
+		snapshots = append(snapshots, familySnapshot{cf.pin(), cf.memTablesSnapshot()})
+	}
+	l.mu.Unlock()
+	for name := range wanted {
+		return fmt.Errorf("engine: no column family %q to export", name)
+	}
+
+	// 2. Merge each family's tables and MemTables into the export
+	dw, err := dump.NewWriter(w, dump.WriterOptions{Gzip: opts.Gzip})
+	if err != nil {
+		return err
+	}
+	for _, s := range snapshots {
+		cf := s.pins.cf
+		if err := dw.StartFamily(dump.Family{Name: cf.name, Comparator: cf.opts.Comparator.Name()}); err != nil {
+			return err
+		}
+		it := cf.newMergingIterator(s.mems, s.pins.tables, now)
+		for it.Next() {
+			if err := dw.Add(dump.Entry{Key: it.Key(), Value: it.Value(), ExpiresAt: it.ExpiresAt()}); err != nil {
+				return err
+			}
+		}
+		if err := it.Err(); err != nil {
+			return err
+		}
+	}
+	return dw.Close()
+}
+
+// memTablesSnapshot returns the family's MemTables, newest first, with a copy
+// standing in for the one taking writes. The caller must hold l.mu.
+func (cf *ColumnFamily) memTablesSnapshot() []*memtable.MemTable {
+	mem := memtable.New(cf.opts.MaxMemSize, cf.opts.Comparator.Compare)
+	for node := cf.memTable.GetIterator(); node != nil; node = node.Next() {
+		mem.PutEntry(node.Key(), node.Value(), node.Type(), node.ExpiresAt())
+	}
+	return append([]*memtable.MemTable{mem}, cf.imm...)
+}
+
+// Import writes the data of an export made by Export into the database,
+// overwriting the keys it already holds. Entries that expired in the
+// meantime are skipped. Families missing from the database are created: the
+// comparator named in the export must be built in or set for the family in
+// Options.ColumnFamilies. Families that exist must use the same comparator.
+// A family without a comparator name, as in dumps converted from formats that
+// do not record one, takes whichever comparator it has or is configured with.
+//
+// The export is staged in the data directory and checked up to its trailer
+// first, along with the comparators of its families, so a truncated or
+// corrupt export changes nothing. Entries then go through the WAL in
+// batches, so an import that fails part way, such as on a full disk, leaves
+// what it wrote so far behind; importing the same export again completes it.
+func (l *LSM) Import(r io.Reader) error {
+	if l.opts.ReadOnly {
+		return ErrReadOnly
+	}
+
+	// 1. Stage and check the export
+	path := filepath.Join(l.dir, fmt.Sprintf("import_%d.tmp", l.newFileNumber()))
+	staged, err := l.fs.Create(path)
+	if err != nil {
+		return err
+	}
+	defer l.fs.Remove(path)
+	err = l.checkImport(io.TeeReader(r, staged))
+	if cerr := staged.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	// 2. Apply it
+	if staged, err = l.fs.Open(path); err != nil {
+		return err
+	}
+	defer staged.Close()
+	dr, err := dump.NewReader(staged)
+	if err != nil {
+		return err
+	}
+
+	var cf *ColumnFamily
+	var ops []batchOp
+	size := 0
+	writeBatch := func() error {
+		if len(ops) == 0 {
+			return nil
+		}
+		err := l.write(ops)
+		ops, size = nil, 0
+		return err
+	}
+	for {
+		rec, err := dr.Next()
+		if err == io.EOF {
+			return writeBatch()
+		}
+		if err != nil {
+			return err
+		}
+		switch rec.Kind {
+		case dump.KindFamily:
+			if err := writeBatch(); err != nil {
+				return err
+			}
+			if cf, err = l.importFamily(rec.Family); err != nil {
+				return err
+			}
+		case dump.KindEntry:
+			e := rec.Entry
+			if isExpired(e.ExpiresAt, l.clock.Now()) {
+				continue
+			}
+			ops = append(ops, batchOp{cf: cf, key: e.Key, value: e.Value, kind: sstable.TypeValue, expiresAt: e.ExpiresAt})
+			size += len(e.Key) + len(e.Value)
+			if size >= importBatchBytes {
+				if err := writeBatch(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// checkImport reads the export on r to the end, failing if it is corrupt or
+// holds a family that cannot be imported.
+func (l *LSM) checkImport(r io.Reader) error {
+	dr, err := dump.NewReader(r)
+	if err != nil {
+		return err
+	}
+	for {
+		rec, err := dr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if rec.Kind == dump.KindFamily {
+			if _, _, err := l.importFamilyOptions(rec.Family); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// importFamily returns the family f of an export is imported into, creating it if needed.
+func (l *LSM) importFamily(f dump.Family) (*ColumnFamily, error) {
+	cf, opts, err := l.importFamilyOptions(f)
+	if cf != nil || err != nil {
+		return cf, err
+	}
+	return l.CreateColumnFamily(f.Name, opts)
+}
+
+// importFamilyOptions returns the family f of an export is imported into,
+// or if there is none yet the options to create it with.
+func (l *LSM) importFamilyOptions(f dump.Family) (*ColumnFamily, ColumnFamilyOptions, error) {
+	if cf, ok := l.GetColumnFamily(f.Name); ok {
+		if name := cf.opts.Comparator.Name(); f.Comparator != "" && name != f.Comparator {
+			return nil, ColumnFamilyOptions{}, fmt.Errorf("%w: column family %q uses %q, the export %q", ErrComparatorMismatch, f.Name, name, f.Comparator)
+		}
+		return cf, ColumnFamilyOptions{}, nil
+	}
+	opts := l.opts.familyOptions(f.Name)
+	if f.Comparator == "" {
+		return nil, opts, nil
+	}
+	if opts.Comparator == nil {
+		opts.Comparator = builtinComparators[f.Comparator]
+	}
+	if opts.Comparator == nil {
+		return nil, opts, fmt.Errorf("%w: column family %q uses %q, which must be set in Options.ColumnFamilies",
+			ErrComparatorMismatch, f.Name, f.Comparator)
+	}
+	if name := opts.Comparator.Name(); name != f.Comparator {
+		return nil, opts, fmt.Errorf("%w: column family %q is configured with %q, the export uses %q", ErrComparatorMismatch, f.Name, name, f.Comparator)
+	}
+	return nil, opts, nil
+}
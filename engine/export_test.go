@@ -0,0 +1,251 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/dump"
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+func TestLSM_ExportImport(t *testing.T) {
+	fs := vfs.NewMem()
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	opts := &Options{FS: fs, MaxMemSize: 1 << 20, MergeOperator: StringAppendOperator{Delimiter: ","}}
+	src, err := New("export_src", opts)
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer src.Close()
+	src.SetClock(clock)
+	users, err := src.CreateColumnFamily("users", ColumnFamilyOptions{Comparator: ReverseBytewiseComparator})
+	if err != nil {
+		t.Fatalf("CreateColumnFamily failed: %v", err)
+	}
+
+	for i := 0; i < 50; i++ {
+		src.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("value"))
+	}
+	src.flush()
+	src.Delete([]byte("key10"))
+	src.Merge([]byte("key20"), []byte("more"))
+	src.PutWithTTL([]byte("session"), []byte("token"), time.Minute)
+	src.PutWithTTL([]byte("stale"), []byte("token"), time.Second)
+	src.PutCF(users, []byte("alice"), []byte("admin"))
+	clock.Advance(2 * time.Second)
+
+	// 1. Live data only, merges folded, in both formats
+	for _, gzip := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := src.Export(&buf, &ExportOptions{Gzip: gzip}); err != nil {
+			t.Fatalf("gzip=%v: Export failed: %v", gzip, err)
+		}
+		dst, err := New(fmt.Sprintf("export_dst_%v", gzip), &Options{FS: fs, MaxMemSize: 1 << 20})
+		if err != nil {
+			t.Fatalf("Failed to init LSM: %v", err)
+		}
+		dst.SetClock(clock)
+		if err := dst.Import(&buf); err != nil {
+			t.Fatalf("gzip=%v: Import failed: %v", gzip, err)
+		}
+		for key, want := range map[string]string{"key00": "value", "key20": "value,more", "session": "token"} {
+			if val, _, _ := dst.Get([]byte(key)); string(val) != want {
+				t.Errorf("gzip=%v: expected %s=%s, got %q", gzip, key, want, val)
+			}
+		}
+		for _, key := range []string{"key10", "stale"} {
+			if _, found, _ := dst.Get([]byte(key)); found {
+				t.Errorf("gzip=%v: expected %s to be left out", gzip, key)
+			}
+		}
+		dstUsers, ok := dst.GetColumnFamily("users")
+		if !ok || dstUsers.opts.Comparator != ReverseBytewiseComparator {
+			t.Fatalf("gzip=%v: expected users to be created with its comparator", gzip)
+		}
+		if val, _, _ := dst.GetCF(dstUsers, []byte("alice")); string(val) != "admin" {
+			t.Errorf("gzip=%v: expected alice=admin, got %q", gzip, val)
+		}
+		dst.Close()
+	}
+
+	// 2. A single family, and one that does not exist
+	var buf bytes.Buffer
+	if err := src.Export(&buf, &ExportOptions{ColumnFamilies: []string{"users"}}); err != nil {
+		t.Fatalf("Export of users failed: %v", err)
+	}
+	r, _ := dump.NewReader(bytes.NewReader(buf.Bytes()))
+	if rec, err := r.Next(); err != nil || rec.Family.Name != "users" {
+		t.Errorf("Expected the export to open with users, got %+v (%v)", rec, err)
+	}
+	if err := src.Export(&bytes.Buffer{}, &ExportOptions{ColumnFamilies: []string{"missing"}}); err == nil {
+		t.Error("Expected exporting a missing family to fail")
+	}
+
+	// 3. Comparators must agree
+	mismatch, err := New("export_mismatch", &Options{
+		FS:             fs,
+		ColumnFamilies: map[string]ColumnFamilyOptions{"users": {Comparator: BytewiseComparator}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer mismatch.Close()
+	if err := mismatch.Import(bytes.NewReader(buf.Bytes())); !errors.Is(err, ErrComparatorMismatch) {
+		t.Errorf("Expected ErrComparatorMismatch, got %v", err)
+	}
+}
+
+func TestLSM_ExportStreamsPinnedTables(t *testing.T) {
+	fs := vfs.NewMem()
+	src, err := New("export_stream_src", &Options{FS: fs, MaxMemSize: 1 << 20, MinBlobSize: 64, CompactionStrategy: CompactAll})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer src.Close()
+	for i := 0; i < 20; i++ {
+		src.Put([]byte(fmt.Sprintf("big%02d", i)), bytes.Repeat([]byte{byte(i)}, 100))
+	}
+	src.flush()
+	for i := 0; i < 20; i++ {
+		src.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("value"))
+	}
+	src.flush()
+	src.Put([]byte("mem"), []byte("value"))
+	src.mu.RLock()
+	var files []string
+	for _, sst := range src.defaultCF.sstTables {
+		files = append(files, sst.Path())
+	}
+	for number := range src.defaultCF.blobFiles {
+		files = append(files, src.defaultCF.blobPath(number))
+	}
+	src.mu.RUnlock()
+
+	// 1. The export waits on its reader once it has pinned the tables
+	pr, pw := io.Pipe()
+	done := make(chan error)
+	go func() {
+		err := src.Export(pw, nil)
+		pw.CloseWithError(err)
+		done <- err
+	}()
+	first := make([]byte, 1)
+	if _, err := io.ReadFull(pr, first); err != nil {
+		t.Fatalf("Reading the export failed: %v", err)
+	}
+
+	// 2. Meanwhile the database goes on, and compaction replaces every
+	// table and blob file without deleting them from under the export
+	for i := 0; i < 20; i++ {
+		src.Delete([]byte(fmt.Sprintf("big%02d", i)))
+	}
+	src.Put([]byte("later"), []byte("value"))
+	src.Delete([]byte("mem"))
+	src.flush()
+	if err := src.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if s := src.Stats(); s.BlobFiles != 0 || s.TableCount() != 1 {
+		t.Errorf("Expected one table and no blob files after the compaction, got %d and %d", s.TableCount(), s.BlobFiles)
+	}
+	for _, path := range files {
+		if _, err := fs.Stat(path); err != nil {
+			t.Errorf("Expected %s kept for the export, got %v", path, err)
+		}
+	}
+
+	// 3. The export holds the data as it was when it started
+	rest, err := io.ReadAll(pr)
+	if err != nil || <-done != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	dst, err := New("export_stream_dst", &Options{FS: fs, MaxMemSize: 1 << 20})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer dst.Close()
+	if err := dst.Import(bytes.NewReader(append(first, rest...))); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		if val, _, _ := dst.Get([]byte(fmt.Sprintf("big%02d", i))); !bytes.Equal(val, bytes.Repeat([]byte{byte(i)}, 100)) {
+			t.Errorf("Expected big%02d from the blob file, got %q", i, val)
+		}
+	}
+	if _, found, _ := dst.Get([]byte("mem")); !found {
+		t.Errorf("Expected the key from the MemTable")
+	}
+	if _, found, _ := dst.Get([]byte("later")); found {
+		t.Errorf("Expected the key written during the export to be left out")
+	}
+
+	// 4. Then the replaced files go
+	for _, path := range files {
+		if _, err := fs.Stat(path); err == nil {
+			t.Errorf("Expected %s removed once the export was done", path)
+		}
+	}
+}
+
+func TestLSM_ImportCorrupt(t *testing.T) {
+	fs := vfs.NewMem()
+	src, err := New("import_src", &Options{FS: fs})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer src.Close()
+	// Values large enough that the export spans several import batches
+	value := bytes.Repeat([]byte("v"), importBatchBytes/4)
+	for i := 0; i < 20; i++ {
+		src.Put([]byte(fmt.Sprintf("key%02d", i)), value)
+	}
+	logs, err := src.CreateColumnFamily("logs", ColumnFamilyOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create column family: %v", err)
+	}
+	src.PutCF(logs, []byte("k"), []byte("v"))
+	var buf bytes.Buffer
+	if err := src.Export(&buf, nil); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	data := buf.Bytes()
+
+	dst, err := New("import_dst", &Options{FS: fs})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer dst.Close()
+	flipped := append([]byte(nil), data...)
+	flipped[len(flipped)/2] ^= 0xff
+	for name, bad := range map[string][]byte{"flipped": flipped, "truncated": data[:len(data)-5]} {
+		if err := dst.Import(bytes.NewReader(bad)); !errors.Is(err, dump.ErrCorrupt) {
+			t.Errorf("%s: expected dump.ErrCorrupt, got %v", name, err)
+		}
+		// Nothing of a rejected export is applied or left behind
+		if _, found, _ := dst.Get([]byte("key00")); found {
+			t.Errorf("%s: expected key00 not to be imported", name)
+		}
+		if _, ok := dst.GetColumnFamily("logs"); ok {
+			t.Errorf("%s: expected column family 'logs' not to be created", name)
+		}
+		names, _ := fs.List("import_dst")
+		for _, n := range names {
+			if strings.HasPrefix(n, "import_") {
+				t.Errorf("%s: expected the staged export to be removed, found %s", name, n)
+			}
+		}
+	}
+
+	// The intact export still imports
+	if err := dst.Import(bytes.NewReader(data)); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if val, found, _ := dst.Get([]byte("key19")); !found || !bytes.Equal(val, value) {
+		t.Errorf("Expected key19 to be imported, got found=%v", found)
+	}
+}
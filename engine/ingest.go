@@ -0,0 +1,237 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/sstable"
+)
+
+// ErrBadExternalFile is returned by IngestExternalFile for files it cannot
+// take: keys out of order, files overlapping one another, or entries that
+// only make sense inside the database they came from.
+var ErrBadExternalFile = errors.New("engine: cannot ingest external file")
+
+// IngestOptions configures IngestExternalFile.
+type IngestOptions struct {
+	// MoveFiles hard-links the files into the database and removes the
+	// originals once they are live. Otherwise, or where links are not
+	// possible, the files are copied and the originals left alone.
+	MoveFiles bool
+}
+
+// externalFile is a file being ingested, with its key range.
+type externalFile struct {
+	src               string
+	smallest, largest []byte
+}
+
+// IngestExternalFile adds SSTables built with SSTWriter to the default
+// column family, which is far cheaper than writing their entries one by one.
+// The ingested data is newer than anything already in the family.
+//
+// Tables are ordered by their place in the manifest rather than by sequence
+// numbers, so that is how each file gets its recency: it goes just above the
+// newest table holding keys in its range, or to the bottom if none does,
+// where it adds the least work for compaction. If the MemTable holds keys in
+// the range of a file, it is flushed first.
+//
+// Every file is checked before any is ingested, and they are added in a
+// single manifest update, so either all of them become live or none. A nil
+// opts means the defaults.
+func (l *LSM) IngestExternalFile(paths []string, opts *IngestOptions) error {
+	return l.IngestExternalFileCF(l.defaultCF, paths, opts)
+}
+
+// IngestExternalFileCF is like IngestExternalFile for the column family cf.
+// The files must have been written with cf's comparator.
+func (l *LSM) IngestExternalFileCF(cf *ColumnFamily, paths []string, opts *IngestOptions) (err error) {
+	if l.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	if opts == nil {
+		opts = &IngestOptions{}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	defer l.events.deliver()
+
+	// 1. Check the files, and that they do not overlap one another
+	files := make([]externalFile, len(paths))
+	for i, path := range paths {
+		if files[i], err = cf.inspectExternalFile(path); err != nil {
+			return err
+		}
+	}
+	sorted := append([]externalFile(nil), files...)
+	cmp := cf.opts.Comparator
+	sort.Slice(sorted, func(i, j int) bool { return cmp.Compare(sorted[i].smallest, sorted[j].smallest) < 0 })
+	for i := 1; i < len(sorted); i++ {
+		if cmp.Compare(sorted[i].smallest, sorted[i-1].largest) <= 0 {
+			return fmt.Errorf("%w: %s and %s overlap", ErrBadExternalFile, sorted[i-1].src, sorted[i].src)
+		}
+	}
+
+	// 2. Bring them into the family's directory under temporary names, which
+	// open removes if we never get to install them. Holding compactMu keeps
+	// compactions, which expect their inputs to stay next to one another, away.
+	cf.compactMu.Lock()
+	defer cf.compactMu.Unlock()
+	dsts := make([]string, len(files))
+	removeTmp := func() {
+		for _, dst := range dsts {
+			if dst != "" {
+				l.fs.Remove(dst + ".tmp")
+			}
+		}
+	}
+	for i, f := range files {
+		dst := filepath.Join(cf.dir, fmt.Sprintf("ingested_%d.sst", l.newFileNumber()))
+		if opts.MoveFiles {
+			err = linkOrCopy(l.fs, f.src, dst+".tmp")
+		} else {
+			err = copyFile(l.fs, f.src, dst+".tmp")
+		}
+		dsts[i] = dst
+		if err != nil {
+			removeTmp()
+			return err
+		}
+	}
+
+	// 3. Install them in one manifest update, once the MemTables hold
+	// nothing they would have to shadow. Flushing lets go of the lock, and
+	// writes may land in the meantime, so look again afterwards.
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for {
+		if cf.dropped {
+			removeTmp()
+			return ErrColumnFamilyDropped
+		}
+		overlaps := false
+		for _, f := range files {
+			overlaps = overlaps || cf.memTableOverlaps(f.smallest, f.largest)
+		}
+		if !overlaps {
+			break
+		}
+		l.mu.Unlock()
+		err := l.flush()
+		l.mu.Lock()
+		if err != nil {
+			removeTmp()
+			return err
+		}
+	}
+
+	var readers []*sstable.Reader
+	discard := func() {
+		for _, r := range readers {
+			r.Close()
+			l.fs.Remove(r.Path())
+		}
+		removeTmp()
+	}
+	for _, dst := range dsts {
+		if err := l.fs.Rename(dst+".tmp", dst); err != nil {
+			discard()
+			return err
+		}
+		r, err := sstable.OpenWithOptions(dst, cf.readerOpts)
+		if err != nil {
+			l.fs.Remove(dst)
+			discard()
+			return err
+		}
+		readers = append(readers, r)
+	}
+
+	old := cf.sstTables
+	for i, r := range readers {
+		cf.insertIngested(r, files[i])
+	}
+	if err := l.saveManifest(); err != nil {
+		cf.setTables(old)
+		discard()
+		return err
+	}
+
+	for _, r := range readers {
+		l.stats.ingestedFiles.Add(1)
+		l.stats.ingestedBytes.Add(r.Size())
+		created := TableFileInfo{ColumnFamily: cf.name, Path: r.Path(), Size: r.Size(), Reason: TableIngested}
+		l.events.push(func(el EventListener) { el.OnTableFileCreated(created) })
+	}
+	if opts.MoveFiles {
+		for _, f := range files {
+			l.fs.Remove(f.src)
+		}
+	}
+	l.updateWriteStall()
+	l.scheduleCompaction()
+	return nil
+}
+
+// inspectExternalFile checks that the table at path can be ingested into cf
+// and reads its key range.
+func (cf *ColumnFamily) inspectExternalFile(path string) (externalFile, error) {
+	r, err := sstable.OpenWithOptions(path, sstable.ReaderOptions{Comparator: cf.opts.Comparator, FS: cf.readerOpts.FS})
+	if err != nil {
+		return externalFile{}, err
+	}
+	defer r.Close()
+
+	f := externalFile{src: path}
+	cmp := cf.opts.Comparator
+	err = r.Scan(func(key []byte, e sstable.Entry) error {
+		if e.Type == sstable.TypeBlobIndex {
+			return fmt.Errorf("%w: %s points into blob files of another database", ErrBadExternalFile, path)
+		}
+		if f.largest != nil && cmp.Compare(key, f.largest) <= 0 {
+			return fmt.Errorf("%w: %s has %q after %q", ErrBadExternalFile, path, key, f.largest)
+		}
+		if f.smallest == nil {
+			f.smallest = append([]byte{}, key...)
+		}
+		f.largest = append(f.largest[:0], key...)
+		return nil
+	})
+	if err != nil {
+		return externalFile{}, err
+	}
+	if f.smallest == nil {
+		return externalFile{}, fmt.Errorf("%w: %s is empty", ErrBadExternalFile, path)
+	}
+	return f, nil
+}
+
+// memTableOverlaps reports whether one of the family's MemTables holds keys
+// from start to end, both inclusive. The caller must hold l.mu.
+func (cf *ColumnFamily) memTableOverlaps(start, end []byte) bool {
+	for _, mem := range cf.memTables() {
+		if node := mem.Seek(start); node != nil && cf.opts.Comparator.Compare(node.Key(), end) <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// insertIngested places r, holding the keys of f, among the family's tables:
+// just above the newest table overlapping it, so it shadows that data, or at
+// the bottom if nothing does. The caller must hold l.mu.
+func (cf *ColumnFamily) insertIngested(r *sstable.Reader, f externalFile) {
+	pos := len(cf.sstTables)
+	for i, sst := range cf.sstTables {
+		if cf.overlaps(sst, f.smallest, f.largest) {
+			pos = i
+			break
+		}
+	}
+	tables := append([]*sstable.Reader(nil), cf.sstTables[:pos]...)
+	tables = append(tables, r)
+	cf.setTables(append(tables, cf.sstTables[pos:]...))
+}
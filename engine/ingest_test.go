@@ -0,0 +1,134 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+// writeExternal builds an SSTable at path from keys and values given in pairs.
+func writeExternal(t *testing.T, path string, opts *Options, kvs ...string) ExternalFileInfo {
+	t.Helper()
+	w, err := NewSSTWriter(path, opts)
+	if err != nil {
+		t.Fatalf("NewSSTWriter failed: %v", err)
+	}
+	for i := 0; i < len(kvs); i += 2 {
+		if err := w.Put([]byte(kvs[i]), []byte(kvs[i+1])); err != nil {
+			t.Fatalf("Put %s failed: %v", kvs[i], err)
+		}
+	}
+	info, err := w.Finish()
+	if err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+	return info
+}
+
+func TestSSTWriter(t *testing.T) {
+	fs := vfs.NewMem()
+	w, err := NewSSTWriter("writer.sst", &Options{FS: fs})
+	if err != nil {
+		t.Fatalf("NewSSTWriter failed: %v", err)
+	}
+	w.Put([]byte("b"), []byte("1"))
+	if err := w.Put([]byte("a"), []byte("2")); !errors.Is(err, ErrKeyOrder) {
+		t.Errorf("Expected ErrKeyOrder going backwards, got %v", err)
+	}
+	if err := w.Delete([]byte("b")); !errors.Is(err, ErrKeyOrder) {
+		t.Errorf("Expected ErrKeyOrder for a repeated key, got %v", err)
+	}
+	w.Merge([]byte("c"), []byte("3"))
+	info, err := w.Finish()
+	if err != nil || string(info.Smallest) != "b" || string(info.Largest) != "c" || info.Entries != 2 || info.Size == 0 {
+		t.Errorf("Unexpected file info %+v (%v)", info, err)
+	}
+	if err := w.Put([]byte("d"), nil); err == nil {
+		t.Error("Expected Put after Finish to fail")
+	}
+
+	empty, _ := NewSSTWriter("empty.sst", &Options{FS: fs})
+	if _, err := empty.Finish(); err == nil {
+		t.Error("Expected finishing an empty table to fail")
+	}
+	if _, err := fs.Stat("empty.sst"); err == nil {
+		t.Error("Expected the empty table to be removed")
+	}
+}
+
+func TestLSM_IngestExternalFile(t *testing.T) {
+	dir := "ingest_test"
+	fs := vfs.NewMem()
+	opts := &Options{FS: fs, MaxMemSize: 1 << 20}
+	lsm, err := New(dir, opts)
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		lsm.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("old"))
+	}
+	lsm.flush()
+	flushed := lsm.defaultCF.sstTables[0]
+	lsm.Put([]byte("key07"), []byte("memtable"))
+
+	// 1. Bad inputs are refused before anything changes
+	fs.MkdirAll("ext", 0755)
+	writeExternal(t, "ext/a.sst", &Options{FS: fs}, "key05", "x", "key08", "x")
+	writeExternal(t, "ext/b.sst", &Options{FS: fs}, "key06", "y")
+	if err := lsm.IngestExternalFile([]string{"ext/a.sst", "ext/b.sst"}, nil); !errors.Is(err, ErrBadExternalFile) {
+		t.Errorf("Expected ErrBadExternalFile for overlapping files, got %v", err)
+	}
+	writeExternal(t, "ext/reverse.sst", &Options{FS: fs, Comparator: ReverseBytewiseComparator}, "z", "x")
+	if err := lsm.IngestExternalFile([]string{"ext/reverse.sst"}, nil); !errors.Is(err, ErrComparatorMismatch) {
+		t.Errorf("Expected ErrComparatorMismatch, got %v", err)
+	}
+	if len(lsm.defaultCF.sstTables) != 1 || lsm.Stats().IngestedFiles != 0 {
+		t.Fatal("Expected failed ingestions to leave the tables alone")
+	}
+
+	// 2. A file overlapping the MemTable and the flushed table lands on top,
+	// one overlapping nothing at the bottom
+	bulk := make([]string, 0, 200)
+	for i := 0; i < 100; i++ {
+		bulk = append(bulk, fmt.Sprintf("bulk%03d", i), "loaded")
+	}
+	writeExternal(t, "ext/bulk.sst", &Options{FS: fs}, bulk...)
+	writeExternal(t, "ext/update.sst", &Options{FS: fs}, "key05", "new", "key07", "new")
+	if err := lsm.IngestExternalFile([]string{"ext/bulk.sst", "ext/update.sst"}, &IngestOptions{MoveFiles: true}); err != nil {
+		t.Fatalf("IngestExternalFile failed: %v", err)
+	}
+	tables := lsm.defaultCF.sstTables
+	ingested := func(i int) bool { return strings.HasPrefix(filepath.Base(tables[i].Path()), "ingested_") }
+	if len(tables) != 4 || !ingested(0) || ingested(1) || tables[2] != flushed || !ingested(3) || !lsm.defaultCF.memTable.IsEmpty() {
+		t.Fatalf("Expected update, MemTable flush, old table and bulk, newest first; got %d tables", len(tables))
+	}
+	for _, src := range []string{"ext/bulk.sst", "ext/update.sst"} {
+		if _, err := fs.Stat(src); err == nil {
+			t.Errorf("Expected %s to be moved", src)
+		}
+	}
+	check := func(db *LSM) {
+		t.Helper()
+		for key, want := range map[string]string{"key04": "old", "key05": "new", "key07": "new", "bulk042": "loaded"} {
+			if val, _, err := db.Get([]byte(key)); string(val) != want {
+				t.Errorf("Expected %s=%s, got %q (%v)", key, want, val, err)
+			}
+		}
+	}
+	check(lsm)
+	if s := lsm.Stats(); s.IngestedFiles != 2 || s.IngestedBytes == 0 {
+		t.Errorf("Expected two ingested files, got %d (%d bytes)", s.IngestedFiles, s.IngestedBytes)
+	}
+
+	// 3. The ingested tables survive a reopen
+	lsm.Close()
+	if lsm, err = New(dir, opts); err != nil {
+		t.Fatalf("Failed to reopen: %v", err)
+	}
+	defer lsm.Close()
+	check(lsm)
+}
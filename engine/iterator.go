@@ -0,0 +1,196 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/memtable"
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/sstable"
+)
+
+// Iterator walks the live keys of the engine in the comparator's order.
+// It works on a snapshot taken when it was created, so later writes are not
+// visible. It reads the tables as it goes, keeping them open and on disk
+// until it is done: call Close once finished with it, unless Next already
+// returned false.
+type Iterator struct {
+	l    *LSM
+	it   *mergingIterator
+	pins *tablePins
+}
+
+// NewIterator returns an iterator positioned before the first key.
+// Deleted and expired keys are skipped.
+func (l *LSM) NewIterator() (*Iterator, error) {
+	return l.NewIteratorCF(l.defaultCF)
+}
+
+// NewIteratorCF is like NewIterator for the column family cf.
+func (l *LSM) NewIteratorCF(cf *ColumnFamily) (*Iterator, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if cf.dropped {
+		return nil, ErrColumnFamilyDropped
+	}
+	pins := cf.pin()
+	it := cf.newMergingIterator(cf.memTablesSnapshot(), pins.tables, l.clock.Now())
+	return &Iterator{l: l, it: it, pins: pins}, nil
+}
+
+// Next advances to the next key and reports whether there is one. It
+// returns false at the end or once reading failed, see Err, and then
+// releases the tables like Close.
+func (it *Iterator) Next() bool {
+	if it.pins == nil {
+		return false
+	}
+	if it.it.Next() {
+		return true
+	}
+	it.Close()
+	return false
+}
+
+// Key returns the key at the current position. It is valid until the next
+// call to Next.
+func (it *Iterator) Key() []byte {
+	return it.it.Key()
+}
+
+// Value returns the value at the current position. It is valid until the
+// next call to Next.
+func (it *Iterator) Value() []byte {
+	return it.it.Value()
+}
+
+// Err returns the error that stopped the iterator, if any.
+func (it *Iterator) Err() error {
+	return it.it.Err()
+}
+
+// Close releases the tables the iterator reads. It is safe to call more
+// than once.
+func (it *Iterator) Close() error {
+	if it.pins == nil {
+		return nil
+	}
+	l := it.l
+	defer l.events.deliver()
+	l.mu.Lock()
+	l.unpin(it.pins)
+	l.mu.Unlock()
+	it.pins = nil
+	return nil
+}
+
+// mergingIterator walks the live keys of a family in the comparator's order,
+// merging its MemTables and SSTables as Get sees them: operands folded, blob
+// references followed, deleted and expired keys skipped. It reads the tables
+// as it goes, without l.mu, so the MemTables must no longer take writes and
+// the tables must be pinned, see ColumnFamily.pin.
+type mergingIterator struct {
+	cf  *ColumnFamily
+	now time.Time
+	// mems are where each MemTable is at, nil once done, and tables each
+	// table's iterator with whether it is at an entry; both newest first
+	mems   []*memtable.Node
+	tables []*sstable.Iterator
+	more   []bool
+
+	key       []byte
+	value     []byte
+	expiresAt int64
+	err       error
+}
+
+// newMergingIterator returns an iterator over mems and tables, both newest
+// first, positioned before the first key.
+func (cf *ColumnFamily) newMergingIterator(mems []*memtable.MemTable, tables []*sstable.Reader, now time.Time) *mergingIterator {
+	it := &mergingIterator{cf: cf, now: now}
+	for _, mem := range mems {
+		it.mems = append(it.mems, mem.GetIterator())
+	}
+	for _, sst := range tables {
+		t := sst.NewIterator()
+		it.tables = append(it.tables, t)
+		it.more = append(it.more, t.Next())
+		if it.err == nil {
+			it.err = t.Err()
+		}
+	}
+	return it
+}
+
+// Next advances to the next live key and reports whether there is one. It
+// returns false at the end or once reading failed, see Err.
+func (it *mergingIterator) Next() bool {
+	cmp := it.cf.opts.Comparator
+	for it.err == nil {
+		// 1. The smallest key any input is at
+		var key []byte
+		found := false
+		for _, node := range it.mems {
+			if node != nil && (!found || cmp.Compare(node.Key(), key) < 0) {
+				key, found = node.Key(), true
+			}
+		}
+		for i, t := range it.tables {
+			if it.more[i] && (!found || cmp.Compare(t.Key(), key) < 0) {
+				key, found = t.Key(), true
+			}
+		}
+		if !found {
+			return false
+		}
+
+		// 2. Its entries, newest first, until one decides it. Every input
+		// moves past it.
+		lk := lookup{key: key}
+		for i, node := range it.mems {
+			if node != nil && cmp.Compare(node.Key(), key) == 0 {
+				if !lk.done {
+					lk.memTable(it.cf, node, it.now)
+				}
+				it.mems[i] = node.Next()
+			}
+		}
+		for i, t := range it.tables {
+			if it.more[i] && cmp.Compare(t.Key(), key) == 0 {
+				if !lk.done {
+					lk.table(it.cf, t.Entry(), it.now)
+				}
+				if it.more[i] = t.Next(); it.err == nil {
+					it.err = t.Err()
+				}
+			}
+		}
+		lk.finish(it.cf, it.now)
+		if lk.err != nil {
+			it.err = lk.err
+		}
+		if it.err == nil && lk.found {
+			it.key, it.value, it.expiresAt = key, lk.value, lk.expiresAt
+			return true
+		}
+	}
+	return false
+}
+
+// Key returns the key at the current position.
+func (it *mergingIterator) Key() []byte {
+	return it.key
+}
+
+// Value returns the value at the current position.
+func (it *mergingIterator) Value() []byte {
+	return it.value
+}
+
+// ExpiresAt returns when the value at the current position expires, 0 for never.
+func (it *mergingIterator) ExpiresAt() int64 {
+	return it.expiresAt
+}
+
+// Err returns the error that stopped the iterator, if any.
+func (it *mergingIterator) Err() error {
+	return it.err
+}
@@ -1,261 +1,849 @@
 package engine
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
-	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/blob"
 	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/memtable"
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/ratelimit"
 	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/sstable"
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/wal"
 )
 
 // The Engine’s job is to coordinate them: when you call Get, it first checks the MemTable,
 // then searches through the SSTables on disk from newest to oldest.
 // When you call Put and the MemTable fills up, the Engine triggers a flush.
 
+// tombstoneDensityThreshold is the fraction of tombstones at which a table is
+// considered dominated by deletes and gets scheduled for compaction.
+const tombstoneDensityThreshold = 0.5
+
 // LSM represents the core database engine
 type LSM struct {
-	mu         sync.RWMutex
-	memTable   *memtable.MemTable
-	sstTables  []*sstable.Reader
-	dir        string
-	maxMemSize int
+	mu   sync.RWMutex
+	dir  string
+	fs   vfs.FS
+	opts *Options
+	// lock is held on the LOCK file until Close; nil in read-only mode
+	lock io.Closer
+	// cache holds recently read SSTable blocks of every family; nil when disabled
+	cache *sstable.Cache
+
+	// All column families share one WAL. walNumber names the one being
+	// written; logNumber, recorded in the manifest, the oldest one holding
+	// writes that are not in an SSTable yet. They differ while frozen
+	// MemTables wait to be flushed.
+	wal          *wal.WAL
+	logNumber    uint64
+	walNumber    uint64
+	families     map[uint32]*ColumnFamily
+	defaultCF    *ColumnFamily
+	nextFamilyID uint32
+	// nextFileNumber numbers the SSTables and blob files that flushes,
+	// compactions and ingestion write, so no two ever share a name. The
+	// manifest records it. Files are numbered without holding l.mu.
+	nextFileNumber atomic.Uint64
+	// walErr is the failure that left the WAL in an unknown state. Once
+	// set, every write fails with it until the engine is reopened.
+	walErr error
+	// walOffset is where replaying WAL walNumber stopped; a secondary
+	// instance resumes from there
+	walOffset int64
+	// secondary is set for instances that follow a primary, see OpenAsSecondary
+	secondary bool
+
+	// imm are the MemTables frozen for a flush, oldest first. flushMu
+	// serialises flushes, which write them out without holding l.mu.
+	imm     []*frozenMemTables
+	flushMu sync.Mutex
+	// closed is set once Close has released the files
+	closed bool
+
+	// compactMu serialises compactions so the background worker and a manual
+	// Compact call never pick the same input tables. It is taken before the
+	// family's own compactMu, which every compaction holds.
+	compactMu sync.Mutex
+	compactCh chan struct{}
+	closeCh   chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
+
+	// clock decides when TTL entries expire
+	clock  Clock
+	stats  engineStats
+	events eventQueue
+	// stall holds writers back while compaction catches up
+	stall writeController
 }
 
-// New opens the LSM engine in the specified directory
-func New(dir string, maxMemSize int) (*LSM, error) {
-	// 0755 means the owner can read/write/execute, and others can read/execute
-	if err := os.MkdirAll(dir, 0755); err != nil {
+// New opens the LSM engine in the specified directory. A nil opts uses the
+// defaults described on Options.
+func New(dir string, opts *Options) (*LSM, error) {
+	o := opts.withDefaults()
+	if err := o.validate(); err != nil {
 		return nil, err
 	}
+	if _, err := o.FS.Stat(dir); os.IsNotExist(err) && (o.ErrorIfMissing || o.ReadOnly) {
+		return nil, fmt.Errorf("%w: %s", ErrDBNotFound, dir)
+	}
+	var lock io.Closer
+	if !o.ReadOnly {
+		// 0755 means the owner can read/write/execute, and others can read/execute
+		if err := o.FS.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		var err error
+		if lock, err = lockDir(o.FS, dir); err != nil {
+			return nil, err
+		}
+	}
 	lsm := &LSM{
-		dir:        dir,
-		maxMemSize: maxMemSize,
+		dir:       dir,
+		fs:        o.FS,
+		opts:      o,
+		lock:      lock,
+		families:  make(map[uint32]*ColumnFamily),
+		compactCh: make(chan struct{}, 1),
+		closeCh:   make(chan struct{}),
+		clock:     systemClock{},
 	}
-	// 1. Initialize MemTable
-	// In a read DB we would replay the WAL here first to restore the MemTable state, but for simplicity we start fresh
-	walPath := filepath.Join(dir, "active.wal")
-	mt, err := memtable.NewMemTable(walPath, maxMemSize)
-	if err != nil {
-		return nil, err
+	lsm.events.listeners = o.EventListeners
+	lsm.stall.cond = sync.NewCond(&lsm.stall.mu)
+	lsm.stall.rate = o.DelayedWriteRate
+	if o.CacheSize > 0 {
+		lsm.cache = sstable.NewCache(o.CacheSize)
 	}
-	lsm.memTable = mt
-	// 2. Load existing SSTables
-	if err := lsm.loadSSTables(); err != nil {
+	if err := lsm.recover(); err != nil {
+		for _, cf := range lsm.families {
+			cf.closeTables()
+		}
+		if lsm.wal != nil {
+			lsm.wal.Close()
+		}
+		if lock != nil {
+			lock.Close()
+		}
 		return nil, err
 	}
+	// Report what opening did, such as flushing the WAL
+	lsm.events.deliver()
+	if o.ReadOnly {
+		return lsm, nil
+	}
+	// Start the background compaction worker
+	lsm.wg.Add(1)
+	go lsm.compactionLoop()
+	lsm.scheduleCompaction()
 	return lsm, nil
 }
 
-// loadSSTables scans the directory for existing SSTable files and loads them into memory
-func (lsm *LSM) loadSSTables() error {
-	files, err := os.ReadDir(lsm.dir)
+// lockDir takes the LOCK file of the database in dir, so that a second
+// writer fails with ErrLocked instead of corrupting it.
+func lockDir(fs vfs.FS, dir string) (io.Closer, error) {
+	lock, err := fs.Lock(filepath.Join(dir, lockName))
+	if errors.Is(err, vfs.ErrLocked) {
+		return nil, fmt.Errorf("%w: %s is open in another writer", ErrLocked, dir)
+	}
+	return lock, err
+}
+
+// recover rebuilds the engine state from the directory: the manifest says
+// which families and tables are live, and the WAL restores unflushed writes.
+// In read-only mode nothing in the directory is changed.
+func (l *LSM) recover() error {
+	// 1. Read the manifest, or describe a directory from before it existed
+	m, err := readManifest(l.fs, l.dir)
 	if err != nil {
 		return err
 	}
-	var sstFiles []string
-	for _, f := range files {
-		// .sst stands for "Sorted String Table", a common file format for LSM trees
-		if strings.HasSuffix(f.Name(), ".sst") {
-			sstFiles = append(sstFiles, filepath.Join(lsm.dir, f.Name()))
+	exists := m != nil
+	if m == nil {
+		if m, err = legacyManifest(l.fs, l.dir); err != nil {
+			return err
 		}
+		exists = len(m.Families[0].Tables) > 0
 	}
-	// Sort files so newest (highest timestamp/index) are first
-	sort.Sort(sort.Reverse(sort.StringSlice(sstFiles)))
-
-	for _, path := range sstFiles {
-		reader, err := sstable.Open(path)
-		if err != nil {
+	if exists && l.opts.ErrorIfExists {
+		return fmt.Errorf("%w: %s", ErrDBExists, l.dir)
+	}
+	if !exists && (l.opts.ErrorIfMissing || l.opts.ReadOnly) {
+		return fmt.Errorf("%w: %s", ErrDBNotFound, l.dir)
+	}
+	l.logNumber, l.walNumber = m.LogNumber, m.LogNumber
+	l.nextFamilyID = m.NextFamilyID
+
+	// 2. Open every family and its SSTables
+	for _, fm := range m.Families {
+		cf := l.newColumnFamily(fm.ID, fm.Name, l.opts.familyOptions(fm.Name))
+		l.families[cf.id] = cf
+		if fm.Comparator != "" && fm.Comparator != cf.opts.Comparator.Name() {
+			return fmt.Errorf("%w: column family %q was created with %q, opened with %q",
+				ErrComparatorMismatch, fm.Name, fm.Comparator, cf.opts.Comparator.Name())
+		}
+		if err := cf.loadTables(fm.Tables); err != nil {
+			return err
+		}
+		if cf.blobFiles, err = cf.blobFileSizes(fm.Blobs); err != nil {
 			return err
 		}
-		lsm.sstTables = append(lsm.sstTables, reader)
 	}
+	l.defaultCF = l.families[0]
+	l.nextFileNumber.Store(m.nextFileNumber(l.families))
+	l.checkOptionsChanges()
+
+	// 3. Replay unflushed writes into the MemTables
+	if err := l.replayWAL(); err != nil {
+		return err
+	}
+	if l.opts.ReadOnly {
+		return nil
+	}
+
+	// 4. Tidy up, then keep appending to the last WAL. If the WALs hold
+	// anything, flush it away instead: a crash may have left a torn batch at
+	// the end, and writes appended after that would never be replayed.
+	l.removeObsoleteFiles()
+	info, err := l.fs.Stat(walPath(l.dir, l.walNumber))
+	pending := l.walNumber > l.logNumber || (err == nil && info.Size() > 0)
+	w, err := wal.NewWithOptions(walPath(l.dir, l.walNumber), l.walOptions())
+	if err != nil {
+		return err
+	}
+	l.wal = w
+	if err := l.saveManifest(); err != nil {
+		return err
+	}
+	if err := l.saveOptions(); err != nil {
+		return err
+	}
+	if pending {
+		return l.flush()
+	}
+	l.updateWriteStall()
 	return nil
 }
 
+// removeObsoleteFiles deletes files the manifest does not reference: WALs
+// that were already flushed, SSTables and blob files from an interrupted flush
+// or compaction, exports an interrupted Import staged, and directories of
+// dropped families. The caller must hold l.mu or be opening the engine.
+func (l *LSM) removeObsoleteFiles() {
+	for _, cf := range l.families {
+		live := make(map[string]bool)
+		for _, sst := range cf.sstTables {
+			live[filepath.Base(sst.Path())] = true
+		}
+		names, _ := l.fs.List(cf.dir)
+		for _, name := range names {
+			if strings.HasSuffix(name, ".sst.tmp") || (filepath.Ext(name) == ".sst" && !live[name]) {
+				path := filepath.Join(cf.dir, name)
+				if l.fs.Remove(path) == nil && filepath.Ext(name) == ".sst" {
+					info := TableFileInfo{ColumnFamily: cf.name, Path: path, Reason: TableObsolete}
+					l.events.push(func(el EventListener) { el.OnTableFileDeleted(info) })
+				}
+			}
+			if number, ok := blob.ParseFileName(name); ok {
+				if _, live := cf.blobFiles[number]; !live {
+					l.fs.Remove(filepath.Join(cf.dir, name))
+				}
+			}
+		}
+	}
+	names, _ := l.fs.List(l.dir)
+	for _, name := range names {
+		if n, ok := parseWALName(name); ok && n < l.logNumber {
+			l.fs.Remove(filepath.Join(l.dir, name))
+		}
+		if strings.HasPrefix(name, "import_") && strings.HasSuffix(name, ".tmp") {
+			l.fs.Remove(filepath.Join(l.dir, name))
+		}
+		if id, ok := parseFamilyDir(name); ok {
+			if _, live := l.families[id]; !live {
+				l.fs.RemoveAll(filepath.Join(l.dir, name))
+			}
+		}
+	}
+}
+
+// newFileNumber allocates the number of a new SSTable or blob file.
+func (l *LSM) newFileNumber() uint64 {
+	return l.nextFileNumber.Add(1) - 1
+}
+
+// walOptions is how the WAL is opened.
+func (l *LSM) walOptions() wal.Options {
+	return wal.Options{NoSync: l.opts.SyncPolicy == SyncNever, FS: l.fs}
+}
+
+// walPath names the WAL with the given number.
+func walPath(dir string, n uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%06d.wal", n))
+}
+
+// parseWALName is the inverse of walPath.
+func parseWALName(name string) (uint64, bool) {
+	if filepath.Ext(name) != ".wal" {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(strings.TrimSuffix(name, ".wal"), 10, 64)
+	return n, err == nil
+}
+
+// parseFamilyDir recognises the "cf_<id>" directories of non-default families.
+func parseFamilyDir(name string) (uint32, bool) {
+	if !strings.HasPrefix(name, "cf_") {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(name, "cf_"), 10, 32)
+	return uint32(id), err == nil
+}
+
+// tableID extracts the number from an SSTable file name such as "12.sst",
+// "compacted_12.sst" or "ingested_12.sst". Tables written before file
+// numbers were allocated carry a timestamp instead.
+func tableID(path string) int64 {
+	name := strings.TrimSuffix(filepath.Base(path), ".sst")
+	name = strings.TrimPrefix(name, "compacted_")
+	name = strings.TrimPrefix(name, "ingested_")
+	id, _ := strconv.ParseInt(name, 10, 64)
+	return id
+}
+
+// isTombstone reports whether an entry marks a deleted key. Tables written
+// before tombstones had their own entry type store the marker as a plain value.
+func isTombstone(e sstable.Entry) bool {
+	return sstable.IsTombstone(e)
+}
+
+// memEntry converts a MemTable node into the entry form used by SSTables.
+func memEntry(n *memtable.Node) sstable.Entry {
+	if n.Type() == sstable.TypeTombstone {
+		return sstable.Entry{Type: sstable.TypeTombstone}
+	}
+	return sstable.Entry{Value: n.Value(), Type: n.Type(), ExpiresAt: n.ExpiresAt()}
+}
+
+// visible turns the entry that decides a key's fate into Get's result.
+func visible(e sstable.Entry, now time.Time) ([]byte, bool, error) {
+	if e.Type == sstable.TypeTombstone || isExpired(e.ExpiresAt, now) {
+		return nil, false, nil
+	}
+	return e.Value, true, nil
+}
+
+// isExpired reports whether an entry with the given expiry is dead at now.
+func isExpired(expiresAt int64, now time.Time) bool {
+	return expiresAt != 0 && now.UnixNano() >= expiresAt
+}
+
 // put adds a key-value pair to the MemTable, and flushes to disk if the MemTable is full.
 func (lsm *LSM) Put(key, value []byte) error {
+	return lsm.PutCF(lsm.defaultCF, key, value)
+}
+
+// PutCF is like Put for the column family cf.
+func (lsm *LSM) PutCF(cf *ColumnFamily, key, value []byte) error {
+	return lsm.write([]batchOp{{cf: cf, key: key, value: value, kind: sstable.TypeValue}})
+}
+
+// PutWithTTL adds a key-value pair that disappears once ttl has elapsed.
+// Expired entries read as absent straight away and are physically removed by compaction.
+func (lsm *LSM) PutWithTTL(key, value []byte, ttl time.Duration) error {
+	return lsm.PutWithTTLCF(lsm.defaultCF, key, value, ttl)
+}
+
+// PutWithTTLCF is like PutWithTTL for the column family cf.
+func (lsm *LSM) PutWithTTLCF(cf *ColumnFamily, key, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("ttl must be positive, got %v", ttl)
+	}
+	lsm.mu.RLock()
+	expiresAt := lsm.clock.Now().Add(ttl).UnixNano()
+	lsm.mu.RUnlock()
+	return lsm.write([]batchOp{{cf: cf, key: key, value: value, kind: sstable.TypeValue, expiresAt: expiresAt}})
+}
+
+// SetClock replaces the clock used for TTL expiry, so tests can advance time deterministically.
+func (lsm *LSM) SetClock(c Clock) {
 	lsm.mu.Lock()
 	defer lsm.mu.Unlock()
-	if err := lsm.memTable.Put(key, value); err != nil {
-		return err
-	}
-	// check if memTable is full and flush if needed
-	if lsm.memTable.IsFull() {
-		return lsm.flush()
-	}
-	return nil
+	lsm.clock = c
+}
+
+// BackgroundError returns the failure that has disabled writes, such as a
+// WAL write that may or may not have reached disk, or nil if writes work.
+// Only reopening the database clears it.
+func (lsm *LSM) BackgroundError() error {
+	lsm.mu.RLock()
+	defer lsm.mu.RUnlock()
+	return lsm.walErr
 }
 
 // Get retrieves a value. It checks MemTable first and then searches through SSTables in order.
 func (lsm *LSM) Get(key []byte) ([]byte, bool, error) {
+	return lsm.GetCF(lsm.defaultCF, key)
+}
+
+// GetCF is like Get for the column family cf.
+func (lsm *LSM) GetCF(cf *ColumnFamily, key []byte) ([]byte, bool, error) {
 	lsm.mu.RLock()
 	defer lsm.mu.RUnlock()
-	// 1. Check MemTable
-	if val, found := lsm.memTable.Get(key); found {
-		if string(val) == "TOMBSTONE_MARKER" {
-			return nil, false, nil
+	if cf.dropped {
+		return nil, false, ErrColumnFamilyDropped
+	}
+	var probes int
+	val, found, err := cf.get(key, lsm.clock.Now(), &probes)
+	lsm.stats.recordGet(probes)
+	return val, found, err
+}
+
+// get looks key up in the family, counting the SSTables it looks in into
+// probes. The caller must hold the engine's lock.
+func (cf *ColumnFamily) get(key []byte, now time.Time, probes *int) ([]byte, bool, error) {
+	lk := lookup{key: key}
+	// 1. Check the MemTables, newest first
+	for _, mem := range cf.memTables() {
+		if node, found := mem.GetNode(key); found && lk.memTable(cf, node, now) {
+			return lk.value, lk.found, lk.err
 		}
-		return val, true, nil
 	}
-	// 2. Check SSTables
-	for _, sst := range lsm.sstTables {
-		val, found, err := sst.Get(key)
+	// 2. Check SSTables. A tombstone or expired entry in a newer table hides anything older.
+	for _, sst := range cf.sstTables {
+		*probes++
+		e, found, err := sst.GetEntry(key)
 		if err != nil {
 			return nil, false, err
 		}
-		if found {
-			if string(val) == "TOMBSTONE_MARKER" {
-				return nil, false, nil
-			}
-			return val, true, nil
+		if found && lk.table(cf, e, now) {
+			return lk.value, lk.found, lk.err
 		}
 	}
-	return nil, false, nil
+	// 3. Operands with no base value underneath
+	lk.finish(cf, now)
+	return lk.value, lk.found, lk.err
 }
 
-// flush writes the current MemTable to a new SSTable on disk and resets the MemTable.
-func (l *LSM) flush() error {
-	// 1. Generate a unique filename based on timestamp
-	sstPath := filepath.Join(l.dir, fmt.Sprintf("%d.sst", time.Now().UnixNano()))
-	writer, err := sstable.NewWriter(sstPath)
-	if err != nil {
-		return err
-	}
+// lookup is a key being looked up, from the MemTable down through the
+// SSTables, until an entry decides what it holds.
+type lookup struct {
+	key []byte
+	// Merge operands seen so far, waiting for the base value beneath them
+	pending *sstable.Entry
+	done    bool
+	value   []byte
+	found   bool
+	// expiresAt is when the value found expires, 0 for never
+	expiresAt int64
+	err       error
+}
 
-	// 2. Iterate over skiplist and write to SSTable
-	it := l.memTable.GetIterator()
-	for node := it; node != nil; node = node.Next() {
-		if err := writer.WritePair(node.Key(), node.Value(), 0); err != nil {
-			return err
+// memTable applies the entry for the key found in the next MemTable down,
+// and reports whether it decides the key.
+func (lk *lookup) memTable(cf *ColumnFamily, node *memtable.Node, now time.Time) bool {
+	e := memEntry(node)
+	if lk.pending != nil {
+		var err error
+		if e, err = cf.foldEntries(lk.key, *lk.pending, e, now); err != nil {
+			return lk.fail(err)
 		}
 	}
+	if e.Type == sstable.TypeMerge {
+		lk.pending = &e
+		return false
+	}
+	lk.value, lk.found, lk.err = visible(e, now)
+	lk.expiresAt = e.ExpiresAt
+	lk.done = true
+	return true
+}
 
-	if err := writer.Close(); err != nil {
-		return err
+// table applies the entry for the key found in the next SSTable down, and
+// reports whether it decides the key.
+func (lk *lookup) table(cf *ColumnFamily, e sstable.Entry, now time.Time) bool {
+	var err error
+	if isTombstone(e) {
+		e = sstable.Entry{Type: sstable.TypeTombstone}
+	}
+	if e.Type == sstable.TypeBlobIndex && lk.pending == nil {
+		if e, err = cf.readBlob(lk.key, e); err != nil {
+			return lk.fail(err)
+		}
+	}
+	if lk.pending != nil {
+		if e, err = cf.foldEntries(lk.key, *lk.pending, e, now); err != nil {
+			return lk.fail(err)
+		}
+	}
+	if e.Type == sstable.TypeMerge {
+		lk.pending = &e
+		return false
 	}
+	lk.value, lk.found, lk.err = visible(e, now)
+	lk.expiresAt = e.ExpiresAt
+	lk.done = true
+	return true
+}
 
-	// 3. Open the newly created sstable for reading
-	reader, err := sstable.Open(sstPath)
+// finish decides the key once every table has been looked in, resolving
+// operands left with no base value underneath.
+func (lk *lookup) finish(cf *ColumnFamily, now time.Time) {
+	if lk.done {
+		return
+	}
+	lk.done = true
+	if lk.pending == nil {
+		return
+	}
+	e, err := cf.resolveMerge(lk.key, *lk.pending)
 	if err != nil {
-		return err
+		lk.err = err
+		return
 	}
+	lk.value, lk.found, lk.err = visible(e, now)
+}
 
-	// Prepend to readers (newest first)
-	l.sstTables = append([]*sstable.Reader{reader}, l.sstTables...)
+// fail decides the key with err.
+func (lk *lookup) fail(err error) bool {
+	lk.err = err
+	lk.done = true
+	return true
+}
 
-	// 4. Reset MemTable and WAL
-	l.memTable.Close()
-	os.Remove(filepath.Join(l.dir, "active.wal"))
+// frozenMemTables are MemTables set aside for a flush, one per family that
+// had writes, and the WAL holding those writes.
+type frozenMemTables struct {
+	walNumber uint64
+	families  []*ColumnFamily
+	mems      []*memtable.MemTable
+}
 
-	newWalPath := filepath.Join(l.dir, "active.wal")
-	newMemTable, err := memtable.NewMemTable(newWalPath, l.maxMemSize)
+// freeze sets every non-empty MemTable aside for a flush, and moves writes
+// on to fresh MemTables and a new WAL, so the flush can write the frozen ones
+// out without holding l.mu. Families share the WAL, so they are frozen
+// together and the WAL can be dropped once they are flushed. It reports
+// whether there was anything to freeze. The caller must hold l.mu.
+func (l *LSM) freeze() (bool, error) {
+	b := &frozenMemTables{walNumber: l.walNumber}
+	for _, cf := range l.familyList() {
+		if !cf.memTable.IsEmpty() {
+			b.families = append(b.families, cf)
+			b.mems = append(b.mems, cf.memTable)
+		}
+	}
+	if len(b.families) == 0 {
+		return false, nil
+	}
+	newWAL, err := wal.NewWithOptions(walPath(l.dir, l.walNumber+1), l.walOptions())
 	if err != nil {
-		return err
+		return false, err
 	}
-	l.memTable = newMemTable
-	return nil
+	// The writes in the old WAL must not be lost while later ones in the
+	// new WAL survive
+	if err := l.wal.Sync(); err != nil {
+		newWAL.Close()
+		l.fs.Remove(walPath(l.dir, l.walNumber+1))
+		l.setWALErr(ErrorDuringFlush, fmt.Errorf("engine: WAL sync failed, writes are disabled: %w", err))
+		return false, err
+	}
+	l.wal.Close()
+	l.wal = newWAL
+	l.walNumber++
+	l.walOffset = 0
+	for _, cf := range b.families {
+		cf.imm = append([]*memtable.MemTable{cf.memTable}, cf.imm...)
+		cf.memTable = memtable.New(cf.opts.MaxMemSize, cf.opts.Comparator.Compare)
+	}
+	l.imm = append(l.imm, b)
+	l.updateWriteStall()
+	return true, nil
 }
 
-func (l *LSM) Close() error {
+// flush freezes every non-empty MemTable and writes it, along with any
+// frozen before, to a new SSTable. The caller must not hold l.mu.
+func (l *LSM) flush() error {
 	l.mu.Lock()
-	defer l.mu.Unlock()
-
-	if err := l.memTable.Close(); err != nil {
+	_, err := l.freeze()
+	l.mu.Unlock()
+	if err != nil {
 		return err
 	}
+	l.flushMu.Lock()
+	defer l.flushMu.Unlock()
+	return l.flushFrozen()
+}
 
-	for _, sst := range l.sstTables {
-		if err := sst.Close(); err != nil {
+// flushFrozen flushes the frozen MemTables, oldest first, until none are
+// left. The caller must hold l.flushMu but not l.mu.
+func (l *LSM) flushFrozen() error {
+	for {
+		l.mu.RLock()
+		if l.closed {
+			l.mu.RUnlock()
+			return ErrClosed
+		}
+		if len(l.imm) == 0 {
+			l.mu.RUnlock()
+			return nil
+		}
+		b, now := l.imm[0], l.clock.Now()
+		l.mu.RUnlock()
+		if err := l.flushMemTables(b, now); err != nil {
 			return err
 		}
 	}
-	return nil
 }
 
-// compact merges two oldeest SSTables into a single one to reduce read amplification.
-// This is a simplified version that just merges the two oldest SSTables without any optimization.
+// flushMemTables writes the MemTables of b to new SSTables without holding
+// l.mu, so reads and writes carry on meanwhile, then installs them. b must be
+// the oldest frozen set. The caller must hold l.flushMu.
+func (l *LSM) flushMemTables(b *frozenMemTables, now time.Time) error {
+	start := time.Now()
+	var info FlushInfo
+	for _, cf := range b.families {
+		info.ColumnFamilies = append(info.ColumnFamilies, cf.name)
+	}
+	begin := info
+	l.events.push(func(el EventListener) { el.OnFlushBegin(begin) })
+	// completed reports the end of the flush, successful or not
+	completed := func(err error) error {
+		info.Duration, info.Err = time.Since(start), err
+		done := info
+		l.events.push(func(el EventListener) { el.OnFlushCompleted(done) })
+		return err
+	}
 
-// Compact merges the two oldest SSTables into a single one to reduce read amplification.
-func (l *LSM) Compact() error {
-	l.mu.Lock()
-	if len(l.sstTables) < 2 {
-		l.mu.Unlock()
-		return nil // Nothing to compact
+	// 1. Write each MemTable out. A family dropped meanwhile has nothing
+	// left to write to.
+	readers := make([]*sstable.Reader, len(b.families))
+	blobs := make([]*blobOutput, len(b.families))
+	discard := func() {
+		for i, r := range readers {
+			if r != nil {
+				r.Close()
+				l.fs.Remove(r.Path())
+				blobs[i].abandon()
+			}
+		}
+	}
+	var filtered filterStats
+	for i, cf := range b.families {
+		filter := cf.newFilterRun(CompactionFilterContext{Flush: true})
+		reader, blobOut, err := cf.writeMemTable(b.mems[i], l.newFileNumber(), now, filter)
+		if err != nil {
+			l.mu.RLock()
+			dropped := cf.dropped
+			l.mu.RUnlock()
+			if dropped {
+				continue
+			}
+			discard()
+			return completed(err)
+		}
+		readers[i], blobs[i] = reader, blobOut
+		f := filter.stats()
+		filtered.removed += f.removed
+		filtered.changed += f.changed
 	}
 
-	// For simplicity, we merge the two oldest (last two in our slice)
-	// In a production DB, this would happen in a background goroutine
-	t1 := l.sstTables[len(l.sstTables)-2]
-	t2 := l.sstTables[len(l.sstTables)-1]
-	l.mu.Unlock()
+	// 2. Install the new tables, below those of MemTables frozen later, and
+	// drop the WALs they replace in one manifest update
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	installed := make([]bool, len(b.families))
+	for i, cf := range b.families {
+		if readers[i] != nil && !cf.dropped {
+			cf.setTables(append([]*sstable.Reader{readers[i]}, cf.sstTables...))
+			cf.addBlobFile(blobs[i])
+			installed[i] = true
+		}
+	}
+	oldLog := l.logNumber
+	l.logNumber = b.walNumber + 1
+	if err := l.saveManifest(); err != nil {
+		l.logNumber = oldLog
+		for i, cf := range b.families {
+			if installed[i] {
+				cf.setTables(cf.sstTables[1:])
+				delete(cf.blobFiles, blobs[i].number)
+			}
+		}
+		discard()
+		return completed(err)
+	}
+	for i, r := range readers {
+		if !installed[i] {
+			if r != nil {
+				r.Close()
+				l.fs.Remove(r.Path())
+				blobs[i].abandon()
+			}
+			continue
+		}
+		created := TableFileInfo{ColumnFamily: b.families[i].name, Path: r.Path(), Size: r.Size(), Reason: TableFlush}
+		l.events.push(func(el EventListener) { el.OnTableFileCreated(created) })
+		info.Outputs = append(info.Outputs, r.Path())
+		info.Bytes += r.Size()
+		if size, ok := blobs[i].created(); ok {
+			info.Bytes += size
+		}
+	}
 
-	// 1. Create a new SSTable for the merged data
-	compactedPath := filepath.Join(l.dir, fmt.Sprintf("compacted_%d.sst", time.Now().UnixNano()))
-	writer, err := sstable.NewWriter(compactedPath)
-	if err != nil {
-		return err
+	// 3. Let go of the MemTables and WALs
+	for _, cf := range b.families {
+		cf.imm = cf.imm[:len(cf.imm)-1]
 	}
+	l.imm = l.imm[1:]
+	for n := oldLog; n < l.logNumber; n++ {
+		l.fs.Remove(walPath(l.dir, n))
+	}
+	l.stats.flushes.Add(1)
+	l.stats.flushBytes.Add(info.Bytes)
+	l.stats.recordFilter(filtered)
+	completed(nil)
+	l.updateWriteStall()
+	l.scheduleCompaction()
+	return nil
+}
 
-	// 2. Perform a Merge Sort between the two SSTables
-	// Since we don't have iterators for SSTables yet, we'll use a simplified
-	// approach: Load keys and merge. (In a real DB, we stream them).
+// setWALErr disables writes with err and reports it. The caller must hold l.mu.
+func (l *LSM) setWALErr(reason BackgroundErrorReason, err error) {
+	l.walErr = err
+	info := BackgroundErrorInfo{Reason: reason, Err: err}
+	l.events.push(func(el EventListener) { el.OnBackgroundError(info) })
+}
 
-	// Implementation Note: To keep this concise, we will use a map to de-duplicate
-	// but in God Mode, you'd use a priority queue for streaming merge.
-	mergedData := make(map[string][]byte)
+// writeMemTable writes mem, a frozen MemTable of the family, to a new SSTable
+// and opens it, passing the entries through filter. Large values go to a blob
+// file of the same number, which the caller must record or abandon.
+func (cf *ColumnFamily) writeMemTable(mem *memtable.MemTable, number uint64, now time.Time, filter *filterRun) (*sstable.Reader, *blobOutput, error) {
+	// 1. Name the table after a fresh file number
+	sstPath := filepath.Join(cf.dir, fmt.Sprintf("%d.sst", number))
+	// Writers wait for flushes, so they go ahead of compactions. l.mu is
+	// not held, so pacing them holds up nobody else.
+	opts := cf.writerOpts
+	opts.IOPriority = ratelimit.High
+	writer, err := sstable.NewWriterWithOptions(sstPath, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	blobOut := cf.newBlobOutput(number, ratelimit.High, nil)
+	fail := func(err error) (*sstable.Reader, *blobOutput, error) {
+		cf.writerOpts.FS.Remove(sstPath)
+		blobOut.abandon()
+		return nil, nil, err
+	}
 
-	// We iterate through both, newer data from t1 (if exists) overrides t2
-	// But since t1 is newer than t2 in our slice logic:
-	l.loadIntoMap(t2, mergedData)
-	l.loadIntoMap(t1, mergedData)
+	// 2. Iterate over skiplist and write to SSTable. Entries that already
+	// expired still have to shadow older tables, so they go down as tombstones.
+	it := mem.GetIterator()
+	for node := it; node != nil; node = node.Next() {
+		e := memEntry(node)
+		if isExpired(e.ExpiresAt, now) {
+			e = sstable.Entry{Type: sstable.TypeTombstone}
+		}
+		if e, err = filter.apply(node.Key(), e); err == nil {
+			e, err = blobOut.store(node.Key(), e)
+		}
+		if err == nil {
+			err = writer.WriteEntry(node.Key(), e)
+		}
+		if err != nil {
+			writer.Close()
+			return fail(err)
+		}
+	}
 
-	// Sort keys to maintain SSTable contract
-	keys := make([]string, 0, len(mergedData))
-	for k := range mergedData {
-		keys = append(keys, k)
+	if err := blobOut.finish(writer); err != nil {
+		writer.Close()
+		return fail(err)
+	}
+	if err := writer.Close(); err != nil {
+		return fail(err)
 	}
-	sort.Strings(keys)
 
-	for _, k := range keys {
-		writer.WritePair([]byte(k), mergedData[k], 0)
+	// 3. Open the newly created sstable for reading
+	reader, err := sstable.OpenWithOptions(sstPath, cf.readerOpts)
+	if err != nil {
+		return fail(err)
 	}
-	writer.Close()
+	return reader, blobOut, nil
+}
+
+// Close stops background work and releases the engine's files and its lock
+// on the directory. Calling it again returns what the first call did.
+func (l *LSM) Close() error {
+	l.closeOnce.Do(func() { l.closeErr = l.close() })
+	return l.closeErr
+}
 
-	// 3. Update the Engine State
+func (l *LSM) close() error {
+	// Stop the background worker before taking the lock, since it may be
+	// waiting on the lock itself to install a compaction result. Writers
+	// waiting for it to catch up give up.
+	l.closeWriteController()
+	close(l.closeCh)
+	l.wg.Wait()
+
+	// Let a flush in progress install its tables
+	l.flushMu.Lock()
+	defer l.flushMu.Unlock()
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	l.closed = true
 
-	// Open the new one
-	newReader, _ := sstable.Open(compactedPath)
+	// The lock goes last, and even if closing something else failed, so
+	// the directory can be reopened
+	if l.lock != nil {
+		defer l.lock.Close()
+	}
 
-	// Remove the two old ones and add the new one
-	l.sstTables = append(l.sstTables[:len(l.sstTables)-2], newReader)
+	if l.wal != nil {
+		if err := l.wal.Close(); err != nil {
+			return err
+		}
+	}
 
+	for _, cf := range l.families {
+		if err := cf.closeTables(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// Helper to load SSTable data into a map for merging
-func (l *LSM) loadIntoMap(r *sstable.Reader, data map[string][]byte) {
-	// In Phase 4, we built the index. We can use it to iterate.
-	for _, entry := range r.GetIndex() {
-		val, found, _ := r.Get(entry.Key)
-		if found {
-			data[string(entry.Key)] = val
-		}
+// Destroy deletes the database in dir and everything else in the directory.
+// It fails with ErrLocked instead if a writer has the database open.
+func Destroy(dir string, opts *Options) error {
+	o := opts.withDefaults()
+	if _, err := o.FS.Stat(dir); os.IsNotExist(err) {
+		return nil
 	}
+	lock, err := lockDir(o.FS, dir)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	return o.FS.RemoveAll(dir)
 }
 
 // Delete inserts a tombstone for the given key.
 func (l *LSM) Delete(key []byte) error {
-	l.mu.Lock()
-	defer l.mu.Unlock()
+	return l.DeleteCF(l.defaultCF, key)
+}
 
-	// A delete is just a Put with a special "Tombstone" value or flag.
-	// For simplicity, we'll use a reserved string or a separate field.
-	return l.memTable.Put(key, []byte("TOMBSTONE_MARKER"))
+// DeleteCF is like Delete for the column family cf.
+func (l *LSM) DeleteCF(cf *ColumnFamily, key []byte) error {
+	// A delete is just a Put with a special "Tombstone" flag.
+	return l.write([]batchOp{{cf: cf, key: key, kind: sstable.TypeTombstone}})
 }
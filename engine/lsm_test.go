@@ -1,15 +1,19 @@
 package engine
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"testing"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
 )
 
 func TestLSM_Basic(t *testing.T) {
 	dir := "storage_test"
 	defer os.RemoveAll(dir)
 
-	lsm, err := New(dir, 1024) // 1KB threshold
+	lsm, err := New(dir, &Options{MaxMemSize: 1024}) // 1KB threshold
 	if err != nil {
 		t.Fatalf("Failed to init LSM: %v", err)
 	}
@@ -28,8 +32,8 @@ func TestLSM_FlushPersistence(t *testing.T) {
 	defer os.RemoveAll(dir)
 
 	// Set a very small max size to trigger a flush quickly (50 bytes)
-	lsm, _ := New(dir, 50)
-	
+	lsm, _ := New(dir, &Options{MaxMemSize: 50})
+
 	// These writes should exceed 50 bytes and trigger flush()
 	lsm.Put([]byte("key1"), []byte("value_that_is_quite_long_1"))
 	lsm.Put([]byte("key2"), []byte("value_that_is_quite_long_2"))
@@ -39,6 +43,109 @@ func TestLSM_FlushPersistence(t *testing.T) {
 	if !found || string(val) != "value_that_is_quite_long_1" {
 		t.Errorf("Data lost after flush!")
 	}
-    
-    lsm.Close()
+
+	lsm.Close()
+}
+
+func TestLSM_DirectoryLock(t *testing.T) {
+	dir := "storage_lock_test"
+	fs := vfs.NewMem()
+
+	lsm, err := New(dir, &Options{FS: fs})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	lsm.Put([]byte("k"), []byte("v"))
+
+	// A second writer, or destroying the database, must wait for the first
+	if _, err := New(dir, &Options{FS: fs}); !errors.Is(err, ErrLocked) {
+		t.Errorf("Expected ErrLocked for a second writer, got %v", err)
+	}
+	if err := Destroy(dir, &Options{FS: fs}); !errors.Is(err, ErrLocked) {
+		t.Errorf("Expected ErrLocked from Destroy, got %v", err)
+	}
+
+	// A reader can share the directory with the writer
+	ro, err := New(dir, &Options{FS: fs, ReadOnly: true})
+	if err != nil {
+		t.Fatalf("Expected a read-only open next to the writer to work, got %v", err)
+	}
+	if val, found, _ := ro.Get([]byte("k")); !found || string(val) != "v" {
+		t.Errorf("Expected read-only instance to see 'v', got %q", val)
+	}
+	ro.Close()
+
+	// Close releases the lock, and closing again does no harm
+	if err := lsm.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := lsm.Close(); err != nil {
+		t.Errorf("Expected a second Close to return nil, got %v", err)
+	}
+	lsm, err = New(dir, &Options{FS: fs})
+	if err != nil {
+		t.Fatalf("Expected reopening after Close to work, got %v", err)
+	}
+	lsm.Close()
+	if err := Destroy(dir, &Options{FS: fs}); err != nil {
+		t.Fatalf("Destroy failed: %v", err)
+	}
+	if _, err := fs.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Expected Destroy to remove %s, got %v", dir, err)
+	}
+}
+
+func TestLSM_FileNumbers(t *testing.T) {
+	dir := "file_numbers_test"
+	fs := vfs.NewMem()
+	opts := &Options{FS: fs, MaxMemSize: 1 << 20, MinBlobSize: 100}
+	lsm, err := New(dir, opts)
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	numbers := make(map[uint64]bool)
+	flush := func(round int) uint64 {
+		t.Helper()
+		key := fmt.Sprintf("key%d", round)
+		lsm.Put([]byte(key), bigValue(key, "v1"))
+		lsm.flush()
+		number := uint64(tableID(lsm.defaultCF.sstTables[0].Path()))
+		if numbers[number] {
+			t.Fatalf("Round %d: file number %d handed out twice", round, number)
+		}
+		if _, ok := lsm.defaultCF.blobFiles[number]; !ok {
+			t.Errorf("Round %d: expected blob file %d beside its table", round, number)
+		}
+		numbers[number] = true
+		return number
+	}
+
+	// 1. Every flush gets a number of its own, however fast they come
+	last := flush(0)
+	for round := 1; round < 5; round++ {
+		if n := flush(round); n <= last {
+			t.Errorf("Expected file numbers to increase, got %d after %d", n, last)
+		} else {
+			last = n
+		}
+	}
+
+	// 2. Reopening resumes numbering after the last number handed out, also
+	// from a manifest that does not record it yet
+	lsm.Close()
+	m, err := readManifest(fs, dir)
+	if err != nil || m.NextFileNumber <= last {
+		t.Fatalf("Expected the manifest to record a number past %d, got %v (%v)", last, m, err)
+	}
+	m.NextFileNumber = 0
+	if err := writeManifest(fs, dir, m); err != nil {
+		t.Fatalf("Failed to rewrite the manifest: %v", err)
+	}
+	if lsm, err = New(dir, opts); err != nil {
+		t.Fatalf("Failed to reopen: %v", err)
+	}
+	defer lsm.Close()
+	if n := flush(5); n <= last {
+		t.Errorf("Expected a number past %d after reopening, got %d", last, n)
+	}
 }
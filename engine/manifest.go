@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+// manifestName is the file, in the data directory, that records which files are live.
+const manifestName = "MANIFEST"
+
+// manifest is the engine's record of which files are live. It is rewritten
+// atomically (temp file + rename) whenever a flush, compaction or column
+// family change alters that set, so a crash leaves either the old or the new
+// version behind and never a mix. Files on disk that it does not mention are
+// leftovers from an interrupted operation and are removed at open.
+type manifest struct {
+	// LogNumber is the WAL that holds writes not yet flushed; older WALs are obsolete
+	LogNumber    uint64 `json:"log_number"`
+	NextFamilyID uint32 `json:"next_family_id"`
+	// NextFileNumber is the number the next SSTable or blob file gets
+	NextFileNumber uint64           `json:"next_file_number,omitempty"`
+	Families       []familyManifest `json:"families"`
+}
+
+type familyManifest struct {
+	ID         uint32   `json:"id"`
+	Name       string   `json:"name"`
+	Comparator string   `json:"comparator"`
+	Tables     []string `json:"tables"` // file names, newest first
+	Blobs      []string `json:"blobs,omitempty"`
+}
+
+// readManifest loads the manifest in dir. It returns nil if there is none yet.
+func readManifest(fs vfs.FS, dir string) (*manifest, error) {
+	data, err := vfs.ReadFile(fs, filepath.Join(dir, manifestName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	m := &manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("corrupt manifest: %w", err)
+	}
+	return m, nil
+}
+
+// writeManifest replaces the manifest in dir with m.
+func writeManifest(fs vfs.FS, dir string, m *manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(fs, filepath.Join(dir, manifestName), data)
+}
+
+// currentManifest describes the engine's live state. The caller must hold l.mu.
+func (l *LSM) currentManifest() *manifest {
+	m := &manifest{LogNumber: l.logNumber, NextFamilyID: l.nextFamilyID, NextFileNumber: l.nextFileNumber.Load()}
+	for _, cf := range l.familyList() {
+		fm := familyManifest{ID: cf.id, Name: cf.name, Comparator: cf.opts.Comparator.Name(), Tables: []string{}}
+		for _, sst := range cf.sstTables {
+			fm.Tables = append(fm.Tables, filepath.Base(sst.Path()))
+		}
+		fm.Blobs = cf.blobFileNames()
+		m.Families = append(m.Families, fm)
+	}
+	return m
+}
+
+// saveManifest persists the engine's live state. The caller must hold l.mu.
+func (l *LSM) saveManifest() error {
+	return writeManifest(l.fs, l.dir, l.currentManifest())
+}
+
+// nextFileNumber is where file numbering resumes: past every live table and
+// blob file of families, whose names carried timestamps before the manifest
+// recorded NextFileNumber.
+func (m *manifest) nextFileNumber(families map[uint32]*ColumnFamily) uint64 {
+	next := max(m.NextFileNumber, 1)
+	for _, cf := range families {
+		for _, sst := range cf.sstTables {
+			next = max(next, uint64(tableID(sst.Path()))+1)
+		}
+		for number := range cf.blobFiles {
+			next = max(next, number+1)
+		}
+	}
+	return next
+}
+
+// legacyManifest describes a directory written before the manifest existed:
+// every SSTable in it belongs to the default family, newest first by the
+// timestamp in its name.
+func legacyManifest(fs vfs.FS, dir string) (*manifest, error) {
+	names, err := fs.List(dir)
+	if err != nil {
+		return nil, err
+	}
+	var sstFiles []string
+	for _, name := range names {
+		// .sst stands for "Sorted String Table", a common file format for LSM trees
+		if filepath.Ext(name) == ".sst" {
+			sstFiles = append(sstFiles, name)
+		}
+	}
+	// Sort files so newest (highest timestamp/index) are first. Compacted tables
+	// carry the timestamp of their newest input, so they slot in where their
+	// inputs used to be rather than jumping ahead of newer flushes.
+	sort.SliceStable(sstFiles, func(i, j int) bool {
+		return tableID(sstFiles[i]) > tableID(sstFiles[j])
+	})
+	return &manifest{
+		LogNumber:    1,
+		NextFamilyID: 1,
+		Families: []familyManifest{{
+			ID:     0,
+			Name:   DefaultColumnFamilyName,
+			Tables: append([]string{}, sstFiles...),
+		}},
+	}, nil
+}
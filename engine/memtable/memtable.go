@@ -1,6 +1,7 @@
 package memtable
 
 import (
+	"bytes"
 	"fmt"
 
 	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/wal"
@@ -12,34 +13,59 @@ import (
 // memtable coordinates the SkipList and the Write-Ahead Log (WAL) to ensure data durability and efficient in-memory operations.
 type MemTable struct {
 	list     *SkipList
-	wal      *wal.WAL
+	wal      *wal.WAL // nil when the caller logs writes itself
 	maxSize  int
 	currSize int
 }
 
 // newMemTable initializes a new memTable with the given WAL and maximum size.
 func NewMemTable(walPath string, maxSize int) (*MemTable, error) {
+	return NewMemTableWithComparator(walPath, maxSize, bytes.Compare)
+}
+
+// NewMemTableWithComparator is like NewMemTable but orders keys with compare.
+func NewMemTableWithComparator(walPath string, maxSize int, compare func(a, b []byte) int) (*MemTable, error) {
 	w, err := wal.New(walPath)
 	if err != nil {
 		return nil, fmt.Errorf("could not initialize WAL: %w", err)
 	}
+	m := New(maxSize, compare)
+	m.wal = w
+	return m, nil
+}
+
+// New creates a MemTable without a WAL of its own. The caller is responsible
+// for logging writes before applying them, e.g. to share one WAL between several MemTables.
+func New(maxSize int, compare func(a, b []byte) int) *MemTable {
 	return &MemTable{
-		list:    NewSkipList(),
-		wal:     w,
+		list:    NewSkipListWithComparator(compare),
 		maxSize: maxSize,
-	}, nil
+	}
 }
 
 // Put inserts a key-value pair into the memTable. It first writes to the WAL for durability, then updates the SkipList.
 func (m *MemTable) Put(key, value []byte) error {
+	return m.PutEntry(key, value, 0, 0)
+}
+
+// PutWithExpiry is like Put but the entry expires at the given unix time in nanoseconds (0 means never).
+func (m *MemTable) PutWithExpiry(key, value []byte, expiresAt int64) error {
+	return m.PutEntry(key, value, 0, expiresAt)
+}
+
+// PutEntry is like Put but also stores the entry's type and expiry.
+func (m *MemTable) PutEntry(key, value []byte, entryType byte, expiresAt int64) error {
 	// 1. Write to WAL
-	if err := m.wal.Write(key, value); err != nil {
-		return fmt.Errorf("failed to write to WAL: %w", err)
+	if m.wal != nil {
+		if err := m.wal.WriteRecord(wal.Record{Key: key, Value: value, Type: entryType, ExpiresAt: expiresAt}); err != nil {
+			return fmt.Errorf("failed to write to WAL: %w", err)
+		}
 	}
-	// 2. Update SkipList
-	m.list.Put(key, value)
-
-	// 3. Track size ( simplified: key len + value len )
+	// 2. Update SkipList, and track size ( simplified: key len + value len )
+	if old, found := m.list.GetNode(key); found {
+		m.currSize -= len(old.key) + len(old.value)
+	}
+	m.list.PutEntry(key, value, entryType, expiresAt)
 	m.currSize += len(key) + len(value)
 	return nil
 }
@@ -49,16 +75,39 @@ func (m *MemTable) Get(key []byte) ([]byte, bool) {
 	return m.list.Get(key)
 }
 
+// GetNode is like Get but returns the node, so callers can see the entry's type and expiry.
+func (m *MemTable) GetNode(key []byte) (*Node, bool) {
+	return m.list.GetNode(key)
+}
+
 // IsFull checks if the memTable has reached its maximum size.
 func (m *MemTable) IsFull() bool {
 	return m.currSize >= m.maxSize
 }
 
-// Close closes the WAL file.
+// IsEmpty reports whether the memTable holds no entries.
+func (m *MemTable) IsEmpty() bool {
+	return m.list.head.next[0] == nil
+}
+
+// Size returns the approximate number of bytes held by the memTable.
+func (m *MemTable) Size() int {
+	return m.currSize
+}
+
+// Close closes the WAL file, if the memTable owns one.
 func (m *MemTable) Close() error {
+	if m.wal == nil {
+		return nil
+	}
 	return m.wal.Close()
 }
 
 func (m *MemTable) GetIterator() *Node {
 	return m.list.head.next[0]
 }
+
+// Seek returns the first node whose key is at or after key, or nil if there is none.
+func (m *MemTable) Seek(key []byte) *Node {
+	return m.list.Seek(key)
+}
@@ -1,6 +1,7 @@
 package memtable
 
 import (
+	"bytes"
 	"os"
 	"testing"
 )
@@ -35,3 +36,49 @@ func TestMemTable_PutAndGet(t *testing.T) {
 		t.Error("MemTable should not be full yet")
 	}
 }
+
+func TestMemTable_PutWithExpiry(t *testing.T) {
+	walPath := "test_memtable_expiry.wal"
+	defer os.Remove(walPath)
+
+	mt, err := NewMemTable(walPath, 1024)
+	if err != nil {
+		t.Fatalf("Failed to create MemTable: %v", err)
+	}
+	defer mt.Close()
+
+	mt.PutWithExpiry([]byte("session"), []byte("token"), 42)
+
+	node, found := mt.GetNode([]byte("session"))
+	if !found || string(node.Value()) != "token" || node.ExpiresAt() != 42 {
+		t.Errorf("Expected token expiring at 42, got %s at %d", string(node.Value()), node.ExpiresAt())
+	}
+
+	// A plain Put clears the expiry
+	mt.Put([]byte("session"), []byte("forever"))
+	if node, _ = mt.GetNode([]byte("session")); node.ExpiresAt() != 0 {
+		t.Errorf("Expected no expiry after Put, got %d", node.ExpiresAt())
+	}
+}
+
+func TestMemTable_Unlogged(t *testing.T) {
+	mt := New(16, bytes.Compare)
+	if !mt.IsEmpty() {
+		t.Error("New MemTable should be empty")
+	}
+
+	mt.PutEntry([]byte("key"), []byte("value"), 1, 0)
+	node, found := mt.GetNode([]byte("key"))
+	if !found || node.Type() != 1 {
+		t.Errorf("Expected entry type 1 to be stored")
+	}
+
+	// Overwriting a key replaces its size instead of adding to it
+	mt.Put([]byte("key"), []byte("v"))
+	if mt.Size() != 4 {
+		t.Errorf("Expected size 4 after overwrite, got %d", mt.Size())
+	}
+	if err := mt.Close(); err != nil {
+		t.Errorf("Close without a WAL failed: %v", err)
+	}
+}
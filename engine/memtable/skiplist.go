@@ -12,9 +12,11 @@ const (
 
 // Node represents a single element in the SkipList
 type Node struct {
-	key   []byte
-	value []byte
-	next  []*Node // Array of pointers to next nodes at different levels
+	key       []byte
+	value     []byte
+	entryType byte    // opaque to the SkipList, interpreted by the engine
+	expiresAt int64   // unix nanoseconds, 0 means the entry never expires
+	next      []*Node // Array of pointers to next nodes at different levels
 }
 
 // Iterator allows for sequential traversal of the SkipList.
@@ -24,8 +26,9 @@ type Iterator struct {
 
 // SkipList is the sorted in-memory structure
 type SkipList struct {
-	head  *Node
-	level int // Current highest level
+	head    *Node
+	level   int                   // Current highest level
+	compare func(a, b []byte) int // Key order, bytes.Compare by default
 }
 
 // Key is a getter for the unexported key field
@@ -38,6 +41,16 @@ func (n *Node) Value() []byte {
 	return n.value
 }
 
+// Type returns the entry type stored with the node
+func (n *Node) Type() byte {
+	return n.entryType
+}
+
+// ExpiresAt returns when the entry expires as unix nanoseconds, or 0 if it never does
+func (n *Node) ExpiresAt() int64 {
+	return n.expiresAt
+}
+
 // Next returns the next node at level 0 (for iteration)
 func (n *Node) Next() *Node {
 	return n.next[0]
@@ -45,9 +58,15 @@ func (n *Node) Next() *Node {
 
 // NewSkipList initializes a new SkipList with a dummy head node
 func NewSkipList() *SkipList {
+	return NewSkipListWithComparator(bytes.Compare)
+}
+
+// NewSkipListWithComparator is like NewSkipList but orders keys with compare
+func NewSkipListWithComparator(compare func(a, b []byte) int) *SkipList {
 	return &SkipList{
-		head:  &Node{next: make([]*Node, MaxLevel)},
-		level: 0,
+		head:    &Node{next: make([]*Node, MaxLevel)},
+		level:   0,
+		compare: compare,
 	}
 }
 
@@ -62,12 +81,23 @@ func randomLevel() int {
 
 // Put inserts or updates a key-value pair
 func (s *SkipList) Put(key, value []byte) {
+	s.PutWithExpiry(key, value, 0)
+}
+
+// PutWithExpiry inserts or updates a key-value pair that expires at the given
+// unix time in nanoseconds (0 means never)
+func (s *SkipList) PutWithExpiry(key, value []byte, expiresAt int64) {
+	s.PutEntry(key, value, 0, expiresAt)
+}
+
+// PutEntry inserts or updates a key with its value and metadata
+func (s *SkipList) PutEntry(key, value []byte, entryType byte, expiresAt int64) {
 	update := make([]*Node, MaxLevel)
 	curr := s.head
 
 	// 1. Find the position for the new node
 	for i := s.level; i >= 0; i-- {
-		for curr.next[i] != nil && bytes.Compare(curr.next[i].key, key) < 0 {
+		for curr.next[i] != nil && s.compare(curr.next[i].key, key) < 0 {
 			curr = curr.next[i]
 		}
 		update[i] = curr
@@ -76,8 +106,10 @@ func (s *SkipList) Put(key, value []byte) {
 	curr = curr.next[0]
 
 	// 2. If key exists, update value
-	if curr != nil && bytes.Equal(curr.key, key) {
+	if curr != nil && s.compare(curr.key, key) == 0 {
 		curr.value = value
+		curr.entryType = entryType
+		curr.expiresAt = expiresAt
 		return
 	}
 
@@ -91,9 +123,11 @@ func (s *SkipList) Put(key, value []byte) {
 	}
 
 	newNode := &Node{
-		key:   key,
-		value: value,
-		next:  make([]*Node, lvl+1),
+		key:       key,
+		value:     value,
+		entryType: entryType,
+		expiresAt: expiresAt,
+		next:      make([]*Node, lvl+1),
 	}
 
 	for i := 0; i <= lvl; i++ {
@@ -104,18 +138,37 @@ func (s *SkipList) Put(key, value []byte) {
 
 // Get retrieves a value by key
 func (s *SkipList) Get(key []byte) ([]byte, bool) {
+	n := s.find(key)
+	if n == nil {
+		return nil, false
+	}
+	return n.value, true
+}
+
+// GetNode returns the node holding key, so callers can see its metadata
+func (s *SkipList) GetNode(key []byte) (*Node, bool) {
+	n := s.find(key)
+	return n, n != nil
+}
+
+// find returns the node holding key, or nil if it is absent
+func (s *SkipList) find(key []byte) *Node {
+	curr := s.Seek(key)
+	if curr != nil && s.compare(curr.key, key) == 0 {
+		return curr
+	}
+	return nil
+}
+
+// Seek returns the first node whose key is at or after key, or nil if there is none
+func (s *SkipList) Seek(key []byte) *Node {
 	curr := s.head
 	for i := s.level; i >= 0; i-- {
-		for curr.next[i] != nil && bytes.Compare(curr.next[i].key, key) < 0 {
+		for curr.next[i] != nil && s.compare(curr.next[i].key, key) < 0 {
 			curr = curr.next[i]
 		}
 	}
-	curr = curr.next[0]
-
-	if curr != nil && bytes.Equal(curr.key, key) {
-		return curr.value, true
-	}
-	return nil, false
+	return curr.next[0]
 }
 
 // NewIterator returns an iterator for the SkipList
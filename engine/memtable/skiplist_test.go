@@ -50,3 +50,37 @@ func TestSkipList_Ordering(t *testing.T) {
 		curr = curr.next[0]
 	}
 }
+
+func TestSkipList_CustomComparator(t *testing.T) {
+	// Reverse bytewise order
+	sl := NewSkipListWithComparator(func(a, b []byte) int { return bytes.Compare(b, a) })
+	sl.Put([]byte("a"), []byte("1"))
+	sl.Put([]byte("c"), []byte("3"))
+	sl.Put([]byte("b"), []byte("2"))
+
+	var got []string
+	for curr := sl.head.next[0]; curr != nil; curr = curr.next[0] {
+		got = append(got, string(curr.key))
+	}
+	if len(got) != 3 || got[0] != "c" || got[1] != "b" || got[2] != "a" {
+		t.Errorf("Expected keys in reverse order, got %v", got)
+	}
+	if val, found := sl.Get([]byte("b")); !found || string(val) != "2" {
+		t.Errorf("Expected 2 for b, got %s", string(val))
+	}
+}
+
+func TestSkipList_Seek(t *testing.T) {
+	sl := NewSkipList()
+	for _, k := range []string{"b", "d", "f"} {
+		sl.Put([]byte(k), []byte("v"))
+	}
+	for key, want := range map[string]string{"a": "b", "b": "b", "c": "d", "f": "f"} {
+		if n := sl.Seek([]byte(key)); n == nil || string(n.Key()) != want {
+			t.Errorf("Expected Seek(%s) to land on %s, got %v", key, want, n)
+		}
+	}
+	if n := sl.Seek([]byte("g")); n != nil {
+		t.Errorf("Expected Seek past the end to return nil, got %s", n.Key())
+	}
+}
@@ -0,0 +1,180 @@
+package engine
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/sstable"
+)
+
+// ErrNoMergeOperator is returned when merge operands are written or read
+// without a MergeOperator registered at open.
+var ErrNoMergeOperator = errors.New("engine: no merge operator registered")
+
+// MergeOperator turns read-modify-write into a blind write. Merge stores an
+// operand instead of a value, and the operator folds operand chains onto the
+// base value whenever the key is read or compacted.
+type MergeOperator interface {
+	// Name identifies the operator.
+	Name() string
+	// FullMerge applies operands, oldest first, to existing. existing is nil
+	// when the key has no live base value.
+	FullMerge(key, existing []byte, operands [][]byte) ([]byte, error)
+	// PartialMerge combines two adjacent operands into one, or reports false
+	// if they can only be applied against a base value.
+	PartialMerge(key, left, right []byte) ([]byte, bool)
+}
+
+// Uint64AddOperator treats values and operands as 8-byte little-endian
+// counters and adds them up.
+type Uint64AddOperator struct{}
+
+func (Uint64AddOperator) Name() string { return "uint64add" }
+
+func (Uint64AddOperator) FullMerge(key, existing []byte, operands [][]byte) ([]byte, error) {
+	var sum uint64
+	if existing != nil {
+		if len(existing) != 8 {
+			return nil, fmt.Errorf("uint64add: value for %q is %d bytes, want 8", key, len(existing))
+		}
+		sum = binary.LittleEndian.Uint64(existing)
+	}
+	for _, op := range operands {
+		if len(op) != 8 {
+			return nil, fmt.Errorf("uint64add: operand for %q is %d bytes, want 8", key, len(op))
+		}
+		sum += binary.LittleEndian.Uint64(op)
+	}
+	return binary.LittleEndian.AppendUint64(nil, sum), nil
+}
+
+func (Uint64AddOperator) PartialMerge(key, left, right []byte) ([]byte, bool) {
+	if len(left) != 8 || len(right) != 8 {
+		return nil, false
+	}
+	return binary.LittleEndian.AppendUint64(nil, binary.LittleEndian.Uint64(left)+binary.LittleEndian.Uint64(right)), true
+}
+
+// StringAppendOperator appends operands to the existing value, separated by Delimiter.
+type StringAppendOperator struct {
+	Delimiter string
+}
+
+// Name records the delimiter too, so LoadOptions restores the operator as
+// it was and a changed delimiter is warned about at open.
+func (o StringAppendOperator) Name() string { return "stringappend:" + strconv.Quote(o.Delimiter) }
+
+func (o StringAppendOperator) FullMerge(key, existing []byte, operands [][]byte) ([]byte, error) {
+	parts := make([]string, 0, len(operands)+1)
+	if existing != nil {
+		parts = append(parts, string(existing))
+	}
+	for _, op := range operands {
+		parts = append(parts, string(op))
+	}
+	return []byte(strings.Join(parts, o.Delimiter)), nil
+}
+
+func (o StringAppendOperator) PartialMerge(key, left, right []byte) ([]byte, bool) {
+	return []byte(string(left) + o.Delimiter + string(right)), true
+}
+
+// Merge records operand against key. The operand is folded onto the key's
+// value by the registered MergeOperator when the key is read or compacted.
+func (l *LSM) Merge(key, operand []byte) error {
+	return l.MergeCF(l.defaultCF, key, operand)
+}
+
+// MergeCF is like Merge for the column family cf, using cf's MergeOperator.
+func (l *LSM) MergeCF(cf *ColumnFamily, key, operand []byte) error {
+	return l.write([]batchOp{{cf: cf, key: key, value: operand, kind: sstable.TypeMerge}})
+}
+
+// foldEntries combines a newer entry for key with the older entry beneath it.
+// Only merge entries look at what is underneath; anything else simply wins.
+// A value produced from a base value keeps that value's expiry.
+func (cf *ColumnFamily) foldEntries(key []byte, newer, older sstable.Entry, now time.Time) (sstable.Entry, error) {
+	if newer.Type != sstable.TypeMerge {
+		return newer, nil
+	}
+	operands := decodeOperands(newer.Value)
+	switch {
+	case older.Type == sstable.TypeMerge:
+		// Still no base value: keep the chain, shortened where possible
+		chain := append(decodeOperands(older.Value), operands...)
+		return sstable.Entry{Type: sstable.TypeMerge, Value: encodeOperands(cf.partialMerge(key, chain))}, nil
+	case older.Type == sstable.TypeTombstone || isExpired(older.ExpiresAt, now):
+		value, err := cf.fullMerge(key, nil, operands)
+		return sstable.Entry{Type: sstable.TypeValue, Value: value}, err
+	default:
+		if older.Type == sstable.TypeBlobIndex {
+			var err error
+			if older, err = cf.readBlob(key, older); err != nil {
+				return older, err
+			}
+		}
+		value, err := cf.fullMerge(key, older.Value, operands)
+		return sstable.Entry{Type: sstable.TypeValue, Value: value, ExpiresAt: older.ExpiresAt}, err
+	}
+}
+
+// resolveMerge turns a merge entry with nothing beneath it into a value.
+func (cf *ColumnFamily) resolveMerge(key []byte, e sstable.Entry) (sstable.Entry, error) {
+	if e.Type != sstable.TypeMerge {
+		return e, nil
+	}
+	value, err := cf.fullMerge(key, nil, decodeOperands(e.Value))
+	return sstable.Entry{Type: sstable.TypeValue, Value: value}, err
+}
+
+func (cf *ColumnFamily) fullMerge(key, existing []byte, operands [][]byte) ([]byte, error) {
+	if cf.opts.MergeOperator == nil {
+		return nil, ErrNoMergeOperator
+	}
+	return cf.opts.MergeOperator.FullMerge(key, existing, operands)
+}
+
+// partialMerge collapses neighbouring operands the operator knows how to combine.
+func (cf *ColumnFamily) partialMerge(key []byte, operands [][]byte) [][]byte {
+	if cf.opts.MergeOperator == nil || len(operands) < 2 {
+		return operands
+	}
+	out := [][]byte{operands[0]}
+	for _, op := range operands[1:] {
+		if combined, ok := cf.opts.MergeOperator.PartialMerge(key, out[len(out)-1], op); ok {
+			out[len(out)-1] = combined
+		} else {
+			out = append(out, op)
+		}
+	}
+	return out
+}
+
+// encodeOperands packs an operand chain, oldest first, as [Len(4)][Operand]...
+func encodeOperands(operands [][]byte) []byte {
+	var buf []byte
+	for _, op := range operands {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(op)))
+		buf = append(buf, op...)
+	}
+	return buf
+}
+
+// decodeOperands is the inverse of encodeOperands.
+func decodeOperands(buf []byte) [][]byte {
+	var operands [][]byte
+	for len(buf) >= 4 {
+		n := binary.LittleEndian.Uint32(buf[0:4])
+		buf = buf[4:]
+		if int(n) > len(buf) {
+			break
+		}
+		operands = append(operands, buf[:n])
+		buf = buf[n:]
+	}
+	return operands
+}
@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+func TestLSM_MergeUint64Add(t *testing.T) {
+	dir := "merge_counter_test"
+	fs := vfs.NewMem()
+
+	lsm, err := New(dir, &Options{FS: fs, MaxMemSize: 1024 * 1024, MergeOperator: Uint64AddOperator{}})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+
+	one := binary.LittleEndian.AppendUint64(nil, 1)
+	key := []byte("hits")
+
+	// 1. Operands spread across two tables and the MemTable
+	lsm.Merge(key, one)
+	lsm.Merge(key, one)
+	lsm.flush()
+	lsm.Merge(key, one)
+	lsm.flush()
+	lsm.Merge(key, one)
+
+	val, found, err := lsm.Get(key)
+	if err != nil || !found || binary.LittleEndian.Uint64(val) != 4 {
+		t.Fatalf("Expected counter 4, got %v (found=%v, err=%v)", val, found, err)
+	}
+
+	// 2. Compaction folds the on-disk operands into a plain value
+	if err := lsm.Compact(); err != nil {
+		t.Fatalf("Compaction failed: %v", err)
+	}
+	e, _, _ := lsm.defaultCF.sstTables[0].GetEntry(key)
+	if e.Type != 0 || binary.LittleEndian.Uint64(e.Value) != 3 {
+		t.Errorf("Expected compacted base value 3, got %+v", e)
+	}
+	val, _, _ = lsm.Get(key)
+	if binary.LittleEndian.Uint64(val) != 4 {
+		t.Errorf("Expected counter 4 after compaction, got %d", binary.LittleEndian.Uint64(val))
+	}
+}
+
+func TestLSM_MergeStringAppend(t *testing.T) {
+	dir := "merge_append_test"
+	fs := vfs.NewMem()
+
+	lsm, err := New(dir, &Options{FS: fs, MaxMemSize: 1024 * 1024, MergeOperator: StringAppendOperator{Delimiter: ","}})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+
+	// Base value on disk, operands in memory
+	lsm.Put([]byte("list"), []byte("a"))
+	lsm.flush()
+	lsm.Merge([]byte("list"), []byte("b"))
+	lsm.Merge([]byte("list"), []byte("c"))
+
+	// A delete resets the chain
+	lsm.Put([]byte("other"), []byte("x"))
+	lsm.Delete([]byte("other"))
+	lsm.Merge([]byte("other"), []byte("y"))
+
+	it, err := lsm.NewIterator()
+	if err != nil {
+		t.Fatalf("Failed to create iterator: %v", err)
+	}
+	defer it.Close()
+	got := map[string]string{}
+	for it.Next() {
+		got[string(it.Key())] = string(it.Value())
+	}
+	if got["list"] != "a,b,c" || got["other"] != "y" {
+		t.Errorf("Unexpected merged view: %v", got)
+	}
+}
+
+func TestLSM_MergeWithoutOperator(t *testing.T) {
+	dir := "merge_no_operator_test"
+	fs := vfs.NewMem()
+
+	lsm, err := New(dir, &Options{FS: fs, MaxMemSize: 1024})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+
+	if err := lsm.Merge([]byte("k"), []byte("v")); !errors.Is(err, ErrNoMergeOperator) {
+		t.Errorf("Expected ErrNoMergeOperator, got %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package engine
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/sstable"
+)
+
+// MultiGetOptions configures MultiGet.
+type MultiGetOptions struct {
+	// Parallel looks the keys up in every SSTable at once, rather than one
+	// table after another with only the keys still undecided. It cuts the
+	// latency of batches that reach deep into the tables, at the cost of
+	// reading tables whose entries turn out to be hidden by newer ones.
+	Parallel bool
+}
+
+// GetResult is what MultiGet found for a key, as Get would return it.
+type GetResult struct {
+	Value []byte
+	Found bool
+	Err   error
+}
+
+// MultiGet looks up several keys of the default column family at once, all
+// as of the same moment, returning a result per key in the order given.
+// Compared to calling Get for each, the lock is taken once, the keys are
+// sorted so each MemTable is walked a single time, and each SSTable is
+// searched with the whole batch of undecided keys, which share filter checks
+// and reads of the blocks they have in common. An error looking up one key
+// is reported in its result; MultiGet itself only fails when the lookup
+// cannot start at all. A nil opts means the defaults.
+func (l *LSM) MultiGet(keys [][]byte, opts *MultiGetOptions) ([]GetResult, error) {
+	return l.MultiGetCF(l.defaultCF, keys, opts)
+}
+
+// MultiGetCF is like MultiGet for the column family cf.
+func (l *LSM) MultiGetCF(cf *ColumnFamily, keys [][]byte, opts *MultiGetOptions) ([]GetResult, error) {
+	if opts == nil {
+		opts = &MultiGetOptions{}
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if cf.dropped {
+		return nil, ErrColumnFamilyDropped
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	now := l.clock.Now()
+
+	// 1. Sort the keys, looking each distinct one up once
+	cmp := cf.opts.Comparator
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return cmp.Compare(keys[order[i]], keys[order[j]]) < 0 })
+	var lookups []*lookup
+	owner := make([]*lookup, len(keys))
+	for _, i := range order {
+		if n := len(lookups); n == 0 || cmp.Compare(lookups[n-1].key, keys[i]) != 0 {
+			lookups = append(lookups, &lookup{key: keys[i]})
+		}
+		owner[i] = lookups[len(lookups)-1]
+	}
+
+	// 2. Walk each MemTable once, newest first, in step with the keys
+	for _, mem := range cf.memTables() {
+		node := mem.Seek(lookups[0].key)
+		for _, lk := range lookups {
+			for node != nil && cmp.Compare(node.Key(), lk.key) < 0 {
+				node = node.Next()
+			}
+			if !lk.done && node != nil && cmp.Compare(node.Key(), lk.key) == 0 {
+				lk.memTable(cf, node, now)
+			}
+		}
+	}
+
+	// 3. Search the SSTables, newest first, with the keys still undecided
+	probes := make(map[*lookup]int, len(lookups))
+	var parallel []tableBatch
+	if rest := undecided(lookups); opts.Parallel && len(rest) > 0 {
+		parallel = cf.searchTables(rest)
+	}
+	for t, sst := range cf.sstTables {
+		var batch tableBatch
+		if parallel != nil {
+			batch = parallel[t]
+		} else if rest := undecided(lookups); len(rest) > 0 {
+			batch = newTableBatch(sst, rest)
+		} else {
+			break
+		}
+		for i, lk := range batch.lookups {
+			if lk.done {
+				continue
+			}
+			probes[lk]++
+			if batch.errs[i] != nil {
+				lk.fail(batch.errs[i])
+			} else if batch.found[i] {
+				lk.table(cf, batch.entries[i], now)
+			}
+		}
+	}
+
+	// 4. Operands with no base value underneath
+	for _, lk := range lookups {
+		lk.finish(cf, now)
+		l.stats.recordGet(probes[lk])
+	}
+	results := make([]GetResult, len(keys))
+	for i, lk := range owner {
+		results[i] = GetResult{Value: lk.value, Found: lk.found, Err: lk.err}
+	}
+	return results, nil
+}
+
+// tableBatch is the outcome of searching one SSTable for a batch of keys.
+type tableBatch struct {
+	lookups []*lookup
+	entries []sstable.Entry
+	found   []bool
+	errs    []error
+}
+
+// newTableBatch searches sst for the keys of lookups, which are in key order.
+func newTableBatch(sst *sstable.Reader, lookups []*lookup) tableBatch {
+	keys := make([][]byte, len(lookups))
+	for i, lk := range lookups {
+		keys[i] = lk.key
+	}
+	b := tableBatch{lookups: lookups}
+	b.entries, b.found, b.errs = sst.GetEntries(keys)
+	return b
+}
+
+// searchTables searches every SSTable of the family for the keys of lookups
+// at once, a few tables at a time. The caller must hold l.mu.
+func (cf *ColumnFamily) searchTables(lookups []*lookup) []tableBatch {
+	batches := make([]tableBatch, len(cf.sstTables))
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	var wg sync.WaitGroup
+	for t, sst := range cf.sstTables {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			batches[t] = newTableBatch(sst, lookups)
+			<-sem
+		}()
+	}
+	wg.Wait()
+	return batches
+}
+
+// undecided returns the lookups still waiting for an entry to decide them.
+func undecided(lookups []*lookup) []*lookup {
+	var rest []*lookup
+	for _, lk := range lookups {
+		if !lk.done {
+			rest = append(rest, lk)
+		}
+	}
+	return rest
+}
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+func TestLSM_MultiGet(t *testing.T) {
+	dir := "multi_get_test"
+	fs := vfs.NewMem()
+	opts := &Options{FS: fs, MaxMemSize: 1 << 20, MinBlobSize: 100, MergeOperator: StringAppendOperator{Delimiter: ","}}
+	lsm, err := New(dir, opts)
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	lsm.SetClock(clock)
+	flush := func() {
+		lsm.flush()
+	}
+
+	// 1. Keys decided in the MemTable, in either table, or across several
+	for i := 0; i < 50; i++ {
+		lsm.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("v1"))
+	}
+	lsm.Put([]byte("blob"), bigValue("blob", "v1"))
+	lsm.Put([]byte("merged"), []byte("base"))
+	lsm.Put([]byte("deleted"), []byte("x"))
+	lsm.PutWithTTL([]byte("expiring"), []byte("x"), time.Second)
+	flush()
+	lsm.Delete([]byte("deleted"))
+	lsm.Merge([]byte("merged"), []byte("a"))
+	lsm.Put([]byte("key10"), []byte("v2"))
+	flush()
+	lsm.Put([]byte("key20"), []byte("v3"))
+	lsm.Merge([]byte("merged"), []byte("b"))
+	lsm.Delete([]byte("key30"))
+	clock.Advance(time.Second)
+
+	keys := [][]byte{
+		[]byte("merged"), []byte("key30"), []byte("blob"), []byte("missing"), []byte("key10"),
+		[]byte("deleted"), []byte("key20"), []byte("expiring"), []byte("key00"), []byte("key10"),
+	}
+	for _, parallel := range []bool{false, true} {
+		gets := lsm.Stats().Gets
+		results, err := lsm.MultiGet(keys, &MultiGetOptions{Parallel: parallel})
+		if err != nil || len(results) != len(keys) {
+			t.Fatalf("parallel=%v: MultiGet failed: %v", parallel, err)
+		}
+		for i, key := range keys {
+			val, found, err := lsm.Get(key)
+			if r := results[i]; string(r.Value) != string(val) || r.Found != found || r.Err != err {
+				t.Errorf("parallel=%v: %s: MultiGet gave %q (%v, %v), Get %q (%v, %v)",
+					parallel, key, r.Value, r.Found, r.Err, val, found, err)
+			}
+		}
+		if r := results[0]; string(r.Value) != "base,a,b" {
+			t.Errorf("parallel=%v: expected merged=base,a,b, got %q", parallel, r.Value)
+		}
+		// The repeated key is looked up once
+		if n := lsm.Stats().Gets - gets - int64(len(keys)); n != 9 {
+			t.Errorf("parallel=%v: expected 9 lookups, got %d", parallel, n)
+		}
+	}
+
+	// 2. A key that cannot be read fails alone
+	lsm.defaultCF.closeBlobs()
+	for name := range lsm.defaultCF.blobFiles {
+		fs.Remove(lsm.defaultCF.blobPath(name))
+	}
+	results, err := lsm.MultiGet([][]byte{[]byte("blob"), []byte("key00")}, nil)
+	if err != nil || results[0].Err == nil || results[1].Err != nil || string(results[1].Value) != "v1" {
+		t.Errorf("Expected only the blob to fail, got %+v (%v)", results, err)
+	}
+
+	// 3. Dropped families are refused outright
+	cf, _ := lsm.CreateColumnFamily("dropped", ColumnFamilyOptions{})
+	lsm.DropColumnFamily(cf)
+	if _, err := lsm.MultiGetCF(cf, keys, nil); !errors.Is(err, ErrColumnFamilyDropped) {
+		t.Errorf("Expected ErrColumnFamilyDropped, got %v", err)
+	}
+}
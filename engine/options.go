@@ -0,0 +1,707 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/ratelimit"
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/sstable"
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+// Defaults applied to zero Options fields.
+const (
+	DefaultMaxMemSize       = 4 << 20
+	DefaultBlockSize        = sstable.DefaultBlockSize
+	DefaultCacheSize        = 8 << 20
+	DefaultFilterBitsPerKey = 10
+)
+
+// lockName is the file, in the data directory, that a writer holds locked
+// while it has the database open.
+const lockName = "LOCK"
+
+// optionsName is the file, in the data directory, that records the options
+// the database was last opened with.
+const optionsName = "OPTIONS"
+
+var (
+	// ErrInvalidOptions is returned by New when Options fail validation.
+	ErrInvalidOptions = errors.New("engine: invalid options")
+	// ErrReadOnly is returned by writes to a database opened with ReadOnly.
+	ErrReadOnly = errors.New("engine: database is read-only")
+	// ErrDBExists is returned by New with ErrorIfExists when the directory already holds a database.
+	ErrDBExists = errors.New("engine: database already exists")
+	// ErrDBNotFound is returned by New with ErrorIfMissing or ReadOnly when there is no database to open.
+	ErrDBNotFound = errors.New("engine: database does not exist")
+	// ErrLocked is returned by New when another writer, in this process or
+	// another one, has the database open.
+	ErrLocked = vfs.ErrLocked
+	// ErrNotSecondary is returned by TryCatchUpWithPrimary on an instance
+	// not opened with OpenAsSecondary.
+	ErrNotSecondary = errors.New("engine: not a secondary instance")
+	// ErrClosed is returned by writes that were held back by a write stall
+	// when the database was closed.
+	ErrClosed = errors.New("engine: database closed")
+)
+
+// SyncPolicy decides when writes to the WAL are forced to disk.
+type SyncPolicy int
+
+const (
+	// SyncAlways fsyncs the WAL before every write returns. It is the default.
+	SyncAlways SyncPolicy = iota
+	// SyncNever leaves flushing the WAL to the OS. Writes survive a crash of
+	// the process but the last few may be lost on power failure.
+	SyncNever
+)
+
+func (p SyncPolicy) String() string {
+	switch p {
+	case SyncAlways:
+		return "always"
+	case SyncNever:
+		return "never"
+	default:
+		return fmt.Sprintf("SyncPolicy(%d)", int(p))
+	}
+}
+
+func (s CompactionStrategy) String() string {
+	switch s {
+	case CompactOldestPair:
+		return "oldest-pair"
+	case CompactAll:
+		return "all"
+	default:
+		return fmt.Sprintf("CompactionStrategy(%d)", int(s))
+	}
+}
+
+// Compression selects how SSTable data blocks are compressed.
+type Compression = sstable.Compression
+
+const (
+	NoCompression    = sstable.NoCompression
+	FlateCompression = sstable.FlateCompression
+)
+
+// Logger receives the engine's warnings and background errors. *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, v ...any)
+}
+
+// Options configures an engine. The zero value, or a nil *Options, opens a
+// database with the defaults, creating it if it does not exist yet.
+type Options struct {
+	// MaxMemSize is how many bytes a MemTable buffers before it is flushed.
+	// Zero means DefaultMaxMemSize. Column families inherit it unless they set their own.
+	MaxMemSize int
+	// SyncPolicy decides when WAL writes reach the disk.
+	SyncPolicy SyncPolicy
+	// CompactionStrategy, Comparator, MergeOperator and
+	// CompactionFilterFactory configure the default column family. See
+	// ColumnFamilyOptions.
+	CompactionStrategy      CompactionStrategy
+	Comparator              Comparator
+	MergeOperator           MergeOperator
+	CompactionFilterFactory CompactionFilterFactory
+	// ColumnFamilies holds the options of the other column families, by name.
+	// Families found in the directory without an entry get default options.
+	ColumnFamilies map[string]ColumnFamilyOptions
+
+	// BlockSize is the uncompressed size of SSTable data blocks. Zero means DefaultBlockSize.
+	BlockSize int
+	// CacheSize is how many bytes of data blocks are kept in memory. Zero
+	// means DefaultCacheSize, a negative value disables the cache.
+	CacheSize int64
+	// FilterBitsPerKey sizes the bloom filter written into every SSTable.
+	// Zero means DefaultFilterBitsPerKey, a negative value disables filters.
+	FilterBitsPerKey int
+	// Compression is applied to the data blocks of new SSTables. Existing
+	// tables stay readable whatever they were written with.
+	Compression Compression
+
+	// Writes are held back while compaction falls behind. Once a column
+	// family has L0SlowdownWritesTrigger sorted runs of SSTables, stretches
+	// of tables whose key ranges do not overlap such as the outputs of one
+	// compaction, or SoftPendingCompactionBytesLimit bytes waiting to be
+	// compacted, writes are delayed to DelayedWriteRate bytes per second; at
+	// L0StopWritesTrigger sorted runs or HardPendingCompactionBytesLimit
+	// bytes they block. Meanwhile the family is compacted in the background
+	// until it is back under the limits. Zero means the Default constants, a
+	// negative value disables the limit.
+	L0SlowdownWritesTrigger         int
+	L0StopWritesTrigger             int
+	SoftPendingCompactionBytesLimit int64
+	HardPendingCompactionBytesLimit int64
+	// Writes are held back the same way while flushes fall behind: a full
+	// MemTable is frozen and flushed while writes go on into a new one, and
+	// once a family has MemTableSlowdownWritesTrigger frozen MemTables
+	// waiting to be flushed writes are delayed, at MemTableStopWritesTrigger
+	// they block. Zero means the Default constants, a negative value
+	// disables the limit.
+	MemTableSlowdownWritesTrigger int
+	MemTableStopWritesTrigger     int
+	// DelayedWriteRate is how many bytes per second delayed writes are
+	// admitted at. Zero means DefaultDelayedWriteRate.
+	DelayedWriteRate int64
+
+	// MaxSubcompactions is how many goroutines a large compaction may be split
+	// across. Each merges its own range of keys into its own tables, and the
+	// results are installed together once all of them are done. Zero means 1.
+	MaxSubcompactions int
+
+	// MinBlobSize is the size from which values are kept out of the
+	// SSTables, in blob files the tables point into, so compaction does not
+	// copy them. Values with a TTL stay inline. Zero keeps every value inline.
+	MinBlobSize int
+	// BlobGCThreshold is the share of a blob file's bytes still referenced
+	// below which compaction moves the rest elsewhere so the file can be
+	// deleted. Zero means DefaultBlobGCThreshold, a negative value never
+	// collects. It must be below 1: at 1 every overwrite would have a file
+	// rewritten.
+	BlobGCThreshold float64
+
+	// RateLimiter paces the disk I/O of flushes and compactions, flushes
+	// first, so bursts of background work do not starve the application.
+	// It can be shared by several databases. An auto-tuned limiter is
+	// raised as compaction debt grows towards SoftPendingCompactionBytesLimit.
+	// Nil does not limit.
+	RateLimiter *ratelimit.Limiter
+
+	// ErrorIfMissing fails with ErrDBNotFound instead of creating a new database.
+	ErrorIfMissing bool
+	// ErrorIfExists fails with ErrDBExists if the directory already holds a database.
+	ErrorIfExists bool
+	// ReadOnly opens the database without ever writing to the directory.
+	// Writes fail with ErrReadOnly. It takes no lock, so it can be opened
+	// while a writer has the database open.
+	ReadOnly bool
+
+	// Logger receives warnings, such as incompatible option changes, and
+	// errors from background work. Nil logs to stderr.
+	Logger Logger
+	// EventListeners are told about flushes, compactions and table files,
+	// see EventListener.
+	EventListeners []EventListener
+	// FS is where the database lives. Nil means the host's filesystem; tests
+	// can pass vfs.NewMem() to stay off the disk.
+	FS vfs.FS
+}
+
+// withDefaults returns a copy of o with zero fields filled in.
+func (o *Options) withDefaults() *Options {
+	opts := &Options{}
+	if o != nil {
+		*opts = *o
+	}
+	if opts.MaxMemSize == 0 {
+		opts.MaxMemSize = DefaultMaxMemSize
+	}
+	if opts.Comparator == nil {
+		opts.Comparator = BytewiseComparator
+	}
+	if opts.BlockSize == 0 {
+		opts.BlockSize = DefaultBlockSize
+	}
+	if opts.CacheSize == 0 {
+		opts.CacheSize = DefaultCacheSize
+	}
+	if opts.FilterBitsPerKey == 0 {
+		opts.FilterBitsPerKey = DefaultFilterBitsPerKey
+	}
+	if opts.L0SlowdownWritesTrigger == 0 {
+		opts.L0SlowdownWritesTrigger = DefaultL0SlowdownWritesTrigger
+	}
+	if opts.L0StopWritesTrigger == 0 {
+		opts.L0StopWritesTrigger = DefaultL0StopWritesTrigger
+	}
+	if opts.MemTableSlowdownWritesTrigger == 0 {
+		opts.MemTableSlowdownWritesTrigger = DefaultMemTableSlowdownWritesTrigger
+	}
+	if opts.MemTableStopWritesTrigger == 0 {
+		opts.MemTableStopWritesTrigger = DefaultMemTableStopWritesTrigger
+	}
+	if opts.SoftPendingCompactionBytesLimit == 0 {
+		opts.SoftPendingCompactionBytesLimit = DefaultSoftPendingCompactionBytesLimit
+	}
+	if opts.HardPendingCompactionBytesLimit == 0 {
+		opts.HardPendingCompactionBytesLimit = DefaultHardPendingCompactionBytesLimit
+	}
+	if opts.DelayedWriteRate == 0 {
+		opts.DelayedWriteRate = DefaultDelayedWriteRate
+	}
+	if opts.MaxSubcompactions == 0 {
+		opts.MaxSubcompactions = 1
+	}
+	if opts.BlobGCThreshold == 0 {
+		opts.BlobGCThreshold = DefaultBlobGCThreshold
+	}
+	if opts.FS == nil {
+		opts.FS = vfs.Default
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.New(os.Stderr, "lsm: ", log.LstdFlags)
+	}
+	return opts
+}
+
+// validate reports the first setting that cannot work.
+func (o *Options) validate() error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s", ErrInvalidOptions, fmt.Sprintf(format, args...))
+	}
+	switch {
+	case o.MaxMemSize < 0:
+		return invalid("MaxMemSize must not be negative, got %d", o.MaxMemSize)
+	case o.BlockSize < 0:
+		return invalid("BlockSize must not be negative, got %d", o.BlockSize)
+	case o.FilterBitsPerKey > 64:
+		return invalid("FilterBitsPerKey must be at most 64, got %d", o.FilterBitsPerKey)
+	case o.SyncPolicy != SyncAlways && o.SyncPolicy != SyncNever:
+		return invalid("unknown %v", o.SyncPolicy)
+	case o.Compression != NoCompression && o.Compression != FlateCompression:
+		return invalid("unknown %v", o.Compression)
+	case o.ErrorIfExists && o.ReadOnly:
+		return invalid("ErrorIfExists and ReadOnly together can never open a database")
+	case o.L0SlowdownWritesTrigger > 0 && o.L0StopWritesTrigger > 0 && o.L0StopWritesTrigger < o.L0SlowdownWritesTrigger:
+		return invalid("L0StopWritesTrigger (%d) must not be below L0SlowdownWritesTrigger (%d)", o.L0StopWritesTrigger, o.L0SlowdownWritesTrigger)
+	case o.MemTableSlowdownWritesTrigger > 0 && o.MemTableStopWritesTrigger > 0 && o.MemTableStopWritesTrigger < o.MemTableSlowdownWritesTrigger:
+		return invalid("MemTableStopWritesTrigger (%d) must not be below MemTableSlowdownWritesTrigger (%d)",
+			o.MemTableStopWritesTrigger, o.MemTableSlowdownWritesTrigger)
+	case o.SoftPendingCompactionBytesLimit > 0 && o.HardPendingCompactionBytesLimit > 0 && o.HardPendingCompactionBytesLimit < o.SoftPendingCompactionBytesLimit:
+		return invalid("HardPendingCompactionBytesLimit (%d) must not be below SoftPendingCompactionBytesLimit (%d)",
+			o.HardPendingCompactionBytesLimit, o.SoftPendingCompactionBytesLimit)
+	case o.DelayedWriteRate < 0:
+		return invalid("DelayedWriteRate must not be negative, got %d", o.DelayedWriteRate)
+	case o.MaxSubcompactions < 0:
+		return invalid("MaxSubcompactions must not be negative, got %d", o.MaxSubcompactions)
+	case o.MinBlobSize < 0:
+		return invalid("MinBlobSize must not be negative, got %d", o.MinBlobSize)
+	case o.BlobGCThreshold >= 1:
+		return invalid("BlobGCThreshold must be below 1, got %g", o.BlobGCThreshold)
+	}
+	if err := validateStrategy(o.CompactionStrategy); err != nil {
+		return invalid("%v", err)
+	}
+	for name, cfo := range o.ColumnFamilies {
+		if name == DefaultColumnFamilyName {
+			return invalid("the default column family is configured by the top-level fields, not ColumnFamilies")
+		}
+		if cfo.MaxMemSize < 0 {
+			return invalid("column family %q: MaxMemSize must not be negative, got %d", name, cfo.MaxMemSize)
+		}
+		if err := validateStrategy(cfo.CompactionStrategy); err != nil {
+			return invalid("column family %q: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func validateStrategy(s CompactionStrategy) error {
+	if s != CompactOldestPair && s != CompactAll {
+		return fmt.Errorf("unknown %v", s)
+	}
+	return nil
+}
+
+// familyOptions returns the options of the family called name.
+func (o *Options) familyOptions(name string) ColumnFamilyOptions {
+	if name == DefaultColumnFamilyName {
+		return ColumnFamilyOptions{
+			Comparator:              o.Comparator,
+			MergeOperator:           o.MergeOperator,
+			CompactionStrategy:      o.CompactionStrategy,
+			CompactionFilterFactory: o.CompactionFilterFactory,
+		}
+	}
+	return o.ColumnFamilies[name]
+}
+
+// writerOptions is how SSTables are written.
+func (o *Options) writerOptions(cmp Comparator) sstable.WriterOptions {
+	bits := o.FilterBitsPerKey
+	if bits < 0 {
+		bits = 0
+	}
+	return sstable.WriterOptions{
+		Comparator:       cmp,
+		BlockSize:        o.BlockSize,
+		Compression:      o.Compression,
+		FilterBitsPerKey: bits,
+		FS:               o.FS,
+		RateLimiter:      o.RateLimiter,
+		IOPriority:       ratelimit.Low,
+	}
+}
+
+// The OPTIONS file is an INI-style text file rewritten every time the database
+// is opened for writing, or its column families change:
+//
+//	[db]
+//	max_mem_size = 4194304
+//	...
+//	[family "default"]
+//	comparator = bytewise
+//	...
+//
+// Comparators and merge operators are recorded by name.
+
+// encodeOptions renders the options of the engine's live families.
+func (l *LSM) encodeOptions() []byte {
+	var buf bytes.Buffer
+	o := l.opts
+	buf.WriteString("# Options the database was last opened with, rewritten on every open.\n")
+	buf.WriteString("[db]\n")
+	fmt.Fprintf(&buf, "max_mem_size = %d\n", o.MaxMemSize)
+	fmt.Fprintf(&buf, "sync_policy = %v\n", o.SyncPolicy)
+	fmt.Fprintf(&buf, "block_size = %d\n", o.BlockSize)
+	fmt.Fprintf(&buf, "cache_size = %d\n", o.CacheSize)
+	fmt.Fprintf(&buf, "filter_bits_per_key = %d\n", o.FilterBitsPerKey)
+	fmt.Fprintf(&buf, "compression = %v\n", o.Compression)
+	fmt.Fprintf(&buf, "l0_slowdown_writes_trigger = %d\n", o.L0SlowdownWritesTrigger)
+	fmt.Fprintf(&buf, "l0_stop_writes_trigger = %d\n", o.L0StopWritesTrigger)
+	fmt.Fprintf(&buf, "memtable_slowdown_writes_trigger = %d\n", o.MemTableSlowdownWritesTrigger)
+	fmt.Fprintf(&buf, "memtable_stop_writes_trigger = %d\n", o.MemTableStopWritesTrigger)
+	fmt.Fprintf(&buf, "soft_pending_compaction_bytes_limit = %d\n", o.SoftPendingCompactionBytesLimit)
+	fmt.Fprintf(&buf, "hard_pending_compaction_bytes_limit = %d\n", o.HardPendingCompactionBytesLimit)
+	fmt.Fprintf(&buf, "delayed_write_rate = %d\n", o.DelayedWriteRate)
+	fmt.Fprintf(&buf, "max_subcompactions = %d\n", o.MaxSubcompactions)
+	fmt.Fprintf(&buf, "min_blob_size = %d\n", o.MinBlobSize)
+	fmt.Fprintf(&buf, "blob_gc_threshold = %g\n", o.BlobGCThreshold)
+	for _, cf := range l.familyList() {
+		mergeOp := ""
+		if cf.opts.MergeOperator != nil {
+			mergeOp = cf.opts.MergeOperator.Name()
+		}
+		filter := ""
+		if cf.opts.CompactionFilterFactory != nil {
+			filter = cf.opts.CompactionFilterFactory.Name()
+		}
+		fmt.Fprintf(&buf, "\n[family %q]\n", cf.name)
+		fmt.Fprintf(&buf, "comparator = %s\n", cf.opts.Comparator.Name())
+		fmt.Fprintf(&buf, "merge_operator = %s\n", mergeOp)
+		fmt.Fprintf(&buf, "compaction_strategy = %v\n", cf.opts.CompactionStrategy)
+		fmt.Fprintf(&buf, "compaction_filter_factory = %s\n", filter)
+		fmt.Fprintf(&buf, "max_mem_size = %d\n", cf.opts.MaxMemSize)
+	}
+	return buf.Bytes()
+}
+
+// saveOptions persists the options in the data directory. The caller must hold l.mu.
+func (l *LSM) saveOptions() error {
+	return writeFileAtomic(l.fs, filepath.Join(l.dir, optionsName), l.encodeOptions())
+}
+
+// SetOptions changes options of the open database, by the names they have
+// in the OPTIONS file:
+//
+//	l0_slowdown_writes_trigger
+//	l0_stop_writes_trigger
+//	memtable_slowdown_writes_trigger
+//	memtable_stop_writes_trigger
+//	soft_pending_compaction_bytes_limit
+//	hard_pending_compaction_bytes_limit
+//	delayed_write_rate
+//	max_subcompactions
+//	rate_limiter_bytes_per_sec  the base rate of Options.RateLimiter
+//
+// Either every change is applied or, if one is unknown or invalid, none.
+func (l *LSM) SetOptions(changes map[string]string) error {
+	if l.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	o := *l.opts
+	rate := int64(0)
+	for name, value := range changes {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidOptions, name, err)
+		}
+		switch name {
+		case "l0_slowdown_writes_trigger":
+			o.L0SlowdownWritesTrigger = int(n)
+		case "l0_stop_writes_trigger":
+			o.L0StopWritesTrigger = int(n)
+		case "memtable_slowdown_writes_trigger":
+			o.MemTableSlowdownWritesTrigger = int(n)
+		case "memtable_stop_writes_trigger":
+			o.MemTableStopWritesTrigger = int(n)
+		case "soft_pending_compaction_bytes_limit":
+			o.SoftPendingCompactionBytesLimit = n
+		case "hard_pending_compaction_bytes_limit":
+			o.HardPendingCompactionBytesLimit = n
+		case "delayed_write_rate":
+			o.DelayedWriteRate = n
+		case "max_subcompactions":
+			o.MaxSubcompactions = int(n)
+		case "rate_limiter_bytes_per_sec":
+			if o.RateLimiter == nil {
+				return fmt.Errorf("%w: %s: the database has no rate limiter", ErrInvalidOptions, name)
+			}
+			if n <= 0 {
+				return fmt.Errorf("%w: %s must be positive, got %d", ErrInvalidOptions, name, n)
+			}
+			rate = n
+		default:
+			return fmt.Errorf("%w: %q cannot be changed on an open database", ErrInvalidOptions, name)
+		}
+	}
+	// Zero restores the default, as it does when opening
+	d := o.withDefaults()
+	if err := d.validate(); err != nil {
+		return err
+	}
+	// Only these fields change: others are read without the lock
+	l.opts.L0SlowdownWritesTrigger, l.opts.L0StopWritesTrigger = d.L0SlowdownWritesTrigger, d.L0StopWritesTrigger
+	l.opts.MemTableSlowdownWritesTrigger, l.opts.MemTableStopWritesTrigger = d.MemTableSlowdownWritesTrigger, d.MemTableStopWritesTrigger
+	l.opts.SoftPendingCompactionBytesLimit = d.SoftPendingCompactionBytesLimit
+	l.opts.HardPendingCompactionBytesLimit = d.HardPendingCompactionBytesLimit
+	l.opts.DelayedWriteRate = d.DelayedWriteRate
+	l.opts.MaxSubcompactions = d.MaxSubcompactions
+
+	if rate > 0 {
+		l.opts.RateLimiter.SetBytesPerSecond(rate)
+	}
+	l.stall.mu.Lock()
+	l.stall.rate = l.opts.DelayedWriteRate
+	l.stall.mu.Unlock()
+	l.updateWriteStall()
+	if err := l.saveOptions(); err != nil {
+		l.opts.Logger.Printf("failed to update %s: %v", optionsName, err)
+	}
+	return nil
+}
+
+// parseOptionsFile reads an OPTIONS file into its sections: "db" and one
+// per family, keyed by the family's name.
+func parseOptionsFile(fs vfs.FS, path string) (db map[string]string, families map[string]map[string]string, err error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	db = map[string]string{}
+	families = map[string]map[string]string{}
+	var section map[string]string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case line == "[db]":
+			section = db
+		case strings.HasPrefix(line, "[family ") && strings.HasSuffix(line, "]"):
+			name, err := strconv.Unquote(strings.TrimSuffix(strings.TrimPrefix(line, "[family "), "]"))
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s:%d: bad family name: %w", path, n, err)
+			}
+			section = map[string]string{}
+			families[name] = section
+		default:
+			key, value, ok := strings.Cut(line, "=")
+			if !ok || section == nil {
+				return nil, nil, fmt.Errorf("%s:%d: expected key = value", path, n)
+			}
+			section[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return db, families, scanner.Err()
+}
+
+// LoadOptions reads the options a database was last opened with from the
+// OPTIONS file in dir. Built-in comparators and merge operators are restored
+// by name; custom ones are left nil and must be set again before calling New.
+func LoadOptions(dir string) (*Options, error) {
+	return LoadOptionsFS(vfs.Default, dir)
+}
+
+// LoadOptionsFS is like LoadOptions for a database stored in fs. The returned
+// options use fs too.
+func LoadOptionsFS(fs vfs.FS, dir string) (*Options, error) {
+	db, families, err := parseOptionsFile(fs, filepath.Join(dir, optionsName))
+	if err != nil {
+		return nil, err
+	}
+	o := &Options{FS: fs}
+	var errs []error
+	atoi := func(key string) int64 {
+		v, ok := db[key]
+		if !ok {
+			return 0
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+		return n
+	}
+	o.MaxMemSize = int(atoi("max_mem_size"))
+	o.BlockSize = int(atoi("block_size"))
+	o.CacheSize = atoi("cache_size")
+	o.FilterBitsPerKey = int(atoi("filter_bits_per_key"))
+	o.L0SlowdownWritesTrigger = int(atoi("l0_slowdown_writes_trigger"))
+	o.L0StopWritesTrigger = int(atoi("l0_stop_writes_trigger"))
+	o.MemTableSlowdownWritesTrigger = int(atoi("memtable_slowdown_writes_trigger"))
+	o.MemTableStopWritesTrigger = int(atoi("memtable_stop_writes_trigger"))
+	o.SoftPendingCompactionBytesLimit = atoi("soft_pending_compaction_bytes_limit")
+	o.HardPendingCompactionBytesLimit = atoi("hard_pending_compaction_bytes_limit")
+	o.DelayedWriteRate = atoi("delayed_write_rate")
+	o.MaxSubcompactions = int(atoi("max_subcompactions"))
+	o.MinBlobSize = int(atoi("min_blob_size"))
+	if v, ok := db["blob_gc_threshold"]; ok {
+		if o.BlobGCThreshold, err = strconv.ParseFloat(v, 64); err != nil {
+			errs = append(errs, fmt.Errorf("blob_gc_threshold: %w", err))
+		}
+	}
+	if v, ok := db["sync_policy"]; ok {
+		if o.SyncPolicy, err = parseSyncPolicy(v); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if v, ok := db["compression"]; ok {
+		if o.Compression, err = sstable.ParseCompression(v); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		section := families[name]
+		cfo := ColumnFamilyOptions{
+			Comparator:    builtinComparators[section["comparator"]],
+			MergeOperator: builtinMergeOperator(section["merge_operator"]),
+		}
+		if v, ok := section["compaction_strategy"]; ok {
+			if cfo.CompactionStrategy, err = parseCompactionStrategy(v); err != nil {
+				errs = append(errs, fmt.Errorf("family %q: %w", name, err))
+			}
+		}
+		if v, ok := section["max_mem_size"]; ok {
+			if cfo.MaxMemSize, err = strconv.Atoi(v); err != nil {
+				errs = append(errs, fmt.Errorf("family %q: max_mem_size: %w", name, err))
+			}
+		}
+		if name == DefaultColumnFamilyName {
+			o.Comparator, o.MergeOperator, o.CompactionStrategy = cfo.Comparator, cfo.MergeOperator, cfo.CompactionStrategy
+			continue
+		}
+		if o.ColumnFamilies == nil {
+			o.ColumnFamilies = map[string]ColumnFamilyOptions{}
+		}
+		o.ColumnFamilies[name] = cfo
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidOptions, optionsName, errors.Join(errs...))
+	}
+	return o, nil
+}
+
+// builtinComparators and builtinMergeOperators let LoadOptions restore the
+// engine's own implementations by name.
+var builtinComparators = map[string]Comparator{
+	BytewiseComparator.Name():        BytewiseComparator,
+	ReverseBytewiseComparator.Name(): ReverseBytewiseComparator,
+}
+
+var builtinMergeOperators = map[string]MergeOperator{
+	Uint64AddOperator{}.Name(): Uint64AddOperator{},
+}
+
+// builtinMergeOperator restores a built-in merge operator from its name, nil
+// for an unknown one. StringAppendOperator names carry its delimiter.
+func builtinMergeOperator(name string) MergeOperator {
+	if op, ok := builtinMergeOperators[name]; ok {
+		return op
+	}
+	if quoted, ok := strings.CutPrefix(name, "stringappend:"); ok {
+		if delimiter, err := strconv.Unquote(quoted); err == nil {
+			return StringAppendOperator{Delimiter: delimiter}
+		}
+	}
+	return nil
+}
+
+func parseSyncPolicy(s string) (SyncPolicy, error) {
+	for _, p := range []SyncPolicy{SyncAlways, SyncNever} {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown sync policy %q", s)
+}
+
+func parseCompactionStrategy(s string) (CompactionStrategy, error) {
+	for _, c := range []CompactionStrategy{CompactOldestPair, CompactAll} {
+		if c.String() == s {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown compaction strategy %q", s)
+}
+
+// checkOptionsChanges logs a warning for every change since the last open
+// that existing data cannot follow. Comparators are not listed: a comparator
+// change is refused outright when the tables are opened.
+func (l *LSM) checkOptionsChanges() {
+	_, families, err := parseOptionsFile(l.fs, filepath.Join(l.dir, optionsName))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			l.opts.Logger.Printf("ignoring unreadable %s: %v", optionsName, err)
+		}
+		return
+	}
+	for _, cf := range l.familyList() {
+		section, ok := families[cf.name]
+		if !ok {
+			continue
+		}
+		mergeOp := ""
+		if cf.opts.MergeOperator != nil {
+			mergeOp = cf.opts.MergeOperator.Name()
+		}
+		if prev := section["merge_operator"]; prev != mergeOp {
+			l.opts.Logger.Printf("warning: column family %q was last opened with merge operator %q and now with %q; merge operands already written will be folded by the new one",
+				cf.name, prev, mergeOp)
+		}
+	}
+}
+
+// writeFileAtomic replaces path with data so that a crash leaves either the
+// old or the new contents behind.
+func writeFileAtomic(fs vfs.FS, path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	f, err := fs.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return fs.Rename(tmpPath, path)
+}
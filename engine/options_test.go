@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+// captureLogger records every message logged through it.
+type captureLogger struct {
+	lines []string
+}
+
+func (l *captureLogger) Printf(format string, v ...any) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestOptions_Validation(t *testing.T) {
+	dir := "options_validation_test"
+	fs := vfs.NewMem()
+
+	for _, opts := range []*Options{
+		{MaxMemSize: -1},
+		{BlockSize: -1},
+		{SyncPolicy: 7},
+		{Compression: 9},
+		{ErrorIfExists: true, ReadOnly: true},
+		{L0SlowdownWritesTrigger: 10, L0StopWritesTrigger: 5},
+		{MemTableSlowdownWritesTrigger: 4, MemTableStopWritesTrigger: 2},
+		{SoftPendingCompactionBytesLimit: 10, HardPendingCompactionBytesLimit: 5},
+		{DelayedWriteRate: -1},
+		{MaxSubcompactions: -1},
+		{MinBlobSize: -1},
+		{BlobGCThreshold: 1.5},
+		{BlobGCThreshold: 1},
+		{ColumnFamilies: map[string]ColumnFamilyOptions{DefaultColumnFamilyName: {}}},
+	} {
+		if _, err := New(dir, opts); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("Options %+v: expected ErrInvalidOptions, got %v", opts, err)
+		}
+	}
+
+	// A missing database is only created when allowed
+	if _, err := New(dir, &Options{FS: fs, ErrorIfMissing: true}); !errors.Is(err, ErrDBNotFound) {
+		t.Errorf("Expected ErrDBNotFound, got %v", err)
+	}
+	lsm, err := New(dir, &Options{FS: fs})
+	if err != nil {
+		t.Fatalf("Failed to init LSM with default options: %v", err)
+	}
+	lsm.Close()
+	if _, err := New(dir, &Options{FS: fs, ErrorIfExists: true}); !errors.Is(err, ErrDBExists) {
+		t.Errorf("Expected ErrDBExists, got %v", err)
+	}
+}
+
+func TestOptions_PersistedAndReadOnly(t *testing.T) {
+	dir := "options_persist_test"
+	fs := vfs.NewMem()
+	logs := ColumnFamilyOptions{CompactionStrategy: CompactAll, MergeOperator: StringAppendOperator{Delimiter: ", "}}
+
+	lsm, err := New(dir, &Options{
+		FS:            fs,
+		MaxMemSize:    1024,
+		SyncPolicy:    SyncNever,
+		Compression:   FlateCompression,
+		MergeOperator: Uint64AddOperator{},
+		MinBlobSize:   512,
+		ColumnFamilies: map[string]ColumnFamilyOptions{
+			"logs": logs,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	if _, err := lsm.CreateColumnFamily("logs", logs); err != nil {
+		t.Fatalf("Failed to create column family: %v", err)
+	}
+	lsm.Put([]byte("k"), []byte("v"))
+	lsm.Close()
+
+	// 1. The OPTIONS file round-trips, built-in merge operators included
+	loaded, err := LoadOptionsFS(fs, dir)
+	if err != nil {
+		t.Fatalf("LoadOptions failed: %v", err)
+	}
+	if loaded.MaxMemSize != 1024 || loaded.SyncPolicy != SyncNever || loaded.Compression != FlateCompression ||
+		loaded.MinBlobSize != 512 || loaded.BlobGCThreshold != DefaultBlobGCThreshold {
+		t.Errorf("Unexpected loaded options: %+v", loaded)
+	}
+	if _, ok := loaded.MergeOperator.(Uint64AddOperator); !ok {
+		t.Errorf("Expected the uint64add merge operator, got %v", loaded.MergeOperator)
+	}
+	if loaded.ColumnFamilies["logs"].CompactionStrategy != CompactAll {
+		t.Errorf("Expected family 'logs' to compact everything, got %v", loaded.ColumnFamilies["logs"].CompactionStrategy)
+	}
+	if op := loaded.ColumnFamilies["logs"].MergeOperator; op != logs.MergeOperator {
+		t.Errorf("Expected family 'logs' to append with \", \", got %v", op)
+	}
+
+	// 2. Dropping the merge operator, or changing the delimiter it appends
+	// with, is an incompatible change worth a warning
+	logger := &captureLogger{}
+	ro, err := New(dir, &Options{
+		FS:             fs,
+		ReadOnly:       true,
+		Logger:         logger,
+		ColumnFamilies: map[string]ColumnFamilyOptions{"logs": {MergeOperator: StringAppendOperator{Delimiter: ";"}}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to open read-only: %v", err)
+	}
+	defer ro.Close()
+	if len(logger.lines) != 2 || !strings.Contains(logger.lines[0], "merge operator") || !strings.Contains(logger.lines[1], `"logs"`) {
+		t.Errorf("Expected two merge operator warnings, got %q", logger.lines)
+	}
+
+	// 3. Read-only opens see the data but refuse writes
+	if val, found, _ := ro.Get([]byte("k")); !found || string(val) != "v" {
+		t.Errorf("Expected 'v', got '%s'", val)
+	}
+	if err := ro.Put([]byte("k"), []byte("w")); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly, got %v", err)
+	}
+}
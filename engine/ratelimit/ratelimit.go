@@ -0,0 +1,242 @@
+// Package ratelimit paces background I/O so flushes and compactions cannot
+// saturate the disk and starve foreground reads and writes.
+package ratelimit
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Defaults applied to zero Options fields.
+const (
+	DefaultRefillPeriod = 100 * time.Millisecond
+	DefaultFairness     = 10
+)
+
+// Priority orders requests waiting for the same refill.
+type Priority int
+
+const (
+	// Low is for work that can wait, such as compaction.
+	Low Priority = iota
+	// High is for work that holds up writers, such as flushes.
+	High
+	numPriorities
+)
+
+func (p Priority) String() string {
+	switch p {
+	case Low:
+		return "low"
+	case High:
+		return "high"
+	default:
+		return fmt.Sprintf("Priority(%d)", int(p))
+	}
+}
+
+// Options configures a Limiter.
+type Options struct {
+	// BytesPerSecond is the rate requests are granted at.
+	BytesPerSecond int64
+	// RefillPeriod is how often the budget is refilled. Shorter periods
+	// smooth the I/O out, longer ones waste less time waking up. Zero means
+	// DefaultRefillPeriod.
+	RefillPeriod time.Duration
+	// Fairness keeps low-priority requests from starving: once in Fairness
+	// refills they are served before high-priority ones. Zero means
+	// DefaultFairness.
+	Fairness int
+	// MaxBytesPerSecond, when above BytesPerSecond, makes the limiter
+	// auto-tuned: Tune moves the rate between the two as the backlog of
+	// background work grows and shrinks.
+	MaxBytesPerSecond int64
+}
+
+// Limiter is a token bucket shared by everything that does background I/O.
+// Every RefillPeriod it is refilled with a period's worth of bytes, which go
+// to waiting requests in priority order. A nil *Limiter grants everything
+// straight away.
+type Limiter struct {
+	mu   sync.Mutex
+	opts Options
+	// rate is the current rate: BytesPerSecond, or more when auto-tuned
+	rate int64
+	// available is what is left of this period's budget
+	available  int64
+	nextRefill time.Time
+	queues     [numPriorities][]*request
+	bytes      [numPriorities]int64
+	requests   [numPriorities]int64
+}
+
+// request is a caller waiting for its bytes.
+type request struct {
+	n       int64
+	granted bool
+}
+
+// New returns a limiter granting bytesPerSecond with the default options.
+func New(bytesPerSecond int64) *Limiter {
+	return NewWithOptions(Options{BytesPerSecond: bytesPerSecond})
+}
+
+// NewWithOptions is like New but configured by opts.
+func NewWithOptions(opts Options) *Limiter {
+	if opts.RefillPeriod <= 0 {
+		opts.RefillPeriod = DefaultRefillPeriod
+	}
+	if opts.Fairness <= 0 {
+		opts.Fairness = DefaultFairness
+	}
+	if opts.BytesPerSecond <= 0 {
+		opts.BytesPerSecond = 1
+	}
+	return &Limiter{opts: opts, rate: opts.BytesPerSecond}
+}
+
+// Request blocks until n bytes at priority p have been granted. Requests
+// larger than a period's budget are granted a period's worth at a time, so
+// they queue like everyone else instead of waiting for a budget they never get.
+func (l *Limiter) Request(n int64, p Priority) {
+	if l == nil {
+		return
+	}
+	for n > 0 {
+		chunk := min(n, l.burst())
+		l.request(chunk, p)
+		n -= chunk
+	}
+}
+
+// request waits for a single grant of at most one period's budget.
+func (l *Limiter) request(n int64, p Priority) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.bytes[p] += n
+	l.requests[p]++
+	l.refill(time.Now())
+	if l.waiting() == 0 && l.available >= n {
+		l.available -= n
+		return
+	}
+
+	r := &request{n: n}
+	l.queues[p] = append(l.queues[p], r)
+	for !r.granted {
+		wait := time.Until(l.nextRefill)
+		l.mu.Unlock()
+		time.Sleep(wait)
+		l.mu.Lock()
+		l.refill(time.Now())
+	}
+}
+
+// refill starts a new period once the current one is over, handing its
+// budget to the queues. The caller must hold l.mu.
+func (l *Limiter) refill(now time.Time) {
+	if now.Before(l.nextRefill) {
+		return
+	}
+	l.nextRefill = now.Add(l.opts.RefillPeriod)
+	fresh := l.burstLocked()
+	l.available = fresh
+
+	order := []Priority{High, Low}
+	if rand.IntN(l.opts.Fairness) == 0 {
+		order = []Priority{Low, High}
+	}
+	for _, p := range order {
+		for len(l.queues[p]) > 0 {
+			head := l.queues[p][0]
+			// A request made before the rate was lowered can exceed a
+			// whole budget; it is served from a fresh one
+			if head.n > l.available && l.available < fresh {
+				// Waiting its turn, so nothing behind it jumps the queue
+				return
+			}
+			l.available = max(0, l.available-head.n)
+			head.granted = true
+			l.queues[p] = l.queues[p][1:]
+		}
+	}
+}
+
+// waiting is the number of queued requests. The caller must hold l.mu.
+func (l *Limiter) waiting() int {
+	n := 0
+	for _, q := range l.queues {
+		n += len(q)
+	}
+	return n
+}
+
+// burst is the budget of one refill period.
+func (l *Limiter) burst() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.burstLocked()
+}
+
+func (l *Limiter) burstLocked() int64 {
+	return max(1, l.rate*int64(l.opts.RefillPeriod)/int64(time.Second))
+}
+
+// SetBytesPerSecond changes the rate from the next refill on. An
+// auto-tuned limiter keeps its headroom: the maximum moves by as much.
+func (l *Limiter) SetBytesPerSecond(n int64) {
+	if n <= 0 {
+		n = 1
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.opts.MaxBytesPerSecond > l.opts.BytesPerSecond {
+		l.opts.MaxBytesPerSecond += n - l.opts.BytesPerSecond
+	}
+	l.opts.BytesPerSecond, l.rate = n, n
+}
+
+// BytesPerSecond is the rate requests are currently granted at.
+func (l *Limiter) BytesPerSecond() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// AutoTuned reports whether Tune has any effect, see Options.MaxBytesPerSecond.
+func (l *Limiter) AutoTuned() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.opts.MaxBytesPerSecond > l.opts.BytesPerSecond
+}
+
+// Tune sets the rate of an auto-tuned limiter from how far background work
+// is behind, between 0 (caught up: BytesPerSecond) and 1 (far behind:
+// MaxBytesPerSecond). Limiters that are not auto-tuned ignore it.
+func (l *Limiter) Tune(backlog float64) {
+	backlog = min(max(backlog, 0), 1)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lo, hi := l.opts.BytesPerSecond, l.opts.MaxBytesPerSecond
+	if hi <= lo {
+		return
+	}
+	l.rate = lo + int64(backlog*float64(hi-lo))
+}
+
+// TotalBytes is how many bytes have been requested at priority p.
+func (l *Limiter) TotalBytes(p Priority) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.bytes[p]
+}
+
+// TotalRequests is how many requests have been made at priority p, counting
+// each period's worth of a large request separately.
+func (l *Limiter) TotalRequests(p Priority) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.requests[p]
+}
@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter_Paces(t *testing.T) {
+	l := NewWithOptions(Options{BytesPerSecond: 10000, RefillPeriod: 10 * time.Millisecond})
+
+	// 1000 bytes at 10000 bytes per second, granted 100 at a time
+	start := time.Now()
+	l.Request(1000, Low)
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("Expected 1000 bytes to take about 100ms, took %v", elapsed)
+	}
+	if l.TotalBytes(Low) != 1000 || l.TotalRequests(Low) != 10 || l.TotalBytes(High) != 0 {
+		t.Errorf("Unexpected totals: %d bytes in %d requests", l.TotalBytes(Low), l.TotalRequests(Low))
+	}
+
+	// A nil limiter lets everything through
+	var none *Limiter
+	none.Request(1<<40, High)
+}
+
+func TestLimiter_HighPriorityFirst(t *testing.T) {
+	l := NewWithOptions(Options{BytesPerSecond: 2000, RefillPeriod: 50 * time.Millisecond, Fairness: 1 << 30})
+	l.Request(100, Low) // Use up the first period
+
+	order := make(chan Priority, 2)
+	queued := func(n int) {
+		for {
+			l.mu.Lock()
+			w := l.waiting()
+			l.mu.Unlock()
+			if w == n {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	go func() { l.Request(100, Low); order <- Low }()
+	queued(1)
+	go func() { l.Request(100, High); order <- High }()
+	queued(2)
+
+	// Each refill only has room for one of them
+	if first, second := <-order, <-order; first != High || second != Low {
+		t.Errorf("Expected high then low, got %v then %v", first, second)
+	}
+}
+
+func TestLimiter_SetAndTune(t *testing.T) {
+	l := NewWithOptions(Options{BytesPerSecond: 1000, MaxBytesPerSecond: 3000})
+	if !l.AutoTuned() {
+		t.Fatal("Expected the limiter to be auto-tuned")
+	}
+	l.Tune(0.5)
+	if got := l.BytesPerSecond(); got != 2000 {
+		t.Errorf("Expected Tune(0.5) to give 2000, got %d", got)
+	}
+	l.Tune(7)
+	if got := l.BytesPerSecond(); got != 3000 {
+		t.Errorf("Expected Tune to stop at the maximum, got %d", got)
+	}
+
+	// The headroom follows the base rate
+	l.SetBytesPerSecond(5000)
+	l.Tune(1)
+	if got := l.BytesPerSecond(); got != 7000 {
+		t.Errorf("Expected 7000 after raising the base rate, got %d", got)
+	}
+
+	fixed := New(1000)
+	fixed.Tune(1)
+	if fixed.AutoTuned() || fixed.BytesPerSecond() != 1000 {
+		t.Errorf("Expected Tune to leave a fixed limiter alone, got %d", fixed.BytesPerSecond())
+	}
+}
@@ -0,0 +1,184 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/ratelimit"
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+func TestLSM_RateLimiter(t *testing.T) {
+	fs := vfs.NewMem()
+	limiter := ratelimit.New(1 << 30)
+	lsm, err := New("rate_limit_test", &Options{FS: fs, MaxMemSize: 256, CompactionStrategy: CompactAll, RateLimiter: limiter})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+
+	// 1. Flushes write at high priority, every byte of the tables charged
+	for i := 0; i < 200; i++ {
+		lsm.Put([]byte(fmt.Sprintf("key%03d", i)), []byte("value"))
+	}
+	s := lsm.Stats()
+	if s.Flushes == 0 || limiter.TotalBytes(ratelimit.High) != s.FlushBytes {
+		t.Errorf("Expected the %d flushed bytes at high priority, got %d", s.FlushBytes, limiter.TotalBytes(ratelimit.High))
+	}
+
+	// 2. Compactions read and write at low priority
+	if err := lsm.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	s = lsm.Stats()
+	low := limiter.TotalBytes(ratelimit.Low)
+	if low <= s.CompactionBytesWritten || low > s.CompactionBytesWritten+s.CompactionBytesRead {
+		t.Errorf("Expected the compaction's writes and block reads at low priority, got %d (wrote %d, read %d)",
+			low, s.CompactionBytesWritten, s.CompactionBytesRead)
+	}
+}
+
+func TestLSM_RateLimitedFlushDoesNotBlockReads(t *testing.T) {
+	limiter := ratelimit.NewWithOptions(ratelimit.Options{BytesPerSecond: 4096, RefillPeriod: 10 * time.Millisecond})
+	lsm, err := New("rate_limit_flush_test", &Options{FS: vfs.NewMem(), MaxMemSize: 1024, RateLimiter: limiter})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+	flushing := func() bool {
+		lsm.mu.RLock()
+		defer lsm.mu.RUnlock()
+		return len(lsm.imm) > 0
+	}
+
+	// 1. The write that fills the MemTable waits for its flush, which
+	// takes a good fraction of a second at 4KB/s
+	value := make([]byte, 100)
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 10; i++ {
+			if err := lsm.Put([]byte(fmt.Sprintf("key%03d", i)), value); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for !flushing() {
+		if time.Now().After(deadline) {
+			t.Fatal("No flush started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// 2. Meanwhile reads, including of the keys being flushed, and other
+	// writes go ahead
+	start := time.Now()
+	if val, found, err := lsm.Get([]byte("key000")); err != nil || !found || len(val) != len(value) {
+		t.Errorf("Expected key000 from the MemTable being flushed, got %v, %v", found, err)
+	}
+	if err := lsm.Put([]byte("other"), []byte("v")); err != nil {
+		t.Errorf("Put during the flush failed: %v", err)
+	}
+	if s := lsm.Stats(); s.Flushes != 0 || s.MemTableBytes == 0 {
+		t.Errorf("Expected the flush still running, stats: %v", s)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond || !flushing() {
+		t.Errorf("Expected reads and writes to go ahead of the flush, they took %v", elapsed)
+	}
+
+	// 3. The flush completes on its own pace
+	if err := <-done; err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if s := lsm.Stats(); s.Flushes != 1 || limiter.TotalBytes(ratelimit.High) != s.FlushBytes {
+		t.Errorf("Expected one rate-limited flush, stats: %v", s)
+	}
+	if val, found, _ := lsm.Get([]byte("key009")); !found || len(val) != len(value) {
+		t.Errorf("Expected key009 after the flush, got %v", found)
+	}
+}
+
+func TestLSM_SetOptions(t *testing.T) {
+	fs := vfs.NewMem()
+	dir := "set_options_test"
+	limiter := ratelimit.New(1 << 20)
+	lsm, err := New(dir, &Options{FS: fs, MaxMemSize: 128, RateLimiter: limiter})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+	for i := 0; i < 20; i++ {
+		lsm.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("value"))
+	}
+
+	// 1. Bad changes are refused as a whole
+	for _, changes := range []map[string]string{
+		{"max_mem_size": "1"},
+		{"delayed_write_rate": "fast"},
+		{"l0_slowdown_writes_trigger": "10", "l0_stop_writes_trigger": "5"},
+		{"rate_limiter_bytes_per_sec": "0"},
+	} {
+		if err := lsm.SetOptions(changes); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("%v: expected ErrInvalidOptions, got %v", changes, err)
+		}
+	}
+	if lsm.opts.L0SlowdownWritesTrigger != DefaultL0SlowdownWritesTrigger {
+		t.Errorf("A refused change was applied: slowdown trigger %d", lsm.opts.L0SlowdownWritesTrigger)
+	}
+
+	// 2. Good ones take effect straight away and are persisted
+	err = lsm.SetOptions(map[string]string{
+		"rate_limiter_bytes_per_sec":   "4096",
+		"l0_slowdown_writes_trigger":   "1",
+		"delayed_write_rate":           "1000000",
+		"memtable_stop_writes_trigger": "8",
+	})
+	if err != nil {
+		t.Fatalf("SetOptions failed: %v", err)
+	}
+	if limiter.BytesPerSecond() != 4096 {
+		t.Errorf("Expected the limiter at 4096 bytes/s, got %d", limiter.BytesPerSecond())
+	}
+	if s := lsm.Stats(); s.WriteStall != WriteStallDelayed {
+		t.Errorf("Expected the lowered trigger to delay writes, got %v", s.WriteStall)
+	}
+	loaded, err := LoadOptionsFS(fs, dir)
+	if err != nil {
+		t.Fatalf("LoadOptions failed: %v", err)
+	}
+	if loaded.L0SlowdownWritesTrigger != 1 || loaded.DelayedWriteRate != 1000000 || loaded.MemTableStopWritesTrigger != 8 {
+		t.Errorf("Expected the changes in OPTIONS, got %d, %d and %d",
+			loaded.L0SlowdownWritesTrigger, loaded.DelayedWriteRate, loaded.MemTableStopWritesTrigger)
+	}
+}
+
+func TestLSM_RateLimiterAutoTune(t *testing.T) {
+	limiter := ratelimit.NewWithOptions(ratelimit.Options{BytesPerSecond: 1 << 30, MaxBytesPerSecond: 2 << 30})
+	lsm, err := New("rate_limit_tune_test", &Options{
+		FS:                              vfs.NewMem(),
+		MaxMemSize:                      128,
+		SoftPendingCompactionBytesLimit: 1 << 20,
+		RateLimiter:                     limiter,
+	})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+	if limiter.BytesPerSecond() != 1<<30 {
+		t.Fatalf("Expected the base rate without debt, got %d", limiter.BytesPerSecond())
+	}
+
+	// Tables pile up without reaching a limit, so nothing compacts them
+	for i := 0; i < 100; i++ {
+		lsm.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("value"))
+	}
+	pending := lsm.Stats().PendingCompactionBytes
+	want := int64(1<<30) + int64(float64(pending)/float64(1<<20)*float64(1<<30))
+	if pending == 0 || limiter.BytesPerSecond() != want {
+		t.Errorf("Expected %d bytes of debt to raise the rate to %d, got %d", pending, want, limiter.BytesPerSecond())
+	}
+}
@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/memtable"
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/sstable"
+)
+
+// catchUpAttempts bounds how often TryCatchUpWithPrimary starts over when
+// the primary removes a file between reading the manifest and opening it.
+const catchUpAttempts = 5
+
+// OpenReadOnly opens the database in dir without ever writing or deleting a
+// file in it: SSTables are loaded and the WAL is replayed into memory. It can
+// be used while a writer has the database open, and sees the state as of the
+// moment it was opened. opts may be nil; its ReadOnly field is ignored.
+func OpenReadOnly(dir string, opts *Options) (*LSM, error) {
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
+	o.ReadOnly = true
+	return New(dir, &o)
+}
+
+// OpenAsSecondary is like OpenReadOnly, but the instance can follow a primary
+// that keeps writing to dir: each TryCatchUpWithPrimary picks up what the
+// primary has flushed, compacted or logged since.
+func OpenAsSecondary(dir string, opts *Options) (*LSM, error) {
+	l, err := OpenReadOnly(dir, opts)
+	if err != nil {
+		return nil, err
+	}
+	l.secondary = true
+	return l, nil
+}
+
+// TryCatchUpWithPrimary brings a secondary instance up to date: it re-reads
+// the manifest to pick up new, compacted and dropped tables and column
+// families, then tails the WAL for writes that are not flushed yet.
+func (l *LSM) TryCatchUpWithPrimary() error {
+	if !l.secondary {
+		return ErrNotSecondary
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < catchUpAttempts; attempt++ {
+		// A file can vanish under us when the primary flushes or compacts
+		// again in the meantime; the next manifest no longer needs it
+		if err = l.catchUp(); !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return err
+}
+
+// catchUp applies the primary's current manifest and WAL. The caller must hold l.mu.
+func (l *LSM) catchUp() error {
+	m, err := readManifest(l.fs, l.dir)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		return fmt.Errorf("%w: %s", ErrDBNotFound, l.dir)
+	}
+
+	// 1. Open the tables we do not have yet before changing anything, so a
+	// failure leaves the instance as it was
+	tables := make(map[uint32][]*sstable.Reader)
+	blobFiles := make(map[uint32]map[uint64]int64)
+	families := make(map[uint32]*ColumnFamily)
+	var opened []*sstable.Reader
+	fail := func(err error) error {
+		for _, r := range opened {
+			r.Close()
+		}
+		return err
+	}
+	for _, fm := range m.Families {
+		cf, ok := l.families[fm.ID]
+		if !ok {
+			cf = l.newColumnFamily(fm.ID, fm.Name, l.opts.familyOptions(fm.Name))
+			if fm.Comparator != "" && fm.Comparator != cf.opts.Comparator.Name() {
+				return fail(fmt.Errorf("%w: column family %q was created with %q, opened with %q",
+					ErrComparatorMismatch, fm.Name, fm.Comparator, cf.opts.Comparator.Name()))
+			}
+		}
+		families[fm.ID] = cf
+		if blobFiles[fm.ID], err = cf.blobFileSizes(fm.Blobs); err != nil {
+			return fail(err)
+		}
+
+		have := make(map[string]*sstable.Reader)
+		for _, sst := range cf.sstTables {
+			have[filepath.Base(sst.Path())] = sst
+		}
+		for _, name := range fm.Tables {
+			sst, ok := have[name]
+			if !ok {
+				if sst, err = sstable.OpenWithOptions(filepath.Join(cf.dir, name), cf.readerOpts); err != nil {
+					return fail(err)
+				}
+				opened = append(opened, sst)
+			}
+			tables[fm.ID] = append(tables[fm.ID], sst)
+		}
+	}
+
+	// 2. Swap in the new table lists and close what the primary let go of,
+	// once nothing pins it
+	for id, cf := range l.families {
+		live := make(map[*sstable.Reader]bool)
+		for _, sst := range tables[id] {
+			live[sst] = true
+		}
+		for _, sst := range cf.sstTables {
+			if !live[sst] {
+				l.retireTable(cf, sst)
+			}
+		}
+		for number := range cf.blobFiles {
+			if _, ok := blobFiles[id][number]; !ok {
+				l.retireBlob(cf, number)
+			}
+		}
+		if _, ok := families[id]; !ok {
+			cf.dropped = true
+			cf.setTables(nil)
+		}
+	}
+	for id, cf := range families {
+		cf.setTables(tables[id])
+		cf.blobFiles = blobFiles[id]
+	}
+	l.families = families
+	l.defaultCF = families[0]
+	l.nextFamilyID = m.NextFamilyID
+
+	// 3. A new log number means the WALs before it were flushed into the
+	// tables we just opened, so start over from the first one still live
+	if m.LogNumber != l.logNumber {
+		l.logNumber, l.walNumber = m.LogNumber, m.LogNumber
+		l.walOffset = 0
+		for _, cf := range l.families {
+			cf.memTable = memtable.New(cf.opts.MaxMemSize, cf.opts.Comparator.Compare)
+		}
+	}
+	return l.replayWAL()
+}
@@ -0,0 +1,178 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+func TestLSM_OpenReadOnly(t *testing.T) {
+	dir := "readonly_test"
+	fs := vfs.NewMem()
+
+	primary, err := New(dir, &Options{FS: fs, MaxMemSize: 64})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer primary.Close()
+	for i := 0; i < 10; i++ {
+		primary.Put([]byte(fmt.Sprintf("key%d", i)), []byte("value"))
+	}
+	before, _ := fs.List(dir)
+
+	ro, err := OpenReadOnly(dir, &Options{FS: fs})
+	if err != nil {
+		t.Fatalf("OpenReadOnly failed: %v", err)
+	}
+	defer ro.Close()
+
+	// Both flushed and WAL-only keys are visible, nothing can be written and
+	// nothing in the directory changed
+	for i := 0; i < 10; i++ {
+		if _, found, _ := ro.Get([]byte(fmt.Sprintf("key%d", i))); !found {
+			t.Errorf("key%d missing from read-only instance", i)
+		}
+	}
+	if err := ro.Put([]byte("x"), []byte("y")); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly, got %v", err)
+	}
+	if after, _ := fs.List(dir); !reflect.DeepEqual(before, after) {
+		t.Errorf("Read-only open changed the directory: %v -> %v", before, after)
+	}
+	if err := ro.TryCatchUpWithPrimary(); !errors.Is(err, ErrNotSecondary) {
+		t.Errorf("Expected ErrNotSecondary, got %v", err)
+	}
+}
+
+func TestLSM_SecondaryCatchesUp(t *testing.T) {
+	dir := "secondary_test"
+	fs := vfs.NewMem()
+
+	primary, err := New(dir, &Options{FS: fs, MaxMemSize: 256})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer primary.Close()
+	primary.Put([]byte("a"), []byte("1"))
+
+	secondary, err := OpenAsSecondary(dir, &Options{FS: fs})
+	if err != nil {
+		t.Fatalf("OpenAsSecondary failed: %v", err)
+	}
+	defer secondary.Close()
+
+	expect := func(key, want string) {
+		t.Helper()
+		val, found, err := secondary.Get([]byte(key))
+		if err != nil {
+			t.Fatalf("Get(%s) failed: %v", key, err)
+		}
+		if want == "" && found {
+			t.Errorf("Expected %s to be gone, got %q", key, val)
+		} else if want != "" && string(val) != want {
+			t.Errorf("Expected %s=%q, got %q (found %v)", key, want, val, found)
+		}
+	}
+	catchUp := func() {
+		t.Helper()
+		if err := secondary.TryCatchUpWithPrimary(); err != nil {
+			t.Fatalf("TryCatchUpWithPrimary failed: %v", err)
+		}
+	}
+
+	// 1. New writes show up only after catching up, tailed from the WAL
+	primary.Put([]byte("b"), []byte("2"))
+	expect("b", "")
+	catchUp()
+	expect("a", "1")
+	expect("b", "2")
+
+	// 2. Flushes, deletes and compactions are followed through the manifest
+	for i := 0; i < 50; i++ {
+		primary.Put([]byte(fmt.Sprintf("key%02d", i)), []byte(fmt.Sprintf("value%02d", i)))
+	}
+	primary.Delete([]byte("a"))
+	if err := primary.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	primary.Put([]byte("c"), []byte("3"))
+	catchUp()
+	expect("a", "")
+	expect("c", "3")
+	for i := 0; i < 50; i++ {
+		expect(fmt.Sprintf("key%02d", i), fmt.Sprintf("value%02d", i))
+	}
+
+	// 3. So are new column families
+	cf, err := primary.CreateColumnFamily("users", ColumnFamilyOptions{})
+	if err != nil {
+		t.Fatalf("CreateColumnFamily failed: %v", err)
+	}
+	primary.PutCF(cf, []byte("u"), []byte("alice"))
+	catchUp()
+	scf, ok := secondary.GetColumnFamily("users")
+	if !ok {
+		t.Fatal("Secondary did not pick up the new column family")
+	}
+	if val, _, _ := secondary.GetCF(scf, []byte("u")); string(val) != "alice" {
+		t.Errorf("Expected u=alice in the new family, got %q", val)
+	}
+}
+
+func TestLSM_SecondaryKeepsPinnedTables(t *testing.T) {
+	dir := "secondary_pin_test"
+	fs := vfs.NewMem()
+	primary, err := New(dir, &Options{FS: fs, MaxMemSize: 1 << 20})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer primary.Close()
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 20; i++ {
+			primary.Put([]byte(fmt.Sprintf("key%02d", i)), []byte(fmt.Sprintf("value%d", round)))
+		}
+		primary.flush()
+	}
+	secondary, err := OpenAsSecondary(dir, &Options{FS: fs})
+	if err != nil {
+		t.Fatalf("OpenAsSecondary failed: %v", err)
+	}
+	defer secondary.Close()
+
+	// 1. Tables pinned on the secondary stay readable after the primary
+	// compacts them away
+	secondary.mu.Lock()
+	pins := secondary.defaultCF.pin()
+	secondary.mu.Unlock()
+	if err := primary.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if err := secondary.TryCatchUpWithPrimary(); err != nil {
+		t.Fatalf("TryCatchUpWithPrimary failed: %v", err)
+	}
+	for _, sst := range pins.tables {
+		if _, _, err := sst.GetEntry([]byte("key05")); err != nil {
+			t.Errorf("Expected pinned table %s to stay open, got %v", sst.Path(), err)
+		}
+	}
+
+	// 2. Unpinning closes them
+	secondary.mu.Lock()
+	secondary.unpin(pins)
+	retired := len(secondary.defaultCF.retiredTables)
+	secondary.mu.Unlock()
+	if retired != 0 {
+		t.Errorf("Expected no tables left waiting to close, got %d", retired)
+	}
+	for _, sst := range pins.tables {
+		if _, _, err := sst.GetEntry([]byte("key05")); err == nil {
+			t.Errorf("Expected %s closed once unpinned", sst.Path())
+		}
+	}
+	if val, _, _ := secondary.Get([]byte("key05")); string(val) != "value1" {
+		t.Errorf("Expected key05=value1, got %q", val)
+	}
+}
@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/sstable"
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+// ErrKeyOrder is returned when an SSTWriter is given a key that does not
+// come after the previous one.
+var ErrKeyOrder = errors.New("engine: keys out of order")
+
+// SSTWriter builds an SSTable outside of any database, for bulk loading with
+// IngestExternalFile. Keys must be added in strictly ascending order of the
+// comparator of the family the table is for.
+type SSTWriter struct {
+	path string
+	fs   vfs.FS
+	cmp  Comparator
+	w    *sstable.Writer
+	info ExternalFileInfo
+}
+
+// ExternalFileInfo describes a table written by an SSTWriter.
+type ExternalFileInfo struct {
+	Path string
+	// Smallest and Largest are the first and last keys of the table.
+	Smallest, Largest []byte
+	Entries           int
+	Size              int64
+}
+
+// NewSSTWriter creates the table at path. opts supplies the comparator and
+// the table settings (BlockSize, Compression, FilterBitsPerKey and FS); a
+// nil opts means the defaults. Tables for a family with a comparator of its
+// own must be written with that comparator.
+func NewSSTWriter(path string, opts *Options) (*SSTWriter, error) {
+	o := opts.withDefaults()
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	w, err := sstable.NewWriterWithOptions(path, o.writerOptions(o.Comparator))
+	if err != nil {
+		return nil, err
+	}
+	return &SSTWriter{path: path, fs: o.FS, cmp: o.Comparator, w: w, info: ExternalFileInfo{Path: path}}, nil
+}
+
+// Put adds a value for key.
+func (w *SSTWriter) Put(key, value []byte) error {
+	return w.add(key, sstable.Entry{Type: sstable.TypeValue, Value: value})
+}
+
+// Delete adds a tombstone for key, hiding older versions once ingested.
+func (w *SSTWriter) Delete(key []byte) error {
+	return w.add(key, sstable.Entry{Type: sstable.TypeTombstone})
+}
+
+// Merge adds a merge operand for key, folded onto the key's older value by
+// the family's MergeOperator.
+func (w *SSTWriter) Merge(key, operand []byte) error {
+	return w.add(key, sstable.Entry{Type: sstable.TypeMerge, Value: encodeOperands([][]byte{operand})})
+}
+
+func (w *SSTWriter) add(key []byte, e sstable.Entry) error {
+	if w.w == nil {
+		return fmt.Errorf("engine: SSTWriter for %s is finished", w.path)
+	}
+	if w.info.Entries > 0 && w.cmp.Compare(key, w.info.Largest) <= 0 {
+		return fmt.Errorf("%w: %q after %q", ErrKeyOrder, key, w.info.Largest)
+	}
+	if err := w.w.WriteEntry(key, e); err != nil {
+		return err
+	}
+	if w.info.Entries == 0 {
+		w.info.Smallest = append([]byte(nil), key...)
+	}
+	w.info.Largest = append(w.info.Largest[:0], key...)
+	w.info.Entries++
+	return nil
+}
+
+// Finish completes the table and syncs it. A table without entries cannot
+// be ingested, so finishing one fails and removes the file.
+func (w *SSTWriter) Finish() (ExternalFileInfo, error) {
+	if w.w == nil {
+		return ExternalFileInfo{}, fmt.Errorf("engine: SSTWriter for %s is finished", w.path)
+	}
+	if w.info.Entries == 0 {
+		w.Abandon()
+		return ExternalFileInfo{}, fmt.Errorf("engine: no entries were added to %s", w.path)
+	}
+	err := w.w.Close()
+	w.w = nil
+	if err != nil {
+		w.fs.Remove(w.path)
+		return ExternalFileInfo{}, err
+	}
+	info, err := w.fs.Stat(w.path)
+	if err != nil {
+		return ExternalFileInfo{}, err
+	}
+	w.info.Size = info.Size()
+	return w.info, nil
+}
+
+// Abandon discards the table, finished or not.
+func (w *SSTWriter) Abandon() {
+	if w.w != nil {
+		w.w.Close()
+		w.w = nil
+	}
+	w.fs.Remove(w.path)
+}
@@ -0,0 +1,101 @@
+package sstable
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+// Cache is an LRU cache of uncompressed data blocks. One Cache is usually
+// shared by every Reader of an engine, so its capacity bounds the memory
+// spent on hot blocks across all tables.
+type Cache struct {
+	mu       sync.Mutex
+	capacity int64
+	size     int64
+	lru      *list.List // front is most recently used
+	items    map[cacheKey]*list.Element
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// cacheKey identifies a block: the Reader it belongs to and its offset.
+type cacheKey struct {
+	table  uint64
+	offset int64
+}
+
+type cacheEntry struct {
+	key   cacheKey
+	block []byte
+}
+
+// NewCache creates a cache holding up to capacity bytes of blocks.
+func NewCache(capacity int64) *Cache {
+	return &Cache{
+		capacity: capacity,
+		lru:      list.New(),
+		items:    make(map[cacheKey]*list.Element),
+	}
+}
+
+func (c *Cache) get(key cacheKey) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.hits.Add(1)
+	c.lru.MoveToFront(el)
+	return el.Value.(*cacheEntry).block, true
+}
+
+func (c *Cache) add(key cacheKey, block []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.items[key]; ok || int64(len(block)) > c.capacity {
+		return
+	}
+	c.items[key] = c.lru.PushFront(&cacheEntry{key: key, block: block})
+	c.size += int64(len(block))
+	for c.size > c.capacity {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+// evict drops every block of a table, once its Reader is closed.
+func (c *Cache) evict(table uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, el := range c.items {
+		if key.table == table {
+			c.removeElement(el)
+		}
+	}
+}
+
+func (c *Cache) removeElement(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	delete(c.items, e.key)
+	c.size -= int64(len(e.block))
+}
+
+// Size returns the number of bytes of blocks currently cached.
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// Capacity returns the most bytes the cache will hold.
+func (c *Cache) Capacity() int64 {
+	return c.capacity
+}
+
+// Stats returns how many lookups found their block cached and how many did not.
+func (c *Cache) Stats() (hits, misses uint64) {
+	return c.hits.Load(), c.misses.Load()
+}
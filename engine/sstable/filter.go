@@ -0,0 +1,65 @@
+package sstable
+
+// A bloom filter answers "is this key possibly in the table?" with no false
+// negatives. Layout: [Bits...][NumProbes(1)].
+
+// bloomHash hashes a key for the filter (32-bit FNV-1a).
+func bloomHash(key []byte) uint32 {
+	h := uint32(2166136261)
+	for _, b := range key {
+		h ^= uint32(b)
+		h *= 16777619
+	}
+	return h
+}
+
+// newBloomFilter builds a filter over the given key hashes.
+func newBloomFilter(hashes []uint32, bitsPerKey int) []byte {
+	// ln(2) * bitsPerKey probes minimise the false positive rate
+	probes := bitsPerKey * 69 / 100
+	if probes < 1 {
+		probes = 1
+	}
+	if probes > 30 {
+		probes = 30
+	}
+	bits := len(hashes) * bitsPerKey
+	if bits < 64 {
+		bits = 64 // small tables would otherwise see a high false positive rate
+	}
+	nBytes := (bits + 7) / 8
+	bits = nBytes * 8
+
+	filter := make([]byte, nBytes+1)
+	filter[nBytes] = byte(probes)
+	for _, h := range hashes {
+		// Double hashing: derive every probe from one hash
+		delta := h>>17 | h<<15
+		for i := 0; i < probes; i++ {
+			pos := h % uint32(bits)
+			filter[pos/8] |= 1 << (pos % 8)
+			h += delta
+		}
+	}
+	return filter
+}
+
+// bloomMayContain reports whether key may be in the set the filter was built from.
+func bloomMayContain(filter, key []byte) bool {
+	if len(filter) < 2 {
+		return true
+	}
+	nBytes := len(filter) - 1
+	bits := uint32(nBytes * 8)
+	probes := int(filter[nBytes])
+	h := bloomHash(key)
+	delta := h>>17 | h<<15
+	for i := 0; i < probes; i++ {
+		pos := h % bits
+		if filter[pos/8]&(1<<(pos%8)) == 0 {
+			return false
+		}
+		h += delta
+	}
+	return true
+}
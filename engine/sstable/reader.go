@@ -2,10 +2,18 @@ package sstable
 
 import (
 	"bytes"
+	"compress/flate"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
-	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
 )
 
 // reader helps to read sstable file,
@@ -13,89 +21,262 @@ import (
 
 // The reading process is as follows:
 
-// Jump to the last 8 bytes of the file to find where the Index starts.
+// Jump to the end of the file and read the Footer to find where the Index and Properties start.
 
-// Load only the Index into memory.
+// Load only the Index and Properties into memory.
 
 // Use Binary Search on the index to find the exact byte offset of the data.
 
-// Jump to that offset and read the value.
+// Jump to that offset, read (or fetch from the cache) the block, and decode the value.
+
+// ErrComparatorMismatch is returned when a table was written with a different
+// comparator than the one it is being opened with.
+var ErrComparatorMismatch = errors.New("sstable: comparator mismatch")
+
+// ErrCorruptBlock is returned when a data block fails its checksum.
+var ErrCorruptBlock = errors.New("sstable: corrupt block")
+
+// nextReaderID gives every Reader its own namespace in a shared Cache.
+var nextReaderID atomic.Uint64
 
 // Reader allows for efficient reading of an SSTable file.
 type Reader struct {
-	file  *os.File
-	index []IndexEntry
+	file       vfs.File
+	path       string
+	size       int64
+	dataSize   int64 // bytes before the index
+	id         uint64
+	cache      *Cache
+	index      []IndexEntry
+	filter     []byte
+	comparator Comparator
+	props      map[string]string
+
+	statsOnce  sync.Once
+	tombstones int
+	statsErr   error
+}
+
+// ReaderOptions configures a Reader.
+type ReaderOptions struct {
+	// Comparator searches the table. Opening fails with ErrComparatorMismatch
+	// if the table records a different one. Nil skips the check and searches
+	// bytewise, for tools that only Scan the table.
+	Comparator Comparator
+	// Cache keeps recently read blocks in memory. Nil disables caching.
+	Cache *Cache
+	// FS is where the table is read from. Nil means vfs.Default.
+	FS vfs.FS
 }
 
 // Open loads an SSTable file and prepares it for reading.
 func Open(filePath string) (*Reader, error) {
-	f, err := os.Open(filePath)
+	return OpenWithComparator(filePath, BytewiseComparator)
+}
+
+// OpenWithComparator is like Open but searches the table with cmp, and fails
+// with ErrComparatorMismatch if the table records a different comparator.
+// A nil cmp skips the check, for tools that only Scan the table.
+func OpenWithComparator(filePath string, cmp Comparator) (*Reader, error) {
+	return OpenWithOptions(filePath, ReaderOptions{Comparator: cmp})
+}
+
+// OpenWithOptions is like Open but configured by opts.
+func OpenWithOptions(filePath string, opts ReaderOptions) (*Reader, error) {
+	if opts.FS == nil {
+		opts.FS = vfs.Default
+	}
+	f, err := opts.FS.Open(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open SSTable: %w", err)
 	}
-	r := &Reader{file: f}
+	r := &Reader{file: f, path: filePath, id: nextReaderID.Add(1), cache: opts.Cache, comparator: opts.Comparator}
 	if err := r.loadIndex(); err != nil {
 		f.Close()
 		return nil, fmt.Errorf("failed to load index: %w", err)
 	}
+	if opts.Comparator == nil {
+		r.comparator = BytewiseComparator
+	} else if name := r.ComparatorName(); name != opts.Comparator.Name() {
+		f.Close()
+		return nil, fmt.Errorf("%w: %s was written with %q, opened with %q", ErrComparatorMismatch, filePath, name, opts.Comparator.Name())
+	}
 	return r, nil
 }
 
-// loadIndex reads the index from the SSTable file and stores it in memory.
+// loadIndex reads the index, filter and properties from the SSTable file and stores them in memory.
 func (r *Reader) loadIndex() error {
-	// 1. Seek to the last 8 bytes (the footer)
-	_, err := r.file.Seek(-8, io.SeekEnd)
+	info, err := r.file.Stat()
 	if err != nil {
-		return fmt.Errorf("failed to seek to footer: %w", err)
+		return err
+	}
+	size := info.Size()
+	r.size = size
+	if size < 8 {
+		return fmt.Errorf("file too small to be an SSTable")
 	}
 
-	// 2. Read index offset
-	var indexOffset uint64
-	if err := binary.Read(r.file, binary.LittleEndian, &indexOffset); err != nil {
-		return fmt.Errorf("failed to read footer: %w", err)
+	// 1. Read the footer. The magic number tells the three formats apart;
+	// the oldest ends with just the index offset.
+	footer := make([]byte, 32)
+	var magic uint64
+	if size >= 32 {
+		if _, err := r.file.ReadAt(footer, size-32); err != nil {
+			return fmt.Errorf("failed to read footer: %w", err)
+		}
+		magic = binary.LittleEndian.Uint64(footer[24:32])
+	} else if size >= 24 {
+		if _, err := r.file.ReadAt(footer[8:], size-24); err != nil {
+			return fmt.Errorf("failed to read footer: %w", err)
+		}
+		magic = binary.LittleEndian.Uint64(footer[24:32])
+	}
+	var indexOffset, filterOffset, propsOffset, propsEnd int64
+	blocks := false
+	switch magic {
+	case footerMagic:
+		indexOffset = int64(binary.LittleEndian.Uint64(footer[0:8]))
+		filterOffset = int64(binary.LittleEndian.Uint64(footer[8:16]))
+		propsOffset = int64(binary.LittleEndian.Uint64(footer[16:24]))
+		propsEnd = size - 32
+		blocks = true
+	case footerMagicV1:
+		indexOffset = int64(binary.LittleEndian.Uint64(footer[8:16]))
+		propsOffset = int64(binary.LittleEndian.Uint64(footer[16:24]))
+		filterOffset = propsOffset
+		propsEnd = size - 24
+	default:
+		if _, err := r.file.ReadAt(footer[:8], size-8); err != nil {
+			return fmt.Errorf("failed to read footer: %w", err)
+		}
+		indexOffset = int64(binary.LittleEndian.Uint64(footer[0:8]))
+		filterOffset = size - 8
+		propsOffset = size - 8
+		propsEnd = size - 8
+	}
+	if indexOffset < 0 || indexOffset > filterOffset || filterOffset > propsOffset || propsOffset > propsEnd {
+		return fmt.Errorf("corrupt footer")
 	}
+	r.dataSize = indexOffset
 
-	// 3. Seek to the index start
-	_, err = r.file.Seek(int64(indexOffset), io.SeekStart)
-	if err != nil {
-		return fmt.Errorf("failed to seek to index: %w", err)
+	// 2. Read everything between the data and the footer in one go
+	buf := make([]byte, propsEnd-indexOffset)
+	if _, err := r.file.ReadAt(buf, indexOffset); err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+	indexBuf := buf[:filterOffset-indexOffset]
+	if filter := buf[filterOffset-indexOffset : propsOffset-indexOffset]; len(filter) > 0 {
+		r.filter = filter
 	}
 
-	// 4. Read the index entries until the end of file (minus footer)
-	for {
-		var keyLen uint32
-		err := binary.Read(r.file, binary.LittleEndian, &keyLen)
-		if err == io.EOF || err == io.ErrUnexpectedEOF {
-			break
+	// 3. Read the index entries: [KeyLen(4)][BlockOffset(8)][BlockLen(4)][Pos(4)][Key],
+	// or [KeyLen(4)][Offset(8)][Key] in tables without blocks
+	headerLen := 12
+	if blocks {
+		headerLen = 20
+	}
+	for len(indexBuf) >= headerLen {
+		keyLen := int(binary.LittleEndian.Uint32(indexBuf[0:4]))
+		entry := IndexEntry{Offset: int64(binary.LittleEndian.Uint64(indexBuf[4:12]))}
+		if blocks {
+			entry.Length = binary.LittleEndian.Uint32(indexBuf[12:16])
+			entry.Pos = binary.LittleEndian.Uint32(indexBuf[16:20])
 		}
-
-		// If we hit the footer (8 bytes left), stop
-		currPos, _ := r.file.Seek(0, io.SeekCurrent)
-		fileInfo, _ := r.file.Stat()
-		if currPos >= fileInfo.Size()-8 {
-			break
+		if len(indexBuf) < headerLen+keyLen {
+			return fmt.Errorf("corrupt index entry")
 		}
+		entry.Key = append([]byte(nil), indexBuf[headerLen:headerLen+keyLen]...)
+		r.index = append(r.index, entry)
+		indexBuf = indexBuf[headerLen+keyLen:]
+	}
+
+	// 4. Read the properties block, if the table has one
+	if propsEnd == propsOffset {
+		return nil
+	}
+	props, err := decodeProperties(buf[propsOffset-indexOffset:])
+	if err != nil {
+		return err
+	}
+	r.props = props
+	return nil
+}
 
-		var offset uint64
-		binary.Read(r.file, binary.LittleEndian, &offset)
+// decodeProperties parses [Count(4)] then [NameLen(4)][Name][ValueLen(4)][Value] per property.
+func decodeProperties(buf []byte) (map[string]string, error) {
+	next := func() (string, error) {
+		if len(buf) < 4 {
+			return "", fmt.Errorf("corrupt properties block")
+		}
+		n := int(binary.LittleEndian.Uint32(buf[0:4]))
+		if len(buf) < 4+n {
+			return "", fmt.Errorf("corrupt properties block")
+		}
+		v := string(buf[4 : 4+n])
+		buf = buf[4+n:]
+		return v, nil
+	}
+	if len(buf) < 4 {
+		return nil, fmt.Errorf("corrupt properties block")
+	}
+	count := int(binary.LittleEndian.Uint32(buf[0:4]))
+	buf = buf[4:]
+	props := make(map[string]string, count)
+	for i := 0; i < count; i++ {
+		name, err := next()
+		if err != nil {
+			return nil, err
+		}
+		value, err := next()
+		if err != nil {
+			return nil, err
+		}
+		props[name] = value
+	}
+	return props, nil
+}
 
-		key := make([]byte, keyLen)
-		r.file.Read(key)
+// Properties returns the table's recorded properties. Tables written before
+// properties existed return an empty map.
+func (r *Reader) Properties() map[string]string {
+	if r.props == nil {
+		return map[string]string{}
+	}
+	return r.props
+}
 
-		r.index = append(r.index, IndexEntry{Key: key, Offset: int64(offset)})
+// ComparatorName returns the name of the comparator the table was written with.
+func (r *Reader) ComparatorName() string {
+	if name, ok := r.props[PropComparator]; ok {
+		return name
 	}
-	return nil
+	return BytewiseComparator.Name()
 }
 
 // Get retrieves the value associated with the given key using binary search on the index.
 // becoz sstable is sorted so binary search is very efficient
 func (r *Reader) Get(key []byte) ([]byte, bool, error) {
+	e, found, err := r.GetEntry(key)
+	if err != nil || !found || e.Type == TypeTombstone {
+		return nil, false, err
+	}
+	return e.Value, true, nil
+}
+
+// GetEntry is like Get but also reports tombstones, so callers walking several
+// tables can tell "deleted here" apart from "not in this table".
+func (r *Reader) GetEntry(key []byte) (Entry, bool, error) {
+	// The filter rules out most absent keys without a binary search or disk read
+	if r.filter != nil && !bloomMayContain(r.filter, key) {
+		return Entry{}, false, nil
+	}
+
 	// Binary search on the index
 	low, high := 0, len(r.index)-1
 	var foundEntry *IndexEntry
 	for low <= high {
 		mid := low + (high-low)/2
-		cmp := bytes.Compare(r.index[mid].Key, key)
+		cmp := r.comparator.Compare(r.index[mid].Key, key)
 		if cmp == 0 {
 			foundEntry = &r.index[mid]
 			break
@@ -106,39 +287,302 @@ func (r *Reader) Get(key []byte) ([]byte, bool, error) {
 		}
 	}
 	if foundEntry == nil {
-		return nil, false, nil // Key not found
+		return Entry{}, false, nil // Key not found
+	}
+	return r.readEntry(*foundEntry)
+}
+
+// GetEntries is like GetEntry for a batch of keys, which must be sorted in
+// the table's order. Each key's search of the index starts where the
+// previous one ended, and keys in the same data block share a single read of
+// it. The i-th results belong to keys[i]; an error only fails its own key.
+func (r *Reader) GetEntries(keys [][]byte) (entries []Entry, found []bool, errs []error) {
+	entries = make([]Entry, len(keys))
+	found = make([]bool, len(keys))
+	errs = make([]error, len(keys))
+	var block []byte
+	var blockErr error
+	blockOffset := int64(-1)
+	lo := 0
+	for i, key := range keys {
+		if r.filter != nil && !bloomMayContain(r.filter, key) {
+			continue
+		}
+		lo += sort.Search(len(r.index)-lo, func(j int) bool { return r.comparator.Compare(r.index[lo+j].Key, key) >= 0 })
+		if lo == len(r.index) {
+			break
+		}
+		ie := r.index[lo]
+		if r.comparator.Compare(ie.Key, key) != 0 {
+			continue
+		}
+		if ie.Length == 0 {
+			entries[i], found[i], errs[i] = r.readLegacyEntry(ie.Offset)
+			continue
+		}
+		if ie.Offset != blockOffset {
+			block, blockErr = r.readBlock(ie.Offset, ie.Length)
+			blockOffset = ie.Offset
+		}
+		if blockErr != nil {
+			errs[i] = blockErr
+			continue
+		}
+		entries[i], found[i], errs[i] = decodeEntry(block, ie.Pos)
+	}
+	return entries, found, errs
+}
+
+// readEntry decodes the entry an index entry points at.
+func (r *Reader) readEntry(ie IndexEntry) (Entry, bool, error) {
+	if ie.Length == 0 {
+		return r.readLegacyEntry(ie.Offset)
 	}
-	// Seek to the data block offset
-	_, err := r.file.Seek(foundEntry.Offset, io.SeekStart)
+	block, err := r.readBlock(ie.Offset, ie.Length)
 	if err != nil {
-		return nil, false, fmt.Errorf("failed to seek to data block: %w", err)
+		return Entry{}, false, err
 	}
-	//Read header: [keyLen(4)][valueLen(4)] // headers: They are known as the first 8 bytes of the data block, which contain the lengths of the key and value. This allows us to know how many bytes to read for the key and value, respectively.
-	header := make([]byte, 9) // 8 bytes for lengths + 1 byte for potential future use
-	if _, err := r.file.Read(header); err != nil {
-		return nil, false, fmt.Errorf("failed to read data block header: %w", err)
+	return decodeEntry(block, ie.Pos)
+}
+
+// readBlock returns the uncompressed data block at offset, from the cache if
+// it is there. It uses ReadAt rather than Seek so that concurrent readers
+// (Get under RLock, background compaction) never race on the shared file cursor.
+func (r *Reader) readBlock(offset int64, length uint32) ([]byte, error) {
+	key := cacheKey{table: r.id, offset: offset}
+	if r.cache != nil {
+		if block, ok := r.cache.get(key); ok {
+			return block, nil
+		}
+	}
+	if length < blockTrailerSize {
+		return nil, fmt.Errorf("%w at offset %d", ErrCorruptBlock, offset)
+	}
+	raw := make([]byte, length)
+	if _, err := r.file.ReadAt(raw, offset); err != nil {
+		return nil, fmt.Errorf("failed to read data block: %w", err)
+	}
+	n := len(raw) - 4
+	if crc32.ChecksumIEEE(raw[:n]) != binary.LittleEndian.Uint32(raw[n:]) {
+		return nil, fmt.Errorf("%w at offset %d", ErrCorruptBlock, offset)
+	}
+	block := raw[:n-1]
+	switch Compression(raw[n-1]) {
+	case NoCompression:
+	case FlateCompression:
+		var err error
+		if block, err = io.ReadAll(flate.NewReader(bytes.NewReader(block))); err != nil {
+			return nil, fmt.Errorf("%w at offset %d: %v", ErrCorruptBlock, offset, err)
+		}
+	default:
+		return nil, fmt.Errorf("%w at offset %d: unknown compression %d", ErrCorruptBlock, offset, raw[n-1])
+	}
+	if r.cache != nil {
+		r.cache.add(key, block)
+	}
+	return block, nil
+}
+
+// decodeEntry decodes the entry at pos within an uncompressed data block.
+func decodeEntry(block []byte, pos uint32) (Entry, bool, error) {
+	if int(pos)+9 > len(block) {
+		return Entry{}, false, fmt.Errorf("%w: entry past end of block", ErrCorruptBlock)
+	}
+	header := block[pos : pos+9]
+	keyLen := binary.LittleEndian.Uint32(header[1:5])
+	valueLen := binary.LittleEndian.Uint32(header[5:9])
+	start := int(pos) + 9 + int(keyLen)
+	if start+int(valueLen) > len(block) {
+		return Entry{}, false, fmt.Errorf("%w: entry past end of block", ErrCorruptBlock)
+	}
+	value := append([]byte(nil), block[start:start+int(valueLen)]...)
+	return decodeValue(header[0], value)
+}
+
+// readLegacyEntry decodes an entry of a table without blocks, stored directly at offset.
+func (r *Reader) readLegacyEntry(offset int64) (Entry, bool, error) {
+	//Read header: [entryType(1)][keyLen(4)][valueLen(4)] // headers: They are known as the first bytes of the data block, which contain the lengths of the key and value. This allows us to know how many bytes to read for the key and value, respectively.
+	header := make([]byte, 9)
+	if _, err := r.file.ReadAt(header, offset); err != nil {
+		return Entry{}, false, fmt.Errorf("failed to read data block header: %w", err)
 	}
 	entryType := header[0]
 	keyLen := binary.LittleEndian.Uint32(header[1:5])
 	valueLen := binary.LittleEndian.Uint32(header[5:9])
 
-	if entryType == 1 {
-		return nil, false, nil // tombstone entry, key is deleted
+	if entryType == TypeTombstone {
+		return Entry{Type: TypeTombstone}, true, nil // tombstone entry, key is deleted
 	}
 
 	// Skip the key (we already know it) and read the value
-	if _, err := r.file.Seek(int64(keyLen), io.SeekCurrent); err != nil {
-		return nil, false, fmt.Errorf("failed to skip key: %w", err)
-	}
 	value := make([]byte, valueLen)
-	if _, err := r.file.Read(value); err != nil {
-		return nil, false, fmt.Errorf("failed to read value: %w", err)
+	if _, err := r.file.ReadAt(value, offset+9+int64(keyLen)); err != nil {
+		return Entry{}, false, fmt.Errorf("failed to read value: %w", err)
+	}
+	return decodeValue(entryType, value)
+}
+
+// decodeValue turns an entry's type and stored value into an Entry.
+func decodeValue(entryType byte, value []byte) (Entry, bool, error) {
+	switch entryType {
+	case TypeTombstone:
+		return Entry{Type: TypeTombstone}, true, nil // tombstone entry, key is deleted
+	case TypeValueWithExpiry:
+		if len(value) < 8 {
+			return Entry{}, false, fmt.Errorf("corrupt expiring entry")
+		}
+		return Entry{
+			Value:     value[8:],
+			Type:      TypeValue,
+			ExpiresAt: int64(binary.LittleEndian.Uint64(value[0:8])),
+		}, true, nil
+	}
+	return Entry{Value: value, Type: entryType}, true, nil
+}
+
+// TombstoneCount returns how many entries in the table are tombstones, by
+// the rule of IsTombstone. It comes from the properties block when there is
+// one; older tables have every entry read. The result is cached since
+// SSTables are immutable.
+func (r *Reader) TombstoneCount() (int, error) {
+	r.statsOnce.Do(func() {
+		// Tables with properties already know the answer
+		if n, ok := r.props[PropTombstones]; ok {
+			r.tombstones, r.statsErr = strconv.Atoi(n)
+			return
+		}
+		it := r.NewIterator()
+		for it.Next() {
+			if IsTombstone(it.Entry()) {
+				r.tombstones++
+			}
+		}
+		if err := it.Err(); err != nil {
+			r.statsErr = fmt.Errorf("failed to count tombstones: %w", err)
+		}
+	})
+	return r.tombstones, r.statsErr
+}
+
+// Scan calls fn for every entry in the table in key order.
+func (r *Reader) Scan(fn func(key []byte, e Entry) error) error {
+	it := r.NewIterator()
+	for it.Next() {
+		if err := fn(it.Key(), it.Entry()); err != nil {
+			return err
+		}
 	}
-	return value, true, nil
+	return it.Err()
+}
+
+// Iterator walks the entries of a table in key order. Entries of one block
+// are adjacent, so each block is read once.
+type Iterator struct {
+	r           *Reader
+	pos         int
+	block       []byte
+	blockOffset int64
+	entry       Entry
+	err         error
+}
+
+// NewIterator returns an iterator positioned before the first entry.
+func (r *Reader) NewIterator() *Iterator {
+	return &Iterator{r: r, pos: -1, blockOffset: -1}
+}
+
+// Next advances to the next entry and reports whether there is one. It
+// returns false at the end of the table or once reading failed, see Err.
+func (it *Iterator) Next() bool {
+	if it.err != nil || it.pos == len(it.r.index) {
+		return false
+	}
+	it.pos++
+	if it.pos == len(it.r.index) {
+		return false
+	}
+	ie := it.r.index[it.pos]
+	if ie.Length == 0 {
+		it.entry, _, it.err = it.r.readLegacyEntry(ie.Offset)
+		return it.err == nil
+	}
+	if ie.Offset != it.blockOffset {
+		if it.block, it.err = it.r.readBlock(ie.Offset, ie.Length); it.err != nil {
+			return false
+		}
+		it.blockOffset = ie.Offset
+	}
+	it.entry, _, it.err = decodeEntry(it.block, ie.Pos)
+	return it.err == nil
+}
+
+// Key returns the key at the current position.
+func (it *Iterator) Key() []byte {
+	return it.r.index[it.pos].Key
+}
+
+// Entry returns the entry at the current position.
+func (it *Iterator) Entry() Entry {
+	return it.entry
+}
+
+// Err returns the error that stopped the iterator, if any.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// ApproximateRange estimates how many bytes of the file hold the keys from
+// start to end, both inclusive, and counts their entries. A nil bound is
+// open. It works from the index alone and reads no data blocks: a key's
+// position is the offset of its block plus its share of the block.
+func (r *Reader) ApproximateRange(start, end []byte) (size int64, entries int) {
+	first, last := 0, len(r.index)
+	if start != nil {
+		first = sort.Search(len(r.index), func(i int) bool { return r.comparator.Compare(r.index[i].Key, start) >= 0 })
+	}
+	if end != nil {
+		last = sort.Search(len(r.index), func(i int) bool { return r.comparator.Compare(r.index[i].Key, end) > 0 })
+	}
+	if last <= first {
+		return 0, 0
+	}
+	return r.offsetAt(last) - r.offsetAt(first), last - first
+}
+
+// offsetAt estimates where the i-th entry of the index starts in the file.
+func (r *Reader) offsetAt(i int) int64 {
+	if i == len(r.index) {
+		return r.dataSize
+	}
+	ie := r.index[i]
+	if ie.Length == 0 {
+		return ie.Offset
+	}
+	first, last := i, i
+	for first > 0 && r.index[first-1].Offset == ie.Offset {
+		first--
+	}
+	for last+1 < len(r.index) && r.index[last+1].Offset == ie.Offset {
+		last++
+	}
+	return ie.Offset + int64(ie.Length)*int64(i-first)/int64(last-first+1)
+}
+
+// Path returns the location of the SSTable file on disk.
+func (r *Reader) Path() string {
+	return r.path
+}
+
+// Size returns the size of the SSTable file in bytes.
+func (r *Reader) Size() int64 {
+	return r.size
 }
 
 // Close releases any resources held by the Reader.
 func (r *Reader) Close() error {
+	if r.cache != nil {
+		r.cache.evict(r.id)
+	}
 	return r.file.Close()
 }
 
@@ -1,6 +1,10 @@
 package sstable
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"os"
 	"testing"
 )
@@ -37,3 +41,301 @@ func TestSSTable_ReadWrite(t *testing.T) {
 		t.Error("Should not have found 'orange'")
 	}
 }
+
+func TestSSTable_EntryExpiry(t *testing.T) {
+	path := "test_expiry.sst"
+	defer os.Remove(path)
+
+	w, _ := NewWriter(path)
+	w.WriteEntry([]byte("session"), Entry{Value: []byte("token"), Type: TypeValue, ExpiresAt: 1234})
+	w.WriteEntry([]byte("user"), Entry{Value: []byte("alice"), Type: TypeValue})
+	w.Close()
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open reader: %v", err)
+	}
+	defer r.Close()
+
+	e, found, err := r.GetEntry([]byte("session"))
+	if err != nil || !found {
+		t.Fatalf("Expected session entry, err: %v", err)
+	}
+	if string(e.Value) != "token" || e.Type != TypeValue || e.ExpiresAt != 1234 {
+		t.Errorf("Expiry not round-tripped: %+v", e)
+	}
+
+	e, _, _ = r.GetEntry([]byte("user"))
+	if string(e.Value) != "alice" || e.ExpiresAt != 0 {
+		t.Errorf("Expected non-expiring alice, got %+v", e)
+	}
+}
+
+func TestSSTable_ComparatorProperty(t *testing.T) {
+	path := "test_comparator.sst"
+	defer os.Remove(path)
+
+	w, _ := NewWriter(path)
+	w.WritePair([]byte("a"), []byte("1"), TypeValue)
+	w.WritePair([]byte("b"), nil, TypeTombstone)
+	w.Close()
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open reader: %v", err)
+	}
+	props := r.Properties()
+	if props[PropComparator] != "bytewise" || props[PropEntries] != "2" || props[PropTombstones] != "1" {
+		t.Errorf("Unexpected properties: %v", props)
+	}
+	r.Close()
+
+	if _, err := OpenWithComparator(path, reverseComparator{}); !errors.Is(err, ErrComparatorMismatch) {
+		t.Errorf("Expected ErrComparatorMismatch, got %v", err)
+	}
+}
+
+type reverseComparator struct{}
+
+func (reverseComparator) Compare(a, b []byte) int { return bytes.Compare(b, a) }
+func (reverseComparator) Name() string            { return "reverse" }
+
+func TestSSTable_BlocksCompressionAndFilter(t *testing.T) {
+	path := "test_blocks.sst"
+	defer os.Remove(path)
+
+	// 1. Small blocks, so the table spans many of them
+	w, err := NewWriterWithOptions(path, WriterOptions{BlockSize: 64, Compression: FlateCompression, FilterBitsPerKey: 10})
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%03d", i)
+		w.WritePair([]byte(key), bytes.Repeat([]byte("v"), 20), TypeValue)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+
+	cache := NewCache(1 << 20)
+	r, err := OpenWithOptions(path, ReaderOptions{Comparator: BytewiseComparator, Cache: cache})
+	if err != nil {
+		t.Fatalf("Failed to open reader: %v", err)
+	}
+	defer r.Close()
+	if r.Properties()[PropCompression] != "flate" {
+		t.Errorf("Expected compression property 'flate', got %q", r.Properties()[PropCompression])
+	}
+
+	// 2. Every key reads back, and the second read of a block is a cache hit
+	for i := 0; i < 100; i++ {
+		val, found, err := r.Get([]byte(fmt.Sprintf("key%03d", i)))
+		if err != nil || !found || len(val) != 20 {
+			t.Fatalf("Get key%03d: got %q (found=%v, err=%v)", i, val, found, err)
+		}
+	}
+	if hits, misses := cache.Stats(); hits == 0 || misses == 0 {
+		t.Errorf("Expected both cache hits and misses, got %d/%d", hits, misses)
+	}
+
+	// 3. The filter turns away most absent keys
+	passed := 0
+	for i := 0; i < 1000; i++ {
+		if bloomMayContain(r.filter, []byte(fmt.Sprintf("absent%d", i))) {
+			passed++
+		}
+	}
+	if passed > 50 {
+		t.Errorf("Expected a false positive rate near 1%%, got %d/1000", passed)
+	}
+
+	// 4. A flipped byte is caught by the block checksum
+	data, _ := os.ReadFile(path)
+	data[3] ^= 0xff
+	os.WriteFile(path, data, 0644)
+	corrupt, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open reader: %v", err)
+	}
+	defer corrupt.Close()
+	if _, _, err := corrupt.Get([]byte("key000")); !errors.Is(err, ErrCorruptBlock) {
+		t.Errorf("Expected ErrCorruptBlock, got %v", err)
+	}
+}
+
+func TestSSTable_ApproximateRange(t *testing.T) {
+	path := "test_approximate.sst"
+	defer os.Remove(path)
+
+	w, err := NewWriterWithOptions(path, WriterOptions{BlockSize: 256})
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		w.WritePair([]byte(fmt.Sprintf("key%03d", i)), bytes.Repeat([]byte("v"), 50), TypeValue)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+	r, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open reader: %v", err)
+	}
+	defer r.Close()
+
+	all, n := r.ApproximateRange(nil, nil)
+	if n != 1000 || all <= 0 || all >= r.Size() {
+		t.Fatalf("Expected 1000 entries in under %d bytes, got %d in %d", r.Size(), n, all)
+	}
+	// A quarter of the keys hold about a quarter of the data
+	quarter, n := r.ApproximateRange([]byte("key250"), []byte("key499"))
+	if n != 250 || quarter < all/5 || quarter > all*3/10 {
+		t.Errorf("Expected 250 entries in about %d bytes, got %d in %d", all/4, n, quarter)
+	}
+	if size, n := r.ApproximateRange([]byte("key5"), []byte("key4")); size != 0 || n != 0 {
+		t.Errorf("Expected an empty range to be empty, got %d entries in %d bytes", n, size)
+	}
+	if _, n := r.ApproximateRange([]byte("key999"), []byte("zzz")); n != 1 {
+		t.Errorf("Expected a single entry at the end, got %d", n)
+	}
+}
+
+func TestSSTable_GetEntries(t *testing.T) {
+	path := "test_get_entries.sst"
+	defer os.Remove(path)
+
+	w, err := NewWriterWithOptions(path, WriterOptions{BlockSize: 256, FilterBitsPerKey: 10})
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	for i := 0; i < 100; i += 2 {
+		w.WritePair([]byte(fmt.Sprintf("key%03d", i)), []byte(fmt.Sprintf("value%d", i)), TypeValue)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+	cache := NewCache(1 << 20)
+	r, err := OpenWithOptions(path, ReaderOptions{Comparator: BytewiseComparator, Cache: cache})
+	if err != nil {
+		t.Fatalf("Failed to open reader: %v", err)
+	}
+	defer r.Close()
+
+	// Every key from key000 to key099, half of them absent, and one past the end
+	var keys [][]byte
+	for i := 0; i < 100; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%03d", i)))
+	}
+	keys = append(keys, []byte("zzz"))
+	entries, found, errs := r.GetEntries(keys)
+	for i := range keys {
+		want := i%2 == 0 && i < 100
+		if errs[i] != nil || found[i] != want || (want && string(entries[i].Value) != fmt.Sprintf("value%d", i)) {
+			t.Errorf("%s: got %q (found=%v, err=%v)", keys[i], entries[i].Value, found[i], errs[i])
+		}
+	}
+
+	// Each block was read once
+	blocks := map[int64]bool{}
+	for _, ie := range r.GetIndex() {
+		blocks[ie.Offset] = true
+	}
+	if hits, misses := cache.Stats(); hits != 0 || misses != uint64(len(blocks)) {
+		t.Errorf("Expected %d block reads and no repeats, got %d misses and %d hits", len(blocks), misses, hits)
+	}
+}
+
+func TestSSTable_Iterator(t *testing.T) {
+	path := "test_iterator.sst"
+	defer os.Remove(path)
+
+	w, err := NewWriterWithOptions(path, WriterOptions{BlockSize: 64})
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	for i := 0; i < 50; i++ {
+		w.WriteEntry([]byte(fmt.Sprintf("key%02d", i)), Entry{Value: []byte(fmt.Sprintf("value%02d", i)), Type: TypeValue, ExpiresAt: int64(i)})
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+
+	// 1. Every entry comes back in order, each block read once
+	cache := NewCache(1 << 20)
+	r, err := OpenWithOptions(path, ReaderOptions{Comparator: BytewiseComparator, Cache: cache})
+	if err != nil {
+		t.Fatalf("Failed to open reader: %v", err)
+	}
+	defer r.Close()
+	it := r.NewIterator()
+	n := 0
+	for ; it.Next(); n++ {
+		e := it.Entry()
+		if string(it.Key()) != fmt.Sprintf("key%02d", n) || string(e.Value) != fmt.Sprintf("value%02d", n) || e.ExpiresAt != int64(n) {
+			t.Fatalf("Entry %d: got %s = %q, expiring at %d", n, it.Key(), e.Value, e.ExpiresAt)
+		}
+	}
+	if it.Err() != nil || n != 50 || it.Next() {
+		t.Errorf("Expected 50 entries and the end, got %d (err=%v)", n, it.Err())
+	}
+	if hits, misses := cache.Stats(); hits != 0 || misses < 2 {
+		t.Errorf("Expected every block read once, got %d hits and %d misses", hits, misses)
+	}
+
+	// 2. A corrupt block stops the iterator with the error
+	data, _ := os.ReadFile(path)
+	data[3] ^= 0xff
+	os.WriteFile(path, data, 0644)
+	corrupt, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open reader: %v", err)
+	}
+	defer corrupt.Close()
+	it = corrupt.NewIterator()
+	if it.Next() || !errors.Is(it.Err(), ErrCorruptBlock) {
+		t.Errorf("Expected ErrCorruptBlock, got %v", it.Err())
+	}
+}
+
+// writeLegacyTable writes a table in the oldest format: bare entries, an
+// index of their offsets and a footer holding the index offset alone.
+func writeLegacyTable(t *testing.T, path string, keys []string, types []byte, values []string) {
+	t.Helper()
+	var data, index []byte
+	for i, key := range keys {
+		offset := len(data)
+		data = append(data, types[i])
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(key)))
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(values[i])))
+		data = append(append(data, key...), values[i]...)
+		index = binary.LittleEndian.AppendUint32(index, uint32(len(key)))
+		index = binary.LittleEndian.AppendUint64(index, uint64(offset))
+		index = append(index, key...)
+	}
+	footer := binary.LittleEndian.AppendUint64(nil, uint64(len(data)))
+	if err := os.WriteFile(path, append(append(data, index...), footer...), 0644); err != nil {
+		t.Fatalf("Failed to write legacy table: %v", err)
+	}
+}
+
+func TestSSTable_LegacyTombstoneCount(t *testing.T) {
+	path := "test_legacy_tombstones.sst"
+	defer os.Remove(path)
+
+	// Deletes were once stored as plain values holding the marker
+	writeLegacyTable(t, path,
+		[]string{"apple", "banana", "cherry", "grape"},
+		[]byte{TypeValue, TypeValue, TypeTombstone, TypeValue},
+		[]string{"red", TombstoneMarker, "", "purple"})
+	r, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open legacy table: %v", err)
+	}
+	defer r.Close()
+	if e, found, err := r.GetEntry([]byte("banana")); err != nil || !found || !IsTombstone(e) {
+		t.Errorf("Expected banana to read as a tombstone, got %+v (found %v, err %v)", e, found, err)
+	}
+	if n, err := r.TombstoneCount(); err != nil || n != 2 {
+		t.Errorf("Expected 2 tombstones, got %d (%v)", n, err)
+	}
+}
@@ -1,10 +1,16 @@
 package sstable
 
 import (
+	"bytes"
+	"compress/flate"
 	"encoding/binary"
 	"fmt"
-	"io"
-	"os"
+	"hash/crc32"
+	"sort"
+	"strconv"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/ratelimit"
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
 )
 
 // SSTable (Sorted String Table) is a file format used in LSM-trees to store sorted key-value pairs on disk.
@@ -12,80 +18,336 @@ import (
 
 // SSTable isn't just a list of data. It’s split into:
 
-// Data Blocks: The actual K-V pairs.
+// Data Blocks: The actual K-V pairs, grouped into blocks of roughly BlockSize
+// bytes. Each block may be compressed and ends with a trailer:
+// [Compression(1)][CRC32(4)].
 
 // Index Block: Offsets telling us where specific keys are (so we don't scan the whole file).
 
-// Footer: Metadata and the Bloom Filter.
+// Filter Block: A bloom filter over the keys, so most lookups for absent keys
+// never touch a data block.
+
+// Properties Block: Metadata about the table, such as the comparator that ordered it.
+
+// Footer: [IndexOffset(8)][FilterOffset(8)][PropertiesOffset(8)][Magic(8)].
+// Older tables have no blocks or filter and end with [IndexOffset(8)][PropertiesOffset(8)][Magic(8)],
+// or, before the properties block existed, with just [IndexOffset(8)].
+
+// footerMagic marks tables made of data blocks.
+const footerMagic uint64 = 0x4c534d5353545032 // "LSMSSTP2"
+
+// footerMagicV1 marks tables that carry a properties block but store entries
+// directly, without blocks.
+const footerMagicV1 uint64 = 0x4c534d5353545031 // "LSMSSTP1"
+
+// blockTrailerSize is the size of the [Compression(1)][CRC32(4)] trailer of every data block.
+const blockTrailerSize = 5
+
+// DefaultBlockSize is the block size used when WriterOptions leaves it unset.
+const DefaultBlockSize = 4096
+
+// Property names recorded by every Writer.
+const (
+	PropComparator  = "comparator"
+	PropEntries     = "num.entries"
+	PropTombstones  = "num.tombstones"
+	PropBlockSize   = "block.size"
+	PropCompression = "compression"
+	PropFilterBits  = "filter.bits_per_key"
+)
+
+// Entry types stored in the first byte of every entry header.
+const (
+	TypeValue     byte = 0
+	TypeTombstone byte = 1
+	// TypeValueWithExpiry is a value whose data starts with an 8-byte expiry
+	// timestamp. Readers decode it back into a TypeValue Entry.
+	TypeValueWithExpiry byte = 2
+	// TypeMerge holds a chain of merge operands waiting for a base value.
+	TypeMerge byte = 3
+	// TypeBlobIndex holds a reference to a value stored in a blob file, see
+	// package blob.
+	TypeBlobIndex byte = 4
+)
+
+// Compression selects how data blocks are compressed.
+type Compression byte
+
+const (
+	NoCompression Compression = 0
+	// FlateCompression compresses blocks with DEFLATE (compress/flate). A
+	// block that does not shrink is stored uncompressed.
+	FlateCompression Compression = 1
+)
+
+func (c Compression) String() string {
+	switch c {
+	case NoCompression:
+		return "none"
+	case FlateCompression:
+		return "flate"
+	default:
+		return fmt.Sprintf("compression(%d)", byte(c))
+	}
+}
+
+// ParseCompression is the inverse of Compression.String.
+func ParseCompression(s string) (Compression, error) {
+	switch s {
+	case "none":
+		return NoCompression, nil
+	case "flate":
+		return FlateCompression, nil
+	default:
+		return 0, fmt.Errorf("unknown compression %q", s)
+	}
+}
+
+// Comparator defines the order of keys within a table.
+type Comparator interface {
+	Compare(a, b []byte) int
+	Name() string
+}
+
+type bytewiseComparator struct{}
+
+func (bytewiseComparator) Compare(a, b []byte) int { return bytes.Compare(a, b) }
+func (bytewiseComparator) Name() string            { return "bytewise" }
+
+// BytewiseComparator orders keys lexicographically by byte. Tables written
+// before comparators were recorded are assumed to use it.
+var BytewiseComparator Comparator = bytewiseComparator{}
+
+// Entry is a decoded data block.
+type Entry struct {
+	Value     []byte
+	Type      byte
+	ExpiresAt int64 // unix nanoseconds, 0 means the entry never expires
+}
+
+// TombstoneMarker is the value tables written before tombstones had their
+// own entry type used for a deleted key.
+const TombstoneMarker = "TOMBSTONE_MARKER"
+
+// IsTombstone reports whether e marks a deleted key, in tables of any age.
+func IsTombstone(e Entry) bool {
+	return e.Type == TypeTombstone || string(e.Value) == TombstoneMarker
+}
 
 // IndexEntry holds the location of a key in the data file.
 type IndexEntry struct {
-	Key    []byte
+	Key []byte
+	// Offset is where the data block holding the key starts. In tables
+	// without blocks (Length 0) it is the offset of the entry itself.
 	Offset int64
+	Length uint32 // on-disk length of the block, trailer included
+	Pos    uint32 // offset of the entry within the uncompressed block
+}
+
+// WriterOptions configures a Writer. Zero fields take their defaults.
+type WriterOptions struct {
+	// Comparator is recorded as the table's comparator. Nil means BytewiseComparator.
+	Comparator Comparator
+	// BlockSize is the uncompressed size at which a data block is cut. Zero means DefaultBlockSize.
+	BlockSize   int
+	Compression Compression
+	// FilterBitsPerKey sizes the bloom filter. Zero writes no filter.
+	FilterBitsPerKey int
+	// FS is where the table is written. Nil means vfs.Default.
+	FS vfs.FS
+	// RateLimiter paces the writes, at IOPriority. Nil writes at full speed.
+	RateLimiter *ratelimit.Limiter
+	IOPriority  ratelimit.Priority
 }
 
 // Writer handles the creation of a new SSTable file.
 type Writer struct {
-	file  *os.File
-	index []IndexEntry
+	file   vfs.File
+	opts   WriterOptions
+	offset int64 // bytes written so far
+	index  []IndexEntry
+	// block buffers the entries of the data block being built; they are
+	// index[blockStart:].
+	block      []byte
+	blockStart int
+	hashes     []uint32
+	tombstones int
+	props      map[string]string
 }
 
 // NewWriter initializes a writer for a specific file path.
 func NewWriter(path string) (*Writer, error) {
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	return NewWriterWithOptions(path, WriterOptions{})
+}
+
+// NewWriterWithComparator is like NewWriter but records cmp as the table's
+// comparator. Keys must still be written in the order cmp defines.
+func NewWriterWithComparator(path string, cmp Comparator) (*Writer, error) {
+	return NewWriterWithOptions(path, WriterOptions{Comparator: cmp})
+}
+
+// NewWriterWithOptions is like NewWriter but configured by opts.
+func NewWriterWithOptions(path string, opts WriterOptions) (*Writer, error) {
+	if opts.Comparator == nil {
+		opts.Comparator = BytewiseComparator
+	}
+	if opts.BlockSize <= 0 {
+		opts.BlockSize = DefaultBlockSize
+	}
+	if opts.FS == nil {
+		opts.FS = vfs.Default
+	}
+	f, err := opts.FS.Create(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create SSTable: %w", err)
 	}
-	return &Writer{file: f}, nil
+	return &Writer{file: f, opts: opts, props: map[string]string{}}, nil
 }
 
-// WritePair appends a K-V pair to the data section and tracks its index.
+// SetProperty records an extra name/value pair in the table's properties block.
+func (w *Writer) SetProperty(name, value string) {
+	w.props[name] = value
+}
+
+// WritePair appends a K-V pair to the current data block and tracks its index.
 func (w *Writer) WritePair(key, value []byte, entryType byte) error {
-	offset, err := w.file.Seek(0, io.SeekCurrent)
-	if err != nil {
-		return err
+	// Record the index entry; Offset and Length are filled in when the block is written
+	w.index = append(w.index, IndexEntry{Key: append([]byte(nil), key...), Pos: uint32(len(w.block))})
+	if entryType == TypeTombstone {
+		w.tombstones++
+	}
+	if w.opts.FilterBitsPerKey > 0 {
+		w.hashes = append(w.hashes, bloomHash(key))
 	}
 
-	// Record the index entry
-	w.index = append(w.index, IndexEntry{Key: key, Offset: offset})
+	// Binary Format: [Type(1)][KeyLen(4)][ValLen(4)][Key][Value]
+	w.block = append(w.block, entryType)
+	w.block = binary.LittleEndian.AppendUint32(w.block, uint32(len(key)))
+	w.block = binary.LittleEndian.AppendUint32(w.block, uint32(len(value)))
+	w.block = append(w.block, key...)
+	w.block = append(w.block, value...)
 
-	// Binary Format: [KeyLen(4)][ValLen(4)][Key][Value]
-	buf := make([]byte, 9)
-	buf[0] = entryType
-	binary.LittleEndian.PutUint32(buf[1:5], uint32(len(key)))
-	binary.LittleEndian.PutUint32(buf[5:9], uint32(len(value)))
+	if len(w.block) >= w.opts.BlockSize {
+		return w.flushBlock()
+	}
+	return nil
+}
 
-	if _, err := w.file.Write(buf); err != nil {
-		return err
+// flushBlock compresses and writes the pending data block.
+func (w *Writer) flushBlock() error {
+	if len(w.block) == 0 {
+		return nil
 	}
-	if _, err := w.file.Write(key); err != nil {
-		return err
+	payload, compression := w.block, NoCompression
+	if w.opts.Compression == FlateCompression {
+		var buf bytes.Buffer
+		fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			return err
+		}
+		fw.Write(w.block)
+		if err := fw.Close(); err != nil {
+			return err
+		}
+		if buf.Len() < len(w.block) {
+			payload, compression = buf.Bytes(), FlateCompression
+		}
 	}
-	if _, err := w.file.Write(value); err != nil {
+
+	// Trailer: [Compression(1)][CRC32(4)], the checksum covering payload and compression byte
+	out := append(append([]byte(nil), payload...), byte(compression))
+	out = binary.LittleEndian.AppendUint32(out, crc32.ChecksumIEEE(out))
+	w.opts.RateLimiter.Request(int64(len(out)), w.opts.IOPriority)
+	if _, err := w.file.Write(out); err != nil {
 		return err
 	}
-
+	for i := w.blockStart; i < len(w.index); i++ {
+		w.index[i].Offset = w.offset
+		w.index[i].Length = uint32(len(out))
+	}
+	w.offset += int64(len(out))
+	w.block = w.block[:0]
+	w.blockStart = len(w.index)
 	return nil
 }
 
-// Close finalizing the SSTable by writing the Index and Footer.
+// WriteEntry appends an Entry, encoding its expiry when it has one.
+func (w *Writer) WriteEntry(key []byte, e Entry) error {
+	if e.Type != TypeValue || e.ExpiresAt == 0 {
+		return w.WritePair(key, e.Value, e.Type)
+	}
+	data := make([]byte, 8+len(e.Value))
+	binary.LittleEndian.PutUint64(data[0:8], uint64(e.ExpiresAt))
+	copy(data[8:], e.Value)
+	return w.WritePair(key, data, TypeValueWithExpiry)
+}
+
+// Close finalizing the SSTable by writing the Index, Filter, Properties and Footer.
 func (w *Writer) Close() error {
+	if err := w.finish(); err != nil {
+		w.file.Close()
+		return err
+	}
+	// The table must be durable before a manifest can point at it
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+func (w *Writer) finish() error {
+	if err := w.flushBlock(); err != nil {
+		return err
+	}
+
 	// 1. Record where the Index starts
-	indexOffset, _ := w.file.Seek(0, io.SeekCurrent)
+	indexOffset := w.offset
 
 	// 2. Write the Index entries
+	var buf []byte
 	for _, entry := range w.index {
-		buf := make([]byte, 12) // 4 for KeyLen, 8 for Offset
-		binary.LittleEndian.PutUint32(buf[0:4], uint32(len(entry.Key)))
-		binary.LittleEndian.PutUint64(buf[4:12], uint64(entry.Offset))
-		w.file.Write(buf)
-		w.file.Write(entry.Key)
+		// [KeyLen(4)][BlockOffset(8)][BlockLen(4)][Pos(4)][Key]
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(entry.Key)))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(entry.Offset))
+		buf = binary.LittleEndian.AppendUint32(buf, entry.Length)
+		buf = binary.LittleEndian.AppendUint32(buf, entry.Pos)
+		buf = append(buf, entry.Key...)
+	}
+
+	// 3. Write the Filter, if one was asked for
+	filterOffset := indexOffset + int64(len(buf))
+	if w.opts.FilterBitsPerKey > 0 {
+		buf = append(buf, newBloomFilter(w.hashes, w.opts.FilterBitsPerKey)...)
 	}
 
-	// 3. Write Footer: [IndexOffset (8 bytes)]
-	footer := make([]byte, 8)
-	binary.LittleEndian.PutUint64(footer, uint64(indexOffset))
-	w.file.Write(footer)
+	// 4. Write the Properties: [Count(4)] then [NameLen(4)][Name][ValueLen(4)][Value] per property
+	propsOffset := indexOffset + int64(len(buf))
+	w.props[PropComparator] = w.opts.Comparator.Name()
+	w.props[PropEntries] = strconv.Itoa(len(w.index))
+	w.props[PropTombstones] = strconv.Itoa(w.tombstones)
+	w.props[PropBlockSize] = strconv.Itoa(w.opts.BlockSize)
+	w.props[PropCompression] = w.opts.Compression.String()
+	w.props[PropFilterBits] = strconv.Itoa(w.opts.FilterBitsPerKey)
+	names := make([]string, 0, len(w.props))
+	for name := range w.props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(names)))
+	for _, name := range names {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(name)))
+		buf = append(buf, name...)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(w.props[name])))
+		buf = append(buf, w.props[name]...)
+	}
 
-	return w.file.Close()
+	// 5. Write Footer: [IndexOffset (8 bytes)][FilterOffset (8 bytes)][PropertiesOffset (8 bytes)][Magic (8 bytes)]
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(indexOffset))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(filterOffset))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(propsOffset))
+	buf = binary.LittleEndian.AppendUint64(buf, footerMagic)
+	w.opts.RateLimiter.Request(int64(len(buf)), w.opts.IOPriority)
+	_, err := w.file.Write(buf)
+	return err
 }
@@ -0,0 +1,312 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// probeBuckets is the number of buckets in the tables-probed-per-Get histogram.
+const probeBuckets = 16
+
+// Stats is a snapshot of the engine's counters and gauges, see LSM.Stats.
+// Counters start at zero each time the database is opened.
+type Stats struct {
+	// MemTableBytes is the approximate size of the MemTables of every family.
+	MemTableBytes int64
+	// ImmutableMemTables counts the frozen MemTables waiting to be flushed.
+	ImmutableMemTables int
+	// TablesPerLevel counts the live SSTables of every family by level.
+	// Tables are not split into levels, so all of them are in level 0.
+	TablesPerLevel []int
+	// DiskBytes is the total size of the live SSTables.
+	DiskBytes int64
+	// BlobFiles counts the live blob files, BlobFileBytes is their total
+	// size and BlobLiveBytes how much of it the tables still point at.
+	BlobFiles     int
+	BlobFileBytes int64
+	BlobLiveBytes int64
+
+	// UserBytes is the size of the keys and values the application wrote.
+	UserBytes int64
+	// Flushes counts flushes, and FlushBytes the size of the tables they wrote.
+	Flushes    int64
+	FlushBytes int64
+	// Compactions counts compactions, with the size of the tables they read
+	// and wrote.
+	Compactions            int64
+	CompactionBytesRead    int64
+	CompactionBytesWritten int64
+	// FilterRemoved and FilterChanged count the entries compaction filters
+	// removed and the values they changed, in flushes and compactions.
+	FilterRemoved int64
+	FilterChanged int64
+	// BlobGCBytes counts the bytes compactions moved out of blob files
+	// that were mostly garbage.
+	BlobGCBytes int64
+	// IngestedFiles and IngestedBytes count the tables added by
+	// IngestExternalFile, and their size.
+	IngestedFiles int64
+	IngestedBytes int64
+
+	Gets    int64
+	Puts    int64
+	Deletes int64
+	Merges  int64
+	// TablesProbed is a histogram of how many SSTables each Get looked in:
+	// TablesProbed[i] counts the Gets that probed i tables. The last bucket
+	// also counts those that probed more.
+	TablesProbed []int64
+
+	// CacheHits and CacheMisses count block cache lookups.
+	CacheHits   int64
+	CacheMisses int64
+
+	// StallTime is how long writes have been held back by write stalls.
+	StallTime time.Duration
+	// DelayedWrites and StoppedWrites count the writes that were slowed
+	// down or blocked.
+	DelayedWrites int64
+	StoppedWrites int64
+	// WriteStall is how much writes are held back right now, and
+	// WriteStallCause the limit behind it.
+	WriteStall      WriteStallCondition
+	WriteStallCause WriteStallCause
+	// PendingCompactionBytes is how much compaction must read before every
+	// family is down to one table.
+	PendingCompactionBytes int64
+}
+
+// TableCount is the number of live SSTables.
+func (s Stats) TableCount() int {
+	n := 0
+	for _, c := range s.TablesPerLevel {
+		n += c
+	}
+	return n
+}
+
+// WriteAmplification is how many bytes reached disk, through flushes and
+// compactions, for every byte the application wrote. It is 0 before any write.
+func (s Stats) WriteAmplification() float64 {
+	if s.UserBytes == 0 {
+		return 0
+	}
+	return float64(s.FlushBytes+s.CompactionBytesWritten) / float64(s.UserBytes)
+}
+
+// CacheHitRatio is the fraction of block cache lookups that hit, 0 before any lookup.
+func (s Stats) CacheHitRatio() float64 {
+	if s.CacheHits+s.CacheMisses == 0 {
+		return 0
+	}
+	return float64(s.CacheHits) / float64(s.CacheHits+s.CacheMisses)
+}
+
+// String formats the statistics for people, one topic per line.
+func (s Stats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Tables: %d (%d bytes)", s.TableCount(), s.DiskBytes)
+	for level, n := range s.TablesPerLevel {
+		fmt.Fprintf(&b, ", level %d: %d", level, n)
+	}
+	fmt.Fprintf(&b, "\nMemTables: %d bytes, %d waiting to be flushed\n", s.MemTableBytes, s.ImmutableMemTables)
+	fmt.Fprintf(&b, "Flushes: %d (%d bytes written)\n", s.Flushes, s.FlushBytes)
+	fmt.Fprintf(&b, "Compactions: %d (%d bytes read, %d bytes written)\n",
+		s.Compactions, s.CompactionBytesRead, s.CompactionBytesWritten)
+	fmt.Fprintf(&b, "Compaction filters: %d removed, %d changed\n", s.FilterRemoved, s.FilterChanged)
+	fmt.Fprintf(&b, "Blob files: %d (%d bytes, %d live), %d bytes garbage collected\n",
+		s.BlobFiles, s.BlobFileBytes, s.BlobLiveBytes, s.BlobGCBytes)
+	fmt.Fprintf(&b, "Ingested: %d files (%d bytes)\n", s.IngestedFiles, s.IngestedBytes)
+	fmt.Fprintf(&b, "Write amplification: %.2f (%d user bytes)\n", s.WriteAmplification(), s.UserBytes)
+	fmt.Fprintf(&b, "Operations: %d gets, %d puts, %d deletes, %d merges\n", s.Gets, s.Puts, s.Deletes, s.Merges)
+	b.WriteString("Tables probed per get:")
+	for n, count := range s.TablesProbed {
+		if count > 0 {
+			fmt.Fprintf(&b, " %d:%d", n, count)
+		}
+	}
+	fmt.Fprintf(&b, "\nBlock cache: %d hits, %d misses (%.1f%% hit ratio)\n",
+		s.CacheHits, s.CacheMisses, 100*s.CacheHitRatio())
+	fmt.Fprintf(&b, "Write stall: %v (cause: %v), %d bytes pending compaction\n",
+		s.WriteStall, s.WriteStallCause, s.PendingCompactionBytes)
+	fmt.Fprintf(&b, "Stall time: %s (%d writes delayed, %d stopped)\n", s.StallTime, s.DelayedWrites, s.StoppedWrites)
+	return b.String()
+}
+
+// engineStats holds the counters behind Stats. Reads update them under the
+// shared lock, so they are atomic.
+type engineStats struct {
+	userBytes              atomic.Int64
+	flushes                atomic.Int64
+	flushBytes             atomic.Int64
+	compactions            atomic.Int64
+	compactionBytesRead    atomic.Int64
+	compactionBytesWritten atomic.Int64
+	filterRemoved          atomic.Int64
+	filterChanged          atomic.Int64
+	blobGCBytes            atomic.Int64
+	ingestedFiles          atomic.Int64
+	ingestedBytes          atomic.Int64
+	gets                   atomic.Int64
+	puts                   atomic.Int64
+	deletes                atomic.Int64
+	merges                 atomic.Int64
+	tablesProbed           [probeBuckets]atomic.Int64
+	stallNanos             atomic.Int64
+	delayedWrites          atomic.Int64
+	stoppedWrites          atomic.Int64
+}
+
+// recordGet counts a Get that looked in probes SSTables.
+func (s *engineStats) recordGet(probes int) {
+	s.gets.Add(1)
+	s.tablesProbed[min(probes, probeBuckets-1)].Add(1)
+}
+
+// Stats returns a snapshot of the engine's statistics.
+func (l *LSM) Stats() Stats {
+	s := Stats{
+		UserBytes:              l.stats.userBytes.Load(),
+		Flushes:                l.stats.flushes.Load(),
+		FlushBytes:             l.stats.flushBytes.Load(),
+		Compactions:            l.stats.compactions.Load(),
+		CompactionBytesRead:    l.stats.compactionBytesRead.Load(),
+		CompactionBytesWritten: l.stats.compactionBytesWritten.Load(),
+		FilterRemoved:          l.stats.filterRemoved.Load(),
+		FilterChanged:          l.stats.filterChanged.Load(),
+		BlobGCBytes:            l.stats.blobGCBytes.Load(),
+		IngestedFiles:          l.stats.ingestedFiles.Load(),
+		IngestedBytes:          l.stats.ingestedBytes.Load(),
+		Gets:                   l.stats.gets.Load(),
+		Puts:                   l.stats.puts.Load(),
+		Deletes:                l.stats.deletes.Load(),
+		Merges:                 l.stats.merges.Load(),
+		TablesProbed:           make([]int64, probeBuckets),
+		StallTime:              time.Duration(l.stats.stallNanos.Load()),
+		DelayedWrites:          l.stats.delayedWrites.Load(),
+		StoppedWrites:          l.stats.stoppedWrites.Load(),
+	}
+	for i := range s.TablesProbed {
+		s.TablesProbed[i] = l.stats.tablesProbed[i].Load()
+	}
+	l.stall.mu.Lock()
+	s.WriteStall, s.WriteStallCause, s.PendingCompactionBytes = l.stall.condition, l.stall.cause, l.stall.pending
+	l.stall.mu.Unlock()
+	if l.cache != nil {
+		hits, misses := l.cache.Stats()
+		s.CacheHits, s.CacheMisses = int64(hits), int64(misses)
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	s.TablesPerLevel = []int{0}
+	for _, cf := range l.families {
+		for _, mem := range cf.memTables() {
+			s.MemTableBytes += int64(mem.Size())
+		}
+		s.ImmutableMemTables += len(cf.imm)
+		s.TablesPerLevel[0] += len(cf.sstTables)
+		for _, sst := range cf.sstTables {
+			s.DiskBytes += sst.Size()
+		}
+		s.BlobFiles += len(cf.blobFiles)
+		for _, size := range cf.blobFiles {
+			s.BlobFileBytes += size
+		}
+		for _, live := range cf.blobLiveBytes() {
+			s.BlobLiveBytes += live
+		}
+	}
+	return s
+}
+
+// GetProperty answers ad-hoc questions about the engine by name, returning
+// false for names it does not know. Properties:
+//
+//	lsm.stats                              every statistic, formatted for people
+//	lsm.num-files-at-level<N>              number of SSTables in level N
+//	lsm.total-sst-files-size               total size of the live SSTables
+//	lsm.cur-size-all-mem-tables            approximate size of every MemTable
+//	lsm.num-immutable-mem-table            frozen MemTables waiting to be flushed
+//	lsm.num-column-families                number of column families
+//	lsm.estimate-num-keys                  see EstimateNumKeys, over every family
+//	lsm.num-blob-files                     number of live blob files
+//	lsm.total-blob-file-size               total size of the live blob files
+//	lsm.live-blob-file-size                bytes of blob files the tables point at
+//	lsm.block-cache-usage                  bytes held by the block cache
+//	lsm.block-cache-capacity               capacity of the block cache
+//	lsm.write-amplification                see Stats.WriteAmplification
+//	lsm.cache-hit-ratio                    see Stats.CacheHitRatio
+//	lsm.stall-time                         see Stats.StallTime
+//	lsm.write-stall                        see Stats.WriteStall, with its cause
+//	lsm.is-write-stopped                   1 while writes are blocked, else 0
+//	lsm.estimate-pending-compaction-bytes  see Stats.PendingCompactionBytes
+func (l *LSM) GetProperty(name string) (string, bool) {
+	s := l.Stats()
+	if level, ok := strings.CutPrefix(name, "lsm.num-files-at-level"); ok {
+		n, err := strconv.Atoi(level)
+		if err != nil || n < 0 {
+			return "", false
+		}
+		if n >= len(s.TablesPerLevel) {
+			return "0", true
+		}
+		return strconv.Itoa(s.TablesPerLevel[n]), true
+	}
+
+	switch name {
+	case "lsm.stats":
+		return s.String(), true
+	case "lsm.total-sst-files-size":
+		return strconv.FormatInt(s.DiskBytes, 10), true
+	case "lsm.cur-size-all-mem-tables":
+		return strconv.FormatInt(s.MemTableBytes, 10), true
+	case "lsm.num-immutable-mem-table":
+		return strconv.Itoa(s.ImmutableMemTables), true
+	case "lsm.num-blob-files":
+		return strconv.Itoa(s.BlobFiles), true
+	case "lsm.total-blob-file-size":
+		return strconv.FormatInt(s.BlobFileBytes, 10), true
+	case "lsm.live-blob-file-size":
+		return strconv.FormatInt(s.BlobLiveBytes, 10), true
+	case "lsm.num-column-families":
+		l.mu.RLock()
+		defer l.mu.RUnlock()
+		return strconv.Itoa(len(l.families)), true
+	case "lsm.estimate-num-keys":
+		l.mu.RLock()
+		defer l.mu.RUnlock()
+		var keys int64
+		for _, cf := range l.familyList() {
+			keys += cf.estimateNumKeys(Range{})
+		}
+		return strconv.FormatInt(keys, 10), true
+	case "lsm.block-cache-usage", "lsm.block-cache-capacity":
+		if l.cache == nil {
+			return "0", true
+		}
+		if name == "lsm.block-cache-usage" {
+			return strconv.FormatInt(l.cache.Size(), 10), true
+		}
+		return strconv.FormatInt(l.cache.Capacity(), 10), true
+	case "lsm.write-amplification":
+		return strconv.FormatFloat(s.WriteAmplification(), 'f', 2, 64), true
+	case "lsm.cache-hit-ratio":
+		return strconv.FormatFloat(s.CacheHitRatio(), 'f', 4, 64), true
+	case "lsm.stall-time":
+		return s.StallTime.String(), true
+	case "lsm.write-stall":
+		return fmt.Sprintf("%v (%v)", s.WriteStall, s.WriteStallCause), true
+	case "lsm.is-write-stopped":
+		if s.WriteStall == WriteStallStopped {
+			return "1", true
+		}
+		return "0", true
+	case "lsm.estimate-pending-compaction-bytes":
+		return strconv.FormatInt(s.PendingCompactionBytes, 10), true
+	}
+	return "", false
+}
@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+func TestLSM_Stats(t *testing.T) {
+	dir := "stats_test"
+	lsm, err := New(dir, &Options{FS: vfs.NewMem(), MaxMemSize: 128, CompactionStrategy: CompactAll})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+
+	for i := 0; i < 40; i++ {
+		lsm.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("value"))
+	}
+	lsm.Delete([]byte("key00"))
+	for i := 0; i < 10; i++ {
+		lsm.Get([]byte(fmt.Sprintf("key%02d", i)))
+	}
+
+	s := lsm.Stats()
+	if s.Puts != 40 || s.Deletes != 1 || s.Gets != 10 {
+		t.Errorf("Expected 40 puts, 1 delete, 10 gets, got %d, %d, %d", s.Puts, s.Deletes, s.Gets)
+	}
+	if s.UserBytes != 40*(5+5)+5 {
+		t.Errorf("Expected %d user bytes, got %d", 40*(5+5)+5, s.UserBytes)
+	}
+	if s.Flushes == 0 || s.TableCount() != int(s.Flushes) || s.DiskBytes != s.FlushBytes {
+		t.Errorf("Expected one table of FlushBytes per flush, got %+v", s)
+	}
+	var probed int64
+	for _, n := range s.TablesProbed {
+		probed += n
+	}
+	if probed != s.Gets {
+		t.Errorf("Expected the probe histogram to count every get, got %v", s.TablesProbed)
+	}
+
+	// Compaction replaces the tables and adds to the bytes written
+	if err := lsm.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	after := lsm.Stats()
+	if after.Compactions != 1 || after.CompactionBytesRead != s.DiskBytes || after.CompactionBytesWritten != after.DiskBytes {
+		t.Errorf("Unexpected compaction stats: %+v", after)
+	}
+	if after.WriteAmplification() <= s.WriteAmplification() {
+		t.Errorf("Expected compaction to raise write amplification above %.2f, got %.2f",
+			s.WriteAmplification(), after.WriteAmplification())
+	}
+
+	// Properties answer the same questions by name
+	if v, ok := lsm.GetProperty("lsm.num-files-at-level0"); !ok || v != fmt.Sprint(after.TableCount()) {
+		t.Errorf("Expected %d files at level 0, got %q", after.TableCount(), v)
+	}
+	if v, ok := lsm.GetProperty("lsm.total-sst-files-size"); !ok || v != fmt.Sprint(after.DiskBytes) {
+		t.Errorf("Expected total size %d, got %q", after.DiskBytes, v)
+	}
+	if v, ok := lsm.GetProperty("lsm.stats"); !ok || !strings.Contains(v, "Write amplification") {
+		t.Errorf("Expected a stats dump, got %q", v)
+	}
+	if _, ok := lsm.GetProperty("lsm.no-such-property"); ok {
+		t.Error("Expected an unknown property to be reported as such")
+	}
+}
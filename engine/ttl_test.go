@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+// fakeClock is a Clock the test moves forward by hand.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestLSM_PutWithTTL(t *testing.T) {
+	dir := "ttl_test"
+	fs := vfs.NewMem()
+
+	lsm, err := New(dir, &Options{FS: fs, MaxMemSize: 1024 * 1024})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	lsm.SetClock(clock)
+
+	lsm.Put([]byte("session"), []byte("old"))
+	lsm.flush()
+	lsm.PutWithTTL([]byte("session"), []byte("token"), 10*time.Second)
+	lsm.Put([]byte("user"), []byte("alice"))
+
+	// 1. Still alive before the deadline
+	clock.Advance(9 * time.Second)
+	if val, found, _ := lsm.Get([]byte("session")); !found || string(val) != "token" {
+		t.Errorf("Expected token before expiry, got %s", string(val))
+	}
+
+	// 2. Gone afterwards, without resurrecting the older value
+	clock.Advance(time.Second)
+	if _, found, _ := lsm.Get([]byte("session")); found {
+		t.Error("Expired key still visible through Get")
+	}
+	it, err := lsm.NewIterator()
+	if err != nil {
+		t.Fatalf("Failed to create iterator: %v", err)
+	}
+	defer it.Close()
+	var keys []string
+	for it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+	if len(keys) != 1 || keys[0] != "user" {
+		t.Errorf("Expected iterator to only see user, got %v", keys)
+	}
+}
+
+func TestLSM_CompactionRemovesExpired(t *testing.T) {
+	dir := "ttl_compaction_test"
+	fs := vfs.NewMem()
+
+	lsm, err := New(dir, &Options{FS: fs, MaxMemSize: 1024 * 1024})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	lsm.SetClock(clock)
+
+	// 1. Both tables carry live data when written
+	lsm.PutWithTTL([]byte("a"), []byte("1"), time.Minute)
+	lsm.Put([]byte("b"), []byte("2"))
+	lsm.flush()
+	lsm.PutWithTTL([]byte("c"), []byte("3"), time.Hour)
+	lsm.flush()
+
+	// 2. Only a has expired by the time compaction runs
+	clock.Advance(2 * time.Minute)
+	if err := lsm.Compact(); err != nil {
+		t.Fatalf("Compaction failed: %v", err)
+	}
+
+	lsm.mu.RLock()
+	defer lsm.mu.RUnlock()
+	if len(lsm.defaultCF.sstTables) != 1 {
+		t.Fatalf("Expected 1 SSTable, got %d", len(lsm.defaultCF.sstTables))
+	}
+	e, found, _ := lsm.defaultCF.sstTables[0].GetEntry([]byte("a"))
+	if found {
+		t.Errorf("Expired entry survived compaction: %+v", e)
+	}
+	e, found, _ = lsm.defaultCF.sstTables[0].GetEntry([]byte("c"))
+	if !found || e.ExpiresAt == 0 {
+		t.Errorf("Live TTL entry lost its expiry during compaction: %+v", e)
+	}
+}
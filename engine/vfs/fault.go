@@ -0,0 +1,417 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrInjected is returned by operations a FaultFS was told to fail.
+	ErrInjected = errors.New("vfs: injected fault")
+	// ErrCrashed is returned by every operation on a FaultFS after Crash.
+	ErrCrashed = errors.New("vfs: filesystem has crashed")
+)
+
+// Op names a kind of operation a FaultFS can fail.
+type Op int
+
+const (
+	OpCreate Op = iota // Create and OpenForAppend
+	OpWrite
+	OpSync
+	OpRename
+	OpRemove // Remove and RemoveAll
+	OpLink
+	numOps
+)
+
+// FaultFS wraps another FS to test what survives a power loss. It tracks, per
+// file, how much has been made durable by Sync; Crash throws the rest away.
+// It can also fail chosen operations on demand.
+//
+// Metadata operations (create, rename, remove) are treated as durable as soon
+// as they return, as if every directory were synced after each one. Files are
+// expected to be written sequentially, which is all the engine does.
+type FaultFS struct {
+	inner FS
+
+	// opMu is held for reading by every operation and for writing by Crash,
+	// so no operation is half done when the crash happens.
+	opMu sync.RWMutex
+
+	mu        sync.Mutex
+	rng       *rand.Rand
+	files     map[string]*faultState
+	calls     [numOps]int
+	failAfter [numOps]int
+	torn      bool
+	crashed   bool
+}
+
+// faultState is the durability of one file: its first synced bytes survive a crash.
+type faultState struct {
+	synced int64
+}
+
+// NewFaultFS wraps inner. seed drives the random choices of torn writes.
+func NewFaultFS(inner FS, seed int64) *FaultFS {
+	fs := &FaultFS{
+		inner: inner,
+		rng:   rand.New(rand.NewSource(seed)),
+		files: map[string]*faultState{},
+	}
+	fs.ClearFaults()
+	return fs
+}
+
+// FailAfter lets the next n calls of op succeed and fails every later one
+// with ErrInjected, until ClearFaults.
+func (fs *FaultFS) FailAfter(op Op, n int) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.calls[op] = 0
+	fs.failAfter[op] = n
+}
+
+// ClearFaults stops failing operations.
+func (fs *FaultFS) ClearFaults() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for op := range fs.failAfter {
+		fs.failAfter[op] = -1
+	}
+}
+
+// SetTornWrites decides what happens to unsynced data. Off, Crash drops all
+// of it. On, Crash keeps a random part of it, always short of the whole, and
+// a failed Write leaves a random prefix of its data behind.
+func (fs *FaultFS) SetTornWrites(torn bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.torn = torn
+}
+
+// check counts a call of op and reports whether it must fail. An op of -1
+// stands for operations that are never failed on purpose.
+func (fs *FaultFS) check(op Op) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.crashed {
+		return ErrCrashed
+	}
+	if op < 0 {
+		return nil
+	}
+	fs.calls[op]++
+	if fs.failAfter[op] >= 0 && fs.calls[op] > fs.failAfter[op] {
+		return ErrInjected
+	}
+	return nil
+}
+
+// Crash simulates a power loss: every file is cut back to what was synced
+// (plus a torn tail, with SetTornWrites). fs, and every file open through it,
+// fails with ErrCrashed from then on; the returned FaultFS sees the surviving state.
+func (fs *FaultFS) Crash() (*FaultFS, error) {
+	fs.opMu.Lock()
+	defer fs.opMu.Unlock()
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.crashed = true
+
+	for name, st := range fs.files {
+		data, err := ReadFile(fs.inner, name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		keep := st.synced
+		if unsynced := int64(len(data)) - st.synced; unsynced > 0 && fs.torn {
+			keep += fs.rng.Int63n(unsynced)
+		}
+		if keep >= int64(len(data)) {
+			continue
+		}
+		f, err := fs.inner.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(data[:keep]); err != nil {
+			f.Close()
+			return nil, err
+		}
+		if err := f.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return NewFaultFS(fs.inner, fs.rng.Int63()), nil
+}
+
+// track returns the durability state of name, creating it for a file that
+// already holds size durable bytes. The caller must hold fs.mu.
+func (fs *FaultFS) track(name string, size int64) *faultState {
+	st, ok := fs.files[name]
+	if !ok {
+		st = &faultState{synced: size}
+		fs.files[name] = st
+	}
+	return st
+}
+
+func (fs *FaultFS) Create(name string) (File, error) {
+	fs.opMu.RLock()
+	defer fs.opMu.RUnlock()
+	if err := fs.check(OpCreate); err != nil {
+		return nil, err
+	}
+	f, err := fs.inner.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	st := &faultState{}
+	fs.files[filepath.Clean(name)] = st
+	return &faultFile{fs: fs, inner: f, state: st}, nil
+}
+
+func (fs *FaultFS) Open(name string) (File, error) {
+	fs.opMu.RLock()
+	defer fs.opMu.RUnlock()
+	if err := fs.check(-1); err != nil {
+		return nil, err
+	}
+	f, err := fs.inner.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &faultFile{fs: fs, inner: f}, nil
+}
+
+func (fs *FaultFS) OpenForAppend(name string) (File, error) {
+	fs.opMu.RLock()
+	defer fs.opMu.RUnlock()
+	if err := fs.check(OpCreate); err != nil {
+		return nil, err
+	}
+	var size int64
+	if info, err := fs.inner.Stat(name); err == nil {
+		size = info.Size()
+	}
+	f, err := fs.inner.OpenForAppend(name)
+	if err != nil {
+		return nil, err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return &faultFile{fs: fs, inner: f, state: fs.track(filepath.Clean(name), size)}, nil
+}
+
+func (fs *FaultFS) Remove(name string) error {
+	fs.opMu.RLock()
+	defer fs.opMu.RUnlock()
+	if err := fs.check(OpRemove); err != nil {
+		return err
+	}
+	if err := fs.inner.Remove(name); err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	delete(fs.files, filepath.Clean(name))
+	return nil
+}
+
+func (fs *FaultFS) RemoveAll(name string) error {
+	fs.opMu.RLock()
+	defer fs.opMu.RUnlock()
+	if err := fs.check(OpRemove); err != nil {
+		return err
+	}
+	if err := fs.inner.RemoveAll(name); err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	name = filepath.Clean(name)
+	for p := range fs.files {
+		if p == name || strings.HasPrefix(p, name+string(filepath.Separator)) {
+			delete(fs.files, p)
+		}
+	}
+	return nil
+}
+
+func (fs *FaultFS) Rename(oldname, newname string) error {
+	fs.opMu.RLock()
+	defer fs.opMu.RUnlock()
+	if err := fs.check(OpRename); err != nil {
+		return err
+	}
+	if err := fs.inner.Rename(oldname, newname); err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	oldname, newname = filepath.Clean(oldname), filepath.Clean(newname)
+	if st, ok := fs.files[oldname]; ok {
+		fs.files[newname] = st
+		delete(fs.files, oldname)
+	} else {
+		delete(fs.files, newname)
+	}
+	// Files inside a renamed directory move with it
+	for p, st := range fs.files {
+		if rest, ok := strings.CutPrefix(p, oldname+string(filepath.Separator)); ok {
+			fs.files[filepath.Join(newname, rest)] = st
+			delete(fs.files, p)
+		}
+	}
+	return nil
+}
+
+func (fs *FaultFS) Link(oldname, newname string) error {
+	fs.opMu.RLock()
+	defer fs.opMu.RUnlock()
+	if err := fs.check(OpLink); err != nil {
+		return err
+	}
+	if err := fs.inner.Link(oldname, newname); err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	// Both names share one content, and so what of it is synced
+	if st, ok := fs.files[filepath.Clean(oldname)]; ok {
+		fs.files[filepath.Clean(newname)] = st
+	}
+	return nil
+}
+
+func (fs *FaultFS) MkdirAll(dir string, perm os.FileMode) error {
+	fs.opMu.RLock()
+	defer fs.opMu.RUnlock()
+	if err := fs.check(-1); err != nil {
+		return err
+	}
+	return fs.inner.MkdirAll(dir, perm)
+}
+
+func (fs *FaultFS) List(dir string) ([]string, error) {
+	fs.opMu.RLock()
+	defer fs.opMu.RUnlock()
+	if err := fs.check(-1); err != nil {
+		return nil, err
+	}
+	return fs.inner.List(dir)
+}
+
+func (fs *FaultFS) Stat(name string) (os.FileInfo, error) {
+	fs.opMu.RLock()
+	defer fs.opMu.RUnlock()
+	if err := fs.check(-1); err != nil {
+		return nil, err
+	}
+	return fs.inner.Stat(name)
+}
+
+func (fs *FaultFS) Lock(name string) (io.Closer, error) {
+	fs.opMu.RLock()
+	defer fs.opMu.RUnlock()
+	if err := fs.check(-1); err != nil {
+		return nil, err
+	}
+	// The lock outlives the crash: it belongs to the process, which still
+	// releases it by closing.
+	return fs.inner.Lock(name)
+}
+
+// faultFile is a file open through a FaultFS. state is nil for read-only handles.
+type faultFile struct {
+	fs    *FaultFS
+	inner File
+	state *faultState
+}
+
+func (f *faultFile) Read(p []byte) (int, error) {
+	f.fs.opMu.RLock()
+	defer f.fs.opMu.RUnlock()
+	if err := f.fs.check(-1); err != nil {
+		return 0, err
+	}
+	return f.inner.Read(p)
+}
+
+func (f *faultFile) ReadAt(p []byte, off int64) (int, error) {
+	f.fs.opMu.RLock()
+	defer f.fs.opMu.RUnlock()
+	if err := f.fs.check(-1); err != nil {
+		return 0, err
+	}
+	return f.inner.ReadAt(p, off)
+}
+
+func (f *faultFile) Write(p []byte) (int, error) {
+	f.fs.opMu.RLock()
+	defer f.fs.opMu.RUnlock()
+	if err := f.fs.check(OpWrite); err != nil {
+		if errors.Is(err, ErrInjected) {
+			f.fs.mu.Lock()
+			torn := f.fs.torn && len(p) > 0
+			n := 0
+			if torn {
+				n = f.fs.rng.Intn(len(p))
+			}
+			f.fs.mu.Unlock()
+			if n > 0 {
+				f.inner.Write(p[:n])
+			}
+			return n, err
+		}
+		return 0, err
+	}
+	return f.inner.Write(p)
+}
+
+func (f *faultFile) Stat() (os.FileInfo, error) {
+	f.fs.opMu.RLock()
+	defer f.fs.opMu.RUnlock()
+	if err := f.fs.check(-1); err != nil {
+		return nil, err
+	}
+	return f.inner.Stat()
+}
+
+func (f *faultFile) Sync() error {
+	f.fs.opMu.RLock()
+	defer f.fs.opMu.RUnlock()
+	if err := f.fs.check(OpSync); err != nil {
+		return err
+	}
+	if err := f.inner.Sync(); err != nil {
+		return err
+	}
+	if f.state != nil {
+		info, err := f.inner.Stat()
+		if err != nil {
+			return err
+		}
+		f.fs.mu.Lock()
+		f.state.synced = info.Size()
+		f.fs.mu.Unlock()
+	}
+	return nil
+}
+
+func (f *faultFile) Close() error {
+	// Close is never failed on purpose, so a crashed process can still let go
+	// of its handles.
+	return f.inner.Close()
+}
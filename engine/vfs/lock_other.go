@@ -0,0 +1,30 @@
+//go:build !unix
+
+package vfs
+
+import (
+	"os"
+	"sync"
+)
+
+// Platforms without flock only get protection within the process.
+var (
+	heldMu sync.Mutex
+	held   = map[string]bool{}
+)
+
+func lockFile(f *os.File) error {
+	heldMu.Lock()
+	defer heldMu.Unlock()
+	if held[f.Name()] {
+		return ErrLocked
+	}
+	held[f.Name()] = true
+	return nil
+}
+
+func unlockFile(f *os.File) {
+	heldMu.Lock()
+	defer heldMu.Unlock()
+	delete(held, f.Name())
+}
@@ -0,0 +1,385 @@
+package vfs
+
+import (
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemFS is an FS held entirely in memory. It lets tests run hermetically
+// and fast. Sync is a no-op: everything written is as durable as the MemFS itself.
+type MemFS struct {
+	mu    sync.Mutex
+	files map[string]*memNode
+	dirs  map[string]bool
+	locks map[string]bool
+}
+
+// memNode is the content of one file, shared by every handle open on it.
+type memNode struct {
+	mu      sync.RWMutex
+	data    []byte
+	modTime time.Time
+}
+
+// NewMem returns an empty in-memory filesystem.
+func NewMem() *MemFS {
+	return &MemFS{
+		files: map[string]*memNode{},
+		dirs:  map[string]bool{".": true, string(filepath.Separator): true},
+		locks: map[string]bool{},
+	}
+}
+
+func pathError(op, name string, err error) error {
+	return &iofs.PathError{Op: op, Path: name, Err: err}
+}
+
+// checkParent fails unless the directory holding name exists. The caller must hold fs.mu.
+func (fs *MemFS) checkParent(op, name string) error {
+	if !fs.dirs[filepath.Dir(name)] {
+		return pathError(op, name, iofs.ErrNotExist)
+	}
+	return nil
+}
+
+func (fs *MemFS) Create(name string) (File, error) {
+	name = filepath.Clean(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.checkParent("open", name); err != nil {
+		return nil, err
+	}
+	if fs.dirs[name] {
+		return nil, pathError("open", name, iofs.ErrExist)
+	}
+	node := &memNode{modTime: time.Now()}
+	fs.files[name] = node
+	return &memFile{name: name, node: node, write: true}, nil
+}
+
+func (fs *MemFS) Open(name string) (File, error) {
+	name = filepath.Clean(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	node, ok := fs.files[name]
+	if !ok {
+		return nil, pathError("open", name, iofs.ErrNotExist)
+	}
+	return &memFile{name: name, node: node, read: true}, nil
+}
+
+func (fs *MemFS) OpenForAppend(name string) (File, error) {
+	name = filepath.Clean(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	node, ok := fs.files[name]
+	if !ok {
+		if err := fs.checkParent("open", name); err != nil {
+			return nil, err
+		}
+		node = &memNode{modTime: time.Now()}
+		fs.files[name] = node
+	}
+	return &memFile{name: name, node: node, read: true, write: true, append: true}, nil
+}
+
+func (fs *MemFS) Remove(name string) error {
+	name = filepath.Clean(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, ok := fs.files[name]; ok {
+		delete(fs.files, name)
+		return nil
+	}
+	if !fs.dirs[name] {
+		return pathError("remove", name, iofs.ErrNotExist)
+	}
+	if len(fs.children(name)) > 0 {
+		return pathError("remove", name, iofs.ErrExist)
+	}
+	delete(fs.dirs, name)
+	return nil
+}
+
+func (fs *MemFS) RemoveAll(name string) error {
+	name = filepath.Clean(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	prefix := name + string(filepath.Separator)
+	for p := range fs.files {
+		if p == name || strings.HasPrefix(p, prefix) {
+			delete(fs.files, p)
+		}
+	}
+	for p := range fs.dirs {
+		if p == name || strings.HasPrefix(p, prefix) {
+			delete(fs.dirs, p)
+		}
+	}
+	return nil
+}
+
+func (fs *MemFS) Rename(oldname, newname string) error {
+	oldname, newname = filepath.Clean(oldname), filepath.Clean(newname)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.dirs[oldname] {
+		return fs.renameDir(oldname, newname)
+	}
+	node, ok := fs.files[oldname]
+	if !ok {
+		return pathError("rename", oldname, iofs.ErrNotExist)
+	}
+	if err := fs.checkParent("rename", newname); err != nil {
+		return err
+	}
+	if fs.dirs[newname] {
+		return pathError("rename", newname, iofs.ErrExist)
+	}
+	delete(fs.files, oldname)
+	fs.files[newname] = node
+	return nil
+}
+
+// renameDir moves the directory oldname and everything in it. The caller must hold fs.mu.
+func (fs *MemFS) renameDir(oldname, newname string) error {
+	if err := fs.checkParent("rename", newname); err != nil {
+		return err
+	}
+	if _, ok := fs.files[newname]; ok || fs.dirs[newname] {
+		return pathError("rename", newname, iofs.ErrExist)
+	}
+	if strings.HasPrefix(newname, oldname+string(filepath.Separator)) {
+		return pathError("rename", newname, iofs.ErrInvalid)
+	}
+	move := func(p string) (string, bool) {
+		if p == oldname {
+			return newname, true
+		}
+		if rest, ok := strings.CutPrefix(p, oldname+string(filepath.Separator)); ok {
+			return filepath.Join(newname, rest), true
+		}
+		return "", false
+	}
+	for p, node := range fs.files {
+		if np, ok := move(p); ok {
+			delete(fs.files, p)
+			fs.files[np] = node
+		}
+	}
+	for p := range fs.dirs {
+		if np, ok := move(p); ok {
+			delete(fs.dirs, p)
+			fs.dirs[np] = true
+		}
+	}
+	return nil
+}
+
+func (fs *MemFS) Link(oldname, newname string) error {
+	oldname, newname = filepath.Clean(oldname), filepath.Clean(newname)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	node, ok := fs.files[oldname]
+	if !ok {
+		return pathError("link", oldname, iofs.ErrNotExist)
+	}
+	if err := fs.checkParent("link", newname); err != nil {
+		return err
+	}
+	if _, ok := fs.files[newname]; ok || fs.dirs[newname] {
+		return pathError("link", newname, iofs.ErrExist)
+	}
+	fs.files[newname] = node
+	return nil
+}
+
+func (fs *MemFS) MkdirAll(dir string, perm os.FileMode) error {
+	dir = filepath.Clean(dir)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for p := dir; !fs.dirs[p]; p = filepath.Dir(p) {
+		if _, ok := fs.files[p]; ok {
+			return pathError("mkdir", p, iofs.ErrExist)
+		}
+		fs.dirs[p] = true
+	}
+	return nil
+}
+
+func (fs *MemFS) List(dir string) ([]string, error) {
+	dir = filepath.Clean(dir)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if !fs.dirs[dir] {
+		return nil, pathError("open", dir, iofs.ErrNotExist)
+	}
+	return fs.children(dir), nil
+}
+
+// children lists the sorted names directly inside dir. The caller must hold fs.mu.
+func (fs *MemFS) children(dir string) []string {
+	var names []string
+	for p := range fs.files {
+		if filepath.Dir(p) == dir {
+			names = append(names, filepath.Base(p))
+		}
+	}
+	for p := range fs.dirs {
+		if p != dir && filepath.Dir(p) == dir {
+			names = append(names, filepath.Base(p))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (fs *MemFS) Stat(name string) (os.FileInfo, error) {
+	name = filepath.Clean(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if node, ok := fs.files[name]; ok {
+		return node.stat(name), nil
+	}
+	if fs.dirs[name] {
+		return memFileInfo{name: filepath.Base(name), dir: true}, nil
+	}
+	return nil, pathError("stat", name, iofs.ErrNotExist)
+}
+
+func (fs *MemFS) Lock(name string) (io.Closer, error) {
+	name = filepath.Clean(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.checkParent("lock", name); err != nil {
+		return nil, err
+	}
+	if fs.locks[name] {
+		return nil, ErrLocked
+	}
+	if _, ok := fs.files[name]; !ok {
+		fs.files[name] = &memNode{modTime: time.Now()}
+	}
+	fs.locks[name] = true
+	return memLock{fs: fs, name: name}, nil
+}
+
+type memLock struct {
+	fs   *MemFS
+	name string
+}
+
+func (l memLock) Close() error {
+	l.fs.mu.Lock()
+	defer l.fs.mu.Unlock()
+	delete(l.fs.locks, l.name)
+	return nil
+}
+
+func (n *memNode) stat(name string) os.FileInfo {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return memFileInfo{name: filepath.Base(name), size: int64(len(n.data)), modTime: n.modTime}
+}
+
+// memFile is an open handle on a memNode.
+type memFile struct {
+	name   string
+	node   *memNode
+	pos    int64
+	read   bool
+	write  bool
+	append bool
+	closed bool
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	if f.closed || !f.read {
+		return 0, pathError("read", f.name, iofs.ErrPermission)
+	}
+	n, err := f.ReadAt(p, f.pos)
+	f.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.closed || !f.read {
+		return 0, pathError("read", f.name, iofs.ErrPermission)
+	}
+	f.node.mu.RLock()
+	defer f.node.mu.RUnlock()
+	if off >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if f.closed || !f.write {
+		return 0, pathError("write", f.name, iofs.ErrPermission)
+	}
+	f.node.mu.Lock()
+	defer f.node.mu.Unlock()
+	if f.append {
+		f.pos = int64(len(f.node.data))
+	}
+	if end := f.pos + int64(len(p)); end > int64(len(f.node.data)) {
+		f.node.data = append(f.node.data, make([]byte, end-int64(len(f.node.data)))...)
+	}
+	copy(f.node.data[f.pos:], p)
+	f.pos += int64(len(p))
+	f.node.modTime = time.Now()
+	return len(p), nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	return f.node.stat(f.name), nil
+}
+
+func (f *memFile) Sync() error {
+	if f.closed {
+		return pathError("sync", f.name, os.ErrClosed)
+	}
+	return nil
+}
+
+func (f *memFile) Close() error {
+	if f.closed {
+		return pathError("close", f.name, os.ErrClosed)
+	}
+	f.closed = true
+	return nil
+}
+
+type memFileInfo struct {
+	name    string
+	size    int64
+	dir     bool
+	modTime time.Time
+}
+
+func (fi memFileInfo) Name() string       { return fi.name }
+func (fi memFileInfo) Size() int64        { return fi.size }
+func (fi memFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi memFileInfo) IsDir() bool        { return fi.dir }
+func (fi memFileInfo) Sys() any           { return nil }
+
+func (fi memFileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
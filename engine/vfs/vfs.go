@@ -0,0 +1,61 @@
+// Package vfs abstracts the filesystem the engine stores its files in, so
+// tests can run against memory and crash tests can inject faults.
+package vfs
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrLocked is returned by FS.Lock when the lock is already held.
+var ErrLocked = errors.New("vfs: lock is held by someone else")
+
+// File is an open file. Writes are only durable once Sync returns.
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.Closer
+	Stat() (os.FileInfo, error)
+	Sync() error
+}
+
+// FS is the set of filesystem operations the engine needs. Paths use the
+// host's separator, as built by path/filepath.
+type FS interface {
+	// Create creates or truncates the named file for writing.
+	Create(name string) (File, error)
+	// Open opens the named file for reading.
+	Open(name string) (File, error)
+	// OpenForAppend opens the named file for writing at its end, creating it if needed.
+	OpenForAppend(name string) (File, error)
+	Remove(name string) error
+	RemoveAll(name string) error
+	// Rename atomically replaces newname with oldname. A directory can only
+	// be renamed to a name that does not exist yet.
+	Rename(oldname, newname string) error
+	// Link makes newname a hard link to the file oldname: both names share
+	// one content. newname must not exist.
+	Link(oldname, newname string) error
+	MkdirAll(dir string, perm os.FileMode) error
+	// List returns the names of the entries in dir, sorted.
+	List(dir string) ([]string, error)
+	Stat(name string) (os.FileInfo, error)
+	// Lock takes an exclusive lock on the named file, creating it if needed.
+	// It fails with ErrLocked instead of waiting if the lock is held.
+	Lock(name string) (io.Closer, error)
+}
+
+// Default is the FS used when none is configured: the host's filesystem.
+var Default FS = OS
+
+// ReadFile reads the whole named file.
+func ReadFile(fs FS, name string) ([]byte, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
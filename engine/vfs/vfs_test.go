@@ -0,0 +1,181 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testFS runs the behaviour the engine relies on against fs, rooted at dir.
+func testFS(t *testing.T, fs FS, dir string) {
+	if err := fs.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+
+	// 1. Create, write and read back
+	path := filepath.Join(dir, "a.txt")
+	f, err := fs.Create(path)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	f.Write([]byte("hello"))
+	f.Sync()
+	f.Close()
+
+	data, err := ReadFile(fs, path)
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("Expected 'hello', got %q (err=%v)", data, err)
+	}
+
+	// 2. Appends land at the end, ReadAt sees them
+	f, err = fs.OpenForAppend(path)
+	if err != nil {
+		t.Fatalf("OpenForAppend failed: %v", err)
+	}
+	f.Write([]byte(" world"))
+	buf := make([]byte, 5)
+	if _, err := f.ReadAt(buf, 6); err != nil || string(buf) != "world" {
+		t.Errorf("Expected 'world' at offset 6, got %q (err=%v)", buf, err)
+	}
+	if info, _ := f.Stat(); info.Size() != 11 {
+		t.Errorf("Expected size 11, got %d", info.Size())
+	}
+	f.Close()
+
+	// 3. Rename replaces, List sees files and directories
+	if err := fs.Rename(path, filepath.Join(dir, "b.txt")); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	names, err := fs.List(dir)
+	if err != nil || !reflect.DeepEqual(names, []string{"b.txt", "sub"}) {
+		t.Errorf("Expected [b.txt sub], got %v (err=%v)", names, err)
+	}
+	if info, err := fs.Stat(filepath.Join(dir, "sub")); err != nil || !info.IsDir() {
+		t.Errorf("Expected 'sub' to be a directory (err=%v)", err)
+	}
+
+	// 4. Links share content; directories can be renamed with what is in them
+	if err := fs.Link(filepath.Join(dir, "b.txt"), filepath.Join(dir, "sub", "c.txt")); err != nil {
+		t.Fatalf("Link failed: %v", err)
+	}
+	if err := fs.Link(filepath.Join(dir, "b.txt"), filepath.Join(dir, "sub", "c.txt")); !errors.Is(err, os.ErrExist) {
+		t.Errorf("Expected linking over an existing file to fail with ErrExist, got %v", err)
+	}
+	if err := fs.Rename(filepath.Join(dir, "sub"), filepath.Join(dir, "sub2")); err != nil {
+		t.Fatalf("Renaming a directory failed: %v", err)
+	}
+	if data, err := ReadFile(fs, filepath.Join(dir, "sub2", "c.txt")); err != nil || string(data) != "hello world" {
+		t.Errorf("Expected the link to read 'hello world', got %q (err=%v)", data, err)
+	}
+	if err := fs.Rename(filepath.Join(dir, "sub2"), filepath.Join(dir, "sub")); err != nil {
+		t.Fatalf("Renaming a directory back failed: %v", err)
+	}
+
+	// 5. Missing files report os.ErrNotExist
+	if _, err := fs.Open(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected ErrNotExist, got %v", err)
+	}
+	if err := fs.Remove(filepath.Join(dir, "b.txt")); err != nil {
+		t.Errorf("Remove failed: %v", err)
+	}
+
+	// 6. Locks are exclusive until released
+	lock, err := fs.Lock(filepath.Join(dir, "LOCK"))
+	if err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	if _, err := fs.Lock(filepath.Join(dir, "LOCK")); !errors.Is(err, ErrLocked) {
+		t.Errorf("Expected ErrLocked, got %v", err)
+	}
+	lock.Close()
+	lock, err = fs.Lock(filepath.Join(dir, "LOCK"))
+	if err != nil {
+		t.Fatalf("Lock after release failed: %v", err)
+	}
+	lock.Close()
+
+	// 7. RemoveAll takes the whole tree
+	if err := fs.RemoveAll(dir); err != nil {
+		t.Fatalf("RemoveAll failed: %v", err)
+	}
+	if _, err := fs.Stat(filepath.Join(dir, "sub")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected 'sub' to be gone, got %v", err)
+	}
+}
+
+func TestOSFS(t *testing.T) {
+	dir := "vfs_os_test"
+	defer os.RemoveAll(dir)
+	testFS(t, OS, dir)
+}
+
+func TestMemFS(t *testing.T) {
+	testFS(t, NewMem(), "db")
+}
+
+func TestMemFS_ReadOnlyHandle(t *testing.T) {
+	fs := NewMem()
+	f, _ := fs.Create("x")
+	f.Write([]byte("data"))
+	f.Close()
+
+	r, _ := fs.Open("x")
+	defer r.Close()
+	if _, err := r.Write([]byte("!")); err == nil {
+		t.Error("Expected writing through a read-only handle to fail")
+	}
+	if data, _ := io.ReadAll(r); string(data) != "data" {
+		t.Errorf("Expected 'data', got %q", data)
+	}
+}
+
+func TestFaultFS(t *testing.T) {
+	// A FaultFS without faults behaves like any other FS
+	testFS(t, NewFaultFS(NewMem(), 1), "db")
+
+	fs := NewFaultFS(NewMem(), 1)
+	f, _ := fs.Create("log")
+	f.Write([]byte("synced"))
+	if err := f.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	f.Write([]byte("lost"))
+
+	// 1. Injected faults fail the chosen operation after n calls
+	fs.FailAfter(OpRename, 1)
+	if err := fs.Rename("log", "log2"); err != nil {
+		t.Fatalf("First rename should succeed, got %v", err)
+	}
+	if err := fs.Rename("log2", "log"); !errors.Is(err, ErrInjected) {
+		t.Errorf("Expected ErrInjected, got %v", err)
+	}
+	fs.ClearFaults()
+
+	// 2. A crash keeps only what was synced, even across the rename
+	after, err := fs.Crash()
+	if err != nil {
+		t.Fatalf("Crash failed: %v", err)
+	}
+	if _, err := f.Write([]byte("x")); !errors.Is(err, ErrCrashed) {
+		t.Errorf("Expected ErrCrashed from a file of the crashed FS, got %v", err)
+	}
+	if _, err := fs.Stat("log2"); !errors.Is(err, ErrCrashed) {
+		t.Errorf("Expected ErrCrashed from the crashed FS, got %v", err)
+	}
+	if data, _ := ReadFile(after, "log2"); string(data) != "synced" {
+		t.Errorf("Expected 'synced' to survive the crash, got %q", data)
+	}
+
+	// 3. Torn writes keep part of the unsynced data, never all of it
+	after.SetTornWrites(true)
+	f, _ = after.OpenForAppend("log2")
+	f.Write([]byte("0123456789"))
+	torn, _ := after.Crash()
+	data, _ := ReadFile(torn, "log2")
+	if len(data) < len("synced") || len(data) >= len("synced0123456789") || string(data[:6]) != "synced" {
+		t.Errorf("Expected a torn tail after 'synced', got %q", data)
+	}
+}
@@ -2,57 +2,232 @@ package wal
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
-	"os"
+	"hash/crc32"
+	"io"
+	"math"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
 )
 
 // WAL (Write-Ahead Log) is a technique used in databases and file systems to ensure data integrity and durability.
 // It works by recording changes to a log before they are applied to the main data store.
 // This allows for recovery in case of crashes or failures, as the log can be replayed to restore the system to a consistent state.
 
+// Writes are grouped into batches. Each batch is framed as
+// [PayloadLen(4)][CRC32(4)][Payload], and the payload is [Count(4)] followed by
+// Count records. The last batch in the log, if its frame is cut short or
+// fails its checksum, is treated as never written, which is what makes a
+// batch atomic. Anywhere else a bad checksum is corruption: the batches after
+// it were acknowledged, and replay fails rather than drop them.
+
+// frameHeaderSize is [PayloadLen(4)][CRC32(4)]
+const frameHeaderSize = 8
+
+// ErrCorrupt is returned when replay finds a damaged batch that is not the
+// torn tail of the log.
+var ErrCorrupt = errors.New("wal: corrupt batch")
+
+// recordHeaderSize is the fixed part of every record:
+// [Type(1)][Family(4)][KeyLen(4)][ValueLen(4)][ExpiresAt(8)]
+const recordHeaderSize = 21
+
 type WAL struct {
-	file *os.File
+	file vfs.File
+	opts Options
+}
+
+// Options configures a WAL.
+type Options struct {
+	// NoSync skips the fsync after every batch. Writes then survive a process
+	// crash but not a power loss until Sync is called or the OS flushes them.
+	NoSync bool
+	// FS is where the log lives. Nil means vfs.Default.
+	FS vfs.FS
+}
+
+// Record is a single logged write.
+type Record struct {
+	Key   []byte
+	Value []byte
+	// Type is an opaque entry type owned by the caller (value, tombstone, ...).
+	Type byte
+	// Family is the column family the write belongs to.
+	Family uint32
+	// ExpiresAt is a unix timestamp in nanoseconds, 0 means the record never expires.
+	ExpiresAt int64
 }
 
 // new creates a new WAL file or opens an existing one.
 
 func New(path string) (*WAL, error) {
-	// O_APPEND: Append only for high-speed sequential writes.
-	// O_CREATE: Create if not exists.
-	// O_RDWR: Read/Write access.
-	// 0644: File permissions (owner read/write, group read, others read).
+	return NewWithOptions(path, Options{})
+}
 
-	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+// NewWithOptions is like New but configured by opts.
+func NewWithOptions(path string, opts Options) (*WAL, error) {
+	// OpenForAppend: Append only for high-speed sequential writes, and
+	// create if not exists.
+	if opts.FS == nil {
+		opts.FS = vfs.Default
+	}
+	f, err := opts.FS.OpenForAppend(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open WAL file: %w", err)
 	}
-	return &WAL{file: f}, nil
+	return &WAL{file: f, opts: opts}, nil
 }
 
-// Write appends a log entry to the WAL file.
-// Format: [KeyLen (4 bytes)][ValueLen (4 bytes)][Key Content][Value Content]
+// Write appends a plain key-value log entry to the WAL file.
 func (w *WAL) Write(key, value []byte) error {
-	// create an 8-byte buffer for the two 4-byte uint32 lengths
-	header := make([]byte, 8)
-	binary.LittleEndian.PutUint32(header[0:4], uint32(len(key)))   // Key length
-	binary.LittleEndian.PutUint32(header[4:8], uint32(len(value))) // Value length
+	return w.WriteRecord(Record{Key: key, Value: value})
+}
+
+// WriteRecord appends a single log entry to the WAL file.
+func (w *WAL) WriteRecord(r Record) error {
+	return w.WriteBatch([]Record{r})
+}
 
-	// Write the header (lengths) followed by the key and value content
-	if _, err := w.file.Write(header); err != nil {
-		return fmt.Errorf("failed to write header to WAL: %w", err)
+// WriteBatch appends records as one atomic unit: after a crash, replay sees
+// either all of them or none.
+// Record format: [Type (1 byte)][Family (4 bytes)][KeyLen (4 bytes)][ValueLen (4 bytes)][ExpiresAt (8 bytes)][Key Content][Value Content]
+func (w *WAL) WriteBatch(records []Record) error {
+	// Build the whole frame first so it goes out in a single write
+	frame := make([]byte, frameHeaderSize, frameHeaderSize+4+len(records)*recordHeaderSize)
+	frame = binary.LittleEndian.AppendUint32(frame, uint32(len(records)))
+	for _, r := range records {
+		frame = append(frame, r.Type)
+		frame = binary.LittleEndian.AppendUint32(frame, r.Family)
+		frame = binary.LittleEndian.AppendUint32(frame, uint32(len(r.Key)))   // Key length
+		frame = binary.LittleEndian.AppendUint32(frame, uint32(len(r.Value))) // Value length
+		frame = binary.LittleEndian.AppendUint64(frame, uint64(r.ExpiresAt))  // Expiry
+		frame = append(frame, r.Key...)
+		frame = append(frame, r.Value...)
 	}
-	// Write the key content
-	if _, err := w.file.Write(key); err != nil {
-		return fmt.Errorf("failed to write key to WAL: %w", err)
+	payload := frame[frameHeaderSize:]
+	binary.LittleEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(payload))
+
+	if _, err := w.file.Write(frame); err != nil {
+		return fmt.Errorf("failed to write batch to WAL: %w", err)
 	}
-	// Write the value content
-	if _, err := w.file.Write(value); err != nil {
-		return fmt.Errorf("failed to write value to WAL: %w", err)
+	if w.opts.NoSync {
+		return nil
 	}
 	return w.file.Sync() // Ensure data is flushed to disk
 }
 
+// Sync forces every batch written so far to disk.
+func (w *WAL) Sync() error {
+	return w.file.Sync()
+}
+
 // Close closes the WAL file.
 func (w *WAL) Close() error {
 	return w.file.Close()
 }
+
+// Replay reads every record in the WAL at path, in the order they were written,
+// and hands each one to fn. A batch cut short or corrupted by a crash ends the
+// replay without an error, since it was never acknowledged.
+func Replay(path string, fn func(Record) error) error {
+	return ReplayFS(vfs.Default, path, fn)
+}
+
+// ReplayFS is like Replay for a WAL stored in fs.
+func ReplayFS(fs vfs.FS, path string, fn func(Record) error) error {
+	_, err := ReplayFrom(fs, path, 0, fn)
+	return err
+}
+
+// ReplayFrom is like ReplayFS but starts at offset, which must be the start
+// of a batch. It returns the offset just past the last complete batch, where
+// a later call can pick up the batches a live writer has appended since.
+func ReplayFrom(fs vfs.FS, path string, offset int64, fn func(Record) error) (int64, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return offset, fmt.Errorf("failed to open WAL file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return offset, fmt.Errorf("failed to stat WAL file: %w", err)
+	}
+	r := io.NewSectionReader(f, offset, math.MaxInt64-offset)
+
+	header := make([]byte, frameHeaderSize)
+	for {
+		// 1. Read the frame header
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+				return offset, nil
+			}
+			return offset, fmt.Errorf("failed to read WAL frame: %w", err)
+		}
+		// A torn header can claim any length. A batch longer than what is
+		// left of the file was cut short, so don't allocate room for it.
+		n := int64(binary.LittleEndian.Uint32(header[0:4]))
+		if n > info.Size()-offset-frameHeaderSize {
+			return offset, nil
+		}
+		payload := make([]byte, n)
+
+		// 2. Read and verify the payload
+		if _, err := io.ReadFull(r, payload); err != nil {
+			if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+				return offset, nil
+			}
+			return offset, fmt.Errorf("failed to read WAL batch: %w", err)
+		}
+		if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:8]) {
+			if end := offset + frameHeaderSize + n; end < info.Size() {
+				return offset, fmt.Errorf("%w: checksum mismatch at offset %d, %d bytes before the end of the log", ErrCorrupt, offset, info.Size()-end)
+			}
+			return offset, nil
+		}
+
+		// 3. Decode the records. The checksum passed, so a short payload
+		// means the writer was buggy, not that we crashed.
+		records, err := decodeBatch(payload)
+		if err != nil {
+			return offset, err
+		}
+		for _, rec := range records {
+			if err := fn(rec); err != nil {
+				return offset, err
+			}
+		}
+		offset += int64(frameHeaderSize + len(payload))
+	}
+}
+
+// decodeBatch parses a checksummed batch payload into its records.
+func decodeBatch(payload []byte) ([]Record, error) {
+	if len(payload) < 4 {
+		return nil, fmt.Errorf("corrupt WAL batch")
+	}
+	count := int(binary.LittleEndian.Uint32(payload[0:4]))
+	payload = payload[4:]
+	records := make([]Record, 0, min(count, len(payload)/recordHeaderSize))
+	for i := 0; i < count; i++ {
+		if len(payload) < recordHeaderSize {
+			return nil, fmt.Errorf("corrupt WAL record")
+		}
+		keyLen := int(binary.LittleEndian.Uint32(payload[5:9]))
+		valueLen := int(binary.LittleEndian.Uint32(payload[9:13]))
+		if len(payload) < recordHeaderSize+keyLen+valueLen {
+			return nil, fmt.Errorf("corrupt WAL record")
+		}
+		body := payload[recordHeaderSize:]
+		records = append(records, Record{
+			Type:      payload[0],
+			Family:    binary.LittleEndian.Uint32(payload[1:5]),
+			ExpiresAt: int64(binary.LittleEndian.Uint64(payload[13:21])),
+			Key:       body[:keyLen],
+			Value:     body[keyLen : keyLen+valueLen],
+		})
+		payload = body[keyLen+valueLen:]
+	}
+	return records, nil
+}
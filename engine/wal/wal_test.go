@@ -1,8 +1,11 @@
 package wal
 
 import (
+	"errors"
 	"os"
 	"testing"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
 )
 
 func TestWAL_Write(t *testing.T) {
@@ -28,11 +31,172 @@ func TestWAL_Write(t *testing.T) {
 		t.Fatalf("File info error: %v", err)
 	}
 
-	// Expected size: 8 (header) + 8 (key) + 10 (val) = 26 bytes
-	expected := int64(8 + len(key) + len(val))
+	// Expected size: 8 (frame) + 4 (count) + 21 (record header) + 8 (key) + 10 (val) = 51 bytes
+	expected := int64(frameHeaderSize + 4 + recordHeaderSize + len(key) + len(val))
 	if info.Size() != expected {
 		t.Errorf("Expected size %d, got %d", expected, info.Size())
 	}
 
 	w.Close()
 }
+
+func TestWAL_Replay(t *testing.T) {
+	tempPath := "test_replay.log"
+	defer os.Remove(tempPath)
+
+	w, err := New(tempPath)
+	if err != nil {
+		t.Fatalf("Failed to create WAL: %v", err)
+	}
+	w.Write([]byte("a"), []byte("1"))
+	w.WriteRecord(Record{Key: []byte("b"), Value: []byte("2"), Type: 1, Family: 7, ExpiresAt: 42})
+	w.Close()
+
+	var got []Record
+	err = Replay(tempPath, func(r Record) error {
+		got = append(got, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(got))
+	}
+	if string(got[1].Key) != "b" || string(got[1].Value) != "2" || got[1].Type != 1 || got[1].Family != 7 || got[1].ExpiresAt != 42 {
+		t.Errorf("Record metadata not preserved: %+v", got[1])
+	}
+}
+
+func TestWAL_TornBatchIsDropped(t *testing.T) {
+	tempPath := "test_torn.log"
+	defer os.Remove(tempPath)
+
+	w, err := New(tempPath)
+	if err != nil {
+		t.Fatalf("Failed to create WAL: %v", err)
+	}
+	w.WriteBatch([]Record{{Key: []byte("a"), Value: []byte("1")}})
+	w.WriteBatch([]Record{
+		{Key: []byte("b"), Value: []byte("2")},
+		{Key: []byte("c"), Value: []byte("3"), Family: 1},
+	})
+	w.Close()
+
+	// Simulate a crash halfway through the second batch
+	info, _ := os.Stat(tempPath)
+	os.Truncate(tempPath, info.Size()-5)
+
+	var keys []string
+	Replay(tempPath, func(r Record) error {
+		keys = append(keys, string(r.Key))
+		return nil
+	})
+	if len(keys) != 1 || keys[0] != "a" {
+		t.Errorf("Expected only the complete batch to replay, got %v", keys)
+	}
+}
+
+func TestWAL_CorruptBatchBeforeTheEndFails(t *testing.T) {
+	fs := vfs.NewMem()
+	w, err := NewWithOptions("corrupt.log", Options{FS: fs})
+	if err != nil {
+		t.Fatalf("Failed to create WAL: %v", err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		w.Write([]byte(key), []byte("1"))
+	}
+	w.Close()
+	data, _ := vfs.ReadFile(fs, "corrupt.log")
+	replay := func() ([]string, error) {
+		f, _ := fs.Create("corrupt.log")
+		f.Write(data)
+		f.Close()
+		var keys []string
+		_, err := ReplayFrom(fs, "corrupt.log", 0, func(r Record) error {
+			keys = append(keys, string(r.Key))
+			return nil
+		})
+		return keys, err
+	}
+	batch := len(data) / 3
+
+	// 1. A bad last batch is a torn write and is dropped quietly
+	data[len(data)-1] ^= 0xff
+	if keys, err := replay(); err != nil || len(keys) != 2 {
+		t.Errorf("Expected [a b] from a torn tail, got %v (%v)", keys, err)
+	}
+
+	// 2. A bad batch with acknowledged ones after it is corruption
+	data[len(data)-1] ^= 0xff
+	data[batch+frameHeaderSize+4] ^= 0xff
+	if keys, err := replay(); !errors.Is(err, ErrCorrupt) || len(keys) != 1 {
+		t.Errorf("Expected ErrCorrupt after [a], got %v (%v)", keys, err)
+	}
+}
+
+func TestWAL_GarbageLengthEndsReplay(t *testing.T) {
+	fs := vfs.NewMem()
+	w, err := NewWithOptions("garbage.log", Options{FS: fs})
+	if err != nil {
+		t.Fatalf("Failed to create WAL: %v", err)
+	}
+	w.Write([]byte("a"), []byte("1"))
+	w.Close()
+
+	// A torn header claiming a batch of almost 4 GiB
+	f, _ := fs.OpenForAppend("garbage.log")
+	f.Write([]byte{0xf0, 0xff, 0xff, 0xff, 0, 0, 0, 0, 1, 2, 3})
+	f.Close()
+
+	var keys []string
+	end, err := ReplayFrom(fs, "garbage.log", 0, func(r Record) error {
+		keys = append(keys, string(r.Key))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReplayFrom failed: %v", err)
+	}
+	if len(keys) != 1 || keys[0] != "a" {
+		t.Errorf("Expected only the complete batch to replay, got %v", keys)
+	}
+	if info, _ := fs.Stat("garbage.log"); end != info.Size()-11 {
+		t.Errorf("Expected replay to stop before the garbage at %d, got %d", info.Size()-11, end)
+	}
+}
+
+func TestWAL_ReplayFrom(t *testing.T) {
+	fs := vfs.NewMem()
+	w, err := NewWithOptions("tail.log", Options{FS: fs})
+	if err != nil {
+		t.Fatalf("Failed to create WAL: %v", err)
+	}
+	defer w.Close()
+
+	collect := func(offset int64) ([]string, int64) {
+		var keys []string
+		end, err := ReplayFrom(fs, "tail.log", offset, func(r Record) error {
+			keys = append(keys, string(r.Key))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("ReplayFrom failed: %v", err)
+		}
+		return keys, end
+	}
+
+	// Tailing picks up only what was appended since the last call
+	w.Write([]byte("a"), []byte("1"))
+	keys, end := collect(0)
+	if len(keys) != 1 || keys[0] != "a" {
+		t.Fatalf("Expected [a], got %v", keys)
+	}
+	w.WriteBatch([]Record{{Key: []byte("b")}, {Key: []byte("c")}})
+	keys, end2 := collect(end)
+	if len(keys) != 2 || keys[0] != "b" || keys[1] != "c" {
+		t.Fatalf("Expected [b c], got %v", keys)
+	}
+	if keys, end3 := collect(end2); len(keys) != 0 || end3 != end2 {
+		t.Errorf("Expected nothing new at the end, got %v (offset %d, want %d)", keys, end3, end2)
+	}
+}
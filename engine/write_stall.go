@@ -0,0 +1,312 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/sstable"
+)
+
+// Defaults for the write stall limits, applied to zero Options fields.
+const (
+	DefaultL0SlowdownWritesTrigger         = 20
+	DefaultL0StopWritesTrigger             = 36
+	DefaultMemTableSlowdownWritesTrigger   = 3
+	DefaultMemTableStopWritesTrigger       = 5
+	DefaultSoftPendingCompactionBytesLimit = 64 << 30
+	DefaultHardPendingCompactionBytesLimit = 256 << 30
+	DefaultDelayedWriteRate                = 16 << 20
+)
+
+// minWriteDelay is the shortest wait a delayed write sleeps for. Shorter
+// debts are carried over, so a stream of small writes still pays its way
+// without a sleep call for every one of them.
+const minWriteDelay = time.Millisecond
+
+// WriteStallCause says which limit holds writes back.
+type WriteStallCause int
+
+const (
+	// StallNone means no limit is exceeded.
+	StallNone WriteStallCause = iota
+	// StallSortedRuns is a column family with too many sorted runs of
+	// SSTables.
+	StallSortedRuns
+	// StallPendingCompactionBytes is a column family with too many bytes
+	// still to be compacted.
+	StallPendingCompactionBytes
+	// StallMemTables is a column family with too many frozen MemTables
+	// waiting to be flushed.
+	StallMemTables
+)
+
+func (c WriteStallCause) String() string {
+	switch c {
+	case StallNone:
+		return "none"
+	case StallSortedRuns:
+		return "sorted-runs"
+	case StallPendingCompactionBytes:
+		return "pending-compaction-bytes"
+	case StallMemTables:
+		return "memtables"
+	default:
+		return fmt.Sprintf("WriteStallCause(%d)", int(c))
+	}
+}
+
+// writeController holds writers back while flushes or compaction fall
+// behind. Writes are delayed to DelayedWriteRate above the soft limits, and
+// block above the hard ones until background work brings the engine back
+// under them.
+type writeController struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	condition WriteStallCondition
+	cause     WriteStallCause
+	// pending is the compaction debt, see pendingCompactionBytes
+	pending int64
+	// rate is Options.DelayedWriteRate, kept here for SetOptions to change
+	rate int64
+	// next is when the delayed writes admitted so far are paid for: the
+	// token bucket is empty until then and refills at DelayedWriteRate
+	next time.Time
+	// err is why the compaction that was to get stopped writes going again
+	// failed. The writers waiting for it fail with it, and the next one
+	// stopped retries the compaction.
+	err    error
+	closed bool
+}
+
+// sortedRuns counts the family's sorted runs: stretches of neighbouring
+// tables whose key ranges ascend without overlapping, such as the outputs of
+// one compaction. A read looks at one table per run at most, so it is the
+// runs rather than the tables that compaction has to bring down.
+func (cf *ColumnFamily) sortedRuns() int {
+	return sortedRuns(cf.opts.Comparator, cf.sstTables)
+}
+
+// sortedRuns counts the sorted runs among tables, newest first.
+func sortedRuns(cmp Comparator, tables []*sstable.Reader) int {
+	return len(runStarts(cmp, tables))
+}
+
+// oldestRuns is the tail of tables, newest first, holding their n oldest
+// sorted runs, or all of tables if there are no more runs than that.
+func oldestRuns(cmp Comparator, tables []*sstable.Reader, n int) []*sstable.Reader {
+	starts := runStarts(cmp, tables)
+	if len(starts) <= n {
+		return tables
+	}
+	return tables[starts[len(starts)-n]:]
+}
+
+// runStarts lists the positions in tables, newest first, where a sorted run
+// begins.
+func runStarts(cmp Comparator, tables []*sstable.Reader) []int {
+	var starts []int
+	var largest []byte
+	for i, sst := range tables {
+		index := sst.GetIndex()
+		if len(index) == 0 {
+			continue
+		}
+		if largest == nil || cmp.Compare(index[0].Key, largest) <= 0 {
+			starts = append(starts, i)
+		}
+		largest = index[len(index)-1].Key
+	}
+	return starts
+}
+
+// pendingCompactionBytes estimates how much compaction must read before
+// the family is down to a single sorted run. Runs all overlap, so that is all
+// of them as soon as there are two.
+func (cf *ColumnFamily) pendingCompactionBytes() int64 {
+	if cf.sortedRuns() < 2 {
+		return 0
+	}
+	var n int64
+	for _, sst := range cf.sstTables {
+		n += sst.Size()
+	}
+	return n
+}
+
+// stallLimits reports how far cf is over the write stall limits.
+func (l *LSM) stallLimits(cf *ColumnFamily) (WriteStallCondition, WriteStallCause) {
+	o := l.opts
+	runs, pending, frozen := cf.sortedRuns(), cf.pendingCompactionBytes(), len(cf.imm)
+	switch {
+	case o.L0StopWritesTrigger > 0 && runs >= o.L0StopWritesTrigger:
+		return WriteStallStopped, StallSortedRuns
+	case o.HardPendingCompactionBytesLimit > 0 && pending >= o.HardPendingCompactionBytesLimit:
+		return WriteStallStopped, StallPendingCompactionBytes
+	case o.MemTableStopWritesTrigger > 0 && frozen >= o.MemTableStopWritesTrigger:
+		return WriteStallStopped, StallMemTables
+	case o.L0SlowdownWritesTrigger > 0 && runs >= o.L0SlowdownWritesTrigger:
+		return WriteStallDelayed, StallSortedRuns
+	case o.SoftPendingCompactionBytesLimit > 0 && pending >= o.SoftPendingCompactionBytesLimit:
+		return WriteStallDelayed, StallPendingCompactionBytes
+	case o.MemTableSlowdownWritesTrigger > 0 && frozen >= o.MemTableSlowdownWritesTrigger:
+		return WriteStallDelayed, StallMemTables
+	}
+	return WriteStallNormal, StallNone
+}
+
+// updateWriteStall re-evaluates the limits after the tables or MemTables
+// changed, waking writers that may now go ahead and background work if it
+// has to catch up. The caller must hold l.mu.
+func (l *LSM) updateWriteStall() {
+	condition, cause := WriteStallNormal, StallNone
+	var pending int64
+	for _, cf := range l.familyList() {
+		pending += cf.pendingCompactionBytes()
+		if c, why := l.stallLimits(cf); c > condition {
+			condition, cause = c, why
+		}
+	}
+
+	w := &l.stall
+	w.mu.Lock()
+	previous := w.condition
+	w.condition, w.cause, w.pending = condition, cause, pending
+	w.err = nil
+	w.cond.Broadcast()
+	w.mu.Unlock()
+
+	if condition != previous {
+		info := WriteStallInfo{Condition: condition, Previous: previous, Cause: cause}
+		l.events.push(func(el EventListener) { el.OnWriteStall(info) })
+	}
+	if condition != WriteStallNormal {
+		l.scheduleCompaction()
+	}
+	// The further compaction falls behind, the more I/O it may use
+	if limit := l.opts.SoftPendingCompactionBytesLimit; limit > 0 && l.opts.RateLimiter != nil {
+		l.opts.RateLimiter.Tune(float64(pending) / float64(limit))
+	}
+}
+
+// throttle admits a write of n bytes, delaying or blocking it while the
+// engine is stalled. A write stopped by frozen MemTables flushes them itself,
+// one stopped by the tables fails if the compaction catching up does. The
+// caller must not hold l.mu, which compaction needs to catch up, nor
+// l.flushMu.
+func (l *LSM) throttle(n int) error {
+	w := &l.stall
+	w.mu.Lock()
+	if w.condition == WriteStallNormal {
+		w.mu.Unlock()
+		return nil
+	}
+	start := time.Now()
+	if w.condition == WriteStallStopped {
+		l.stats.stoppedWrites.Add(1)
+		if w.err != nil {
+			// Nothing else retries a failed compaction
+			w.err = nil
+			l.scheduleCompaction()
+		}
+		for w.condition == WriteStallStopped && !w.closed {
+			if w.cause != StallMemTables {
+				if err := w.err; err != nil {
+					w.mu.Unlock()
+					return fmt.Errorf("writes stopped by %v and compaction failed: %w", w.cause, err)
+				}
+				w.cond.Wait()
+				continue
+			}
+			// Only a flush gets the writes going again, and if it fails
+			// the write fails with it
+			w.mu.Unlock()
+			l.flushMu.Lock()
+			err := l.flushFrozen()
+			l.flushMu.Unlock()
+			w.mu.Lock()
+			if err != nil {
+				w.mu.Unlock()
+				return err
+			}
+		}
+	}
+	if w.closed {
+		w.mu.Unlock()
+		return ErrClosed
+	}
+	var wait time.Duration
+	if w.condition == WriteStallDelayed {
+		l.stats.delayedWrites.Add(1)
+		now := time.Now()
+		if w.next.Before(now) {
+			w.next = now
+		}
+		w.next = w.next.Add(time.Duration(float64(n) / float64(w.rate) * float64(time.Second)))
+		if d := w.next.Sub(now); d >= minWriteDelay {
+			wait = d
+		}
+	}
+	w.mu.Unlock()
+
+	time.Sleep(wait)
+	l.stats.stallNanos.Add(int64(time.Since(start)))
+	return nil
+}
+
+// closeWriteController releases writers blocked by a stall; they fail with ErrClosed.
+func (l *LSM) closeWriteController() {
+	w := &l.stall
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	w.cond.Broadcast()
+}
+
+// compactStalled compacts the column family furthest over the write stall
+// limits on its tables, according to its CompactionStrategy. It returns
+// false when every family is within the limits or compaction failed.
+func (l *LSM) compactStalled() bool {
+	defer l.events.deliver()
+	l.compactMu.Lock()
+	defer l.compactMu.Unlock()
+
+	l.mu.RLock()
+	var target *ColumnFamily
+	worst := WriteStallNormal
+	for _, cf := range l.familyList() {
+		// A single run is as compacted as it gets, whatever the limits say
+		if c, why := l.stallLimits(cf); c > worst && why != StallMemTables && cf.sortedRuns() > 1 {
+			target, worst = cf, c
+		}
+	}
+	l.mu.RUnlock()
+	// A CompactRange call busy with the family is catching it up already
+	if target == nil || !target.compactMu.TryLock() {
+		return false
+	}
+	defer target.compactMu.Unlock()
+
+	l.mu.RLock()
+	inputs := target.sstTables
+	l.mu.RUnlock()
+	if sortedRuns(target.opts.Comparator, inputs) < 2 {
+		return false // Caught up while we waited
+	}
+	if target.opts.CompactionStrategy != CompactAll {
+		inputs = oldestRuns(target.opts.Comparator, inputs, 2)
+	}
+	if err := l.compactRange(context.Background(), target, inputs, CompactionWriteStall); err != nil {
+		l.opts.Logger.Printf("compaction of stalled column family %q failed: %v", target.name, err)
+		info := BackgroundErrorInfo{Reason: ErrorDuringCompaction, Err: err}
+		l.events.push(func(el EventListener) { el.OnBackgroundError(info) })
+		w := &l.stall
+		w.mu.Lock()
+		w.err = err
+		w.cond.Broadcast()
+		w.mu.Unlock()
+		return false
+	}
+	return true
+}
@@ -0,0 +1,351 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jyotishmoy12/LSM-Tree-in-Golang/engine/vfs"
+)
+
+// waitForStall polls until the engine reports the condition, failing the test after a while.
+func waitForStall(t *testing.T, lsm *LSM, want WriteStallCondition) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for lsm.Stats().WriteStall != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected write stall %v, stuck at %v", want, lsm.Stats().WriteStall)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLSM_WriteStallStopsUntilCompactionCatchesUp(t *testing.T) {
+	rec := &recordingListener{}
+	lsm, err := New("write_stall_test", &Options{
+		FS:                      vfs.NewMem(),
+		MaxMemSize:              128,
+		L0SlowdownWritesTrigger: 2,
+		L0StopWritesTrigger:     3,
+		DelayedWriteRate:        1 << 30,
+		EventListeners:          []EventListener{rec},
+	})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+
+	// 1. With compaction held off, tables pile up until writes stop
+	lsm.compactMu.Lock()
+	for i := 0; lsm.Stats().WriteStall != WriteStallStopped; i++ {
+		if i == 1000 {
+			lsm.compactMu.Unlock()
+			t.Fatalf("Writes never stopped, stats: %v", lsm.Stats())
+		}
+		if err := lsm.Put([]byte(fmt.Sprintf("key%04d", i)), []byte("value")); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	if v, _ := lsm.GetProperty("lsm.is-write-stopped"); v != "1" {
+		t.Errorf("Expected lsm.is-write-stopped to be 1, got %s", v)
+	}
+	done := make(chan error)
+	go func() { done <- lsm.Put([]byte("blocked"), []byte("value")) }()
+	for lsm.Stats().StoppedWrites == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Expected the Put to block, it returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// 2. Compaction brings the family back under the limits and lets it through
+	lsm.compactMu.Unlock()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Blocked Put failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Put stayed blocked after compaction caught up")
+	}
+	waitForStall(t, lsm, WriteStallNormal)
+	if val, found, _ := lsm.Get([]byte("blocked")); !found || string(val) != "value" {
+		t.Errorf("Expected the blocked write to land, got %q", val)
+	}
+	s := lsm.Stats()
+	if s.StoppedWrites != 1 || s.StallTime < 50*time.Millisecond || s.WriteStallCause != StallNone {
+		t.Errorf("Unexpected stall stats: %+v", s)
+	}
+
+	// 3. Listeners saw every transition
+	var stalls []string
+	events, infos := rec.take()
+	for i, e := range events {
+		if info, ok := infos[i].(WriteStallInfo); ok {
+			stalls = append(stalls, fmt.Sprintf("%s/%v", e, info.Cause))
+		}
+	}
+	want := "stall-delayed/sorted-runs,stall-stopped/sorted-runs,stall-delayed/sorted-runs,stall-normal/none"
+	if strings.Join(stalls, ",") != want {
+		t.Errorf("Expected %s, got %v", want, stalls)
+	}
+}
+
+func TestLSM_WriteStallFailsStoppedWritesWithCompaction(t *testing.T) {
+	fs := vfs.NewFaultFS(vfs.NewMem(), 1)
+	lsm, err := New("write_stall_fail_test", &Options{
+		FS:                      fs,
+		MaxMemSize:              128,
+		L0SlowdownWritesTrigger: 2,
+		L0StopWritesTrigger:     3,
+		DelayedWriteRate:        1 << 30,
+		Logger:                  discardLogger{},
+	})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+
+	// 1. Writes stop while compaction is held off
+	lsm.compactMu.Lock()
+	for i := 0; lsm.Stats().WriteStall != WriteStallStopped; i++ {
+		if i == 1000 {
+			lsm.compactMu.Unlock()
+			t.Fatalf("Writes never stopped, stats: %v", lsm.Stats())
+		}
+		if err := lsm.Put([]byte(fmt.Sprintf("key%04d", i)), []byte("value")); err != nil {
+			lsm.compactMu.Unlock()
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	done := make(chan error)
+	go func() { done <- lsm.Put([]byte("blocked"), []byte("value")) }()
+	for lsm.Stats().StoppedWrites == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// 2. The compaction that would let them through fails, and so does the write
+	fs.FailAfter(vfs.OpCreate, 0)
+	lsm.compactMu.Unlock()
+	select {
+	case err := <-done:
+		if !errors.Is(err, vfs.ErrInjected) {
+			t.Fatalf("Expected the injected compaction failure, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Put stayed blocked after compaction failed")
+	}
+
+	// 3. The next stopped write retries the compaction, which now succeeds
+	fs.ClearFaults()
+	if err := lsm.Put([]byte("retried"), []byte("value")); err != nil {
+		t.Fatalf("Expected the write to go through once compaction works, got %v", err)
+	}
+	waitForStall(t, lsm, WriteStallNormal)
+	if _, found, _ := lsm.Get([]byte("retried")); !found {
+		t.Error("Expected the retried write to land")
+	}
+}
+
+func TestLSM_WriteStallDelaysWrites(t *testing.T) {
+	lsm, err := New("write_delay_test", &Options{
+		FS:                      vfs.NewMem(),
+		MaxMemSize:              128,
+		L0SlowdownWritesTrigger: 1,
+		L0StopWritesTrigger:     -1,
+		DelayedWriteRate:        10000,
+	})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+	for i := 0; lsm.Stats().WriteStall != WriteStallDelayed; i++ {
+		if i == 1000 {
+			t.Fatalf("Writes never slowed down, stats: %v", lsm.Stats())
+		}
+		lsm.Put([]byte(fmt.Sprintf("key%04d", i)), []byte("v"))
+	}
+
+	// A single table is as compacted as it gets, so the delay stays: 1000
+	// bytes at 10000 bytes per second take about 100ms
+	value := make([]byte, 96)
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		if err := lsm.Put([]byte(fmt.Sprintf("big%d", i)), value); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("Expected delayed writes to take about 100ms, took %v", elapsed)
+	}
+	if s := lsm.Stats(); s.DelayedWrites < 10 || s.WriteStallCause != StallSortedRuns {
+		t.Errorf("Unexpected stall stats: %+v", s)
+	}
+}
+
+func TestLSM_WriteStallOnPendingCompactionBytes(t *testing.T) {
+	lsm, err := New("write_pending_test", &Options{
+		FS:                              vfs.NewMem(),
+		MaxMemSize:                      128,
+		L0SlowdownWritesTrigger:         -1,
+		L0StopWritesTrigger:             -1,
+		SoftPendingCompactionBytesLimit: 1,
+		HardPendingCompactionBytesLimit: -1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+
+	lsm.compactMu.Lock()
+	for i := 0; lsm.Stats().WriteStallCause != StallPendingCompactionBytes; i++ {
+		if i == 1000 {
+			lsm.compactMu.Unlock()
+			t.Fatalf("Pending compaction bytes never slowed writes down, stats: %v", lsm.Stats())
+		}
+		lsm.Put([]byte(fmt.Sprintf("key%04d", i)), []byte("v"))
+	}
+	if s := lsm.Stats(); s.PendingCompactionBytes != s.DiskBytes {
+		t.Errorf("Expected every byte on disk to be pending, got %d of %d", s.PendingCompactionBytes, s.DiskBytes)
+	}
+	lsm.compactMu.Unlock()
+
+	// The background worker compacts until there is no debt left
+	waitForStall(t, lsm, WriteStallNormal)
+	if s := lsm.Stats(); s.TableCount() != 1 || s.PendingCompactionBytes != 0 {
+		t.Errorf("Expected one table and no debt, got %d tables and %d bytes", s.TableCount(), s.PendingCompactionBytes)
+	}
+}
+
+func TestLSM_WriteStallOnFrozenMemTables(t *testing.T) {
+	lsm, err := New("write_memtables_test", &Options{
+		FS:                            vfs.NewMem(),
+		MaxMemSize:                    128,
+		MemTableSlowdownWritesTrigger: 1,
+		MemTableStopWritesTrigger:     2,
+		DelayedWriteRate:              1 << 30,
+	})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+	done := make(chan error, 3)
+	put := func(key string, size int) {
+		go func() { done <- lsm.Put([]byte(key), make([]byte, size)) }()
+	}
+	waitFor := func(what string, cond func(s Stats) bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond(lsm.Stats()) {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %s, stats: %v", what, lsm.Stats())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// 1. With flushes held off, every full MemTable waits frozen: one
+	// delays writes, two stop them
+	lsm.flushMu.Lock()
+	put("a", 128)
+	waitFor("one frozen MemTable", func(s Stats) bool { return s.ImmutableMemTables == 1 })
+	if s := lsm.Stats(); s.WriteStall != WriteStallDelayed || s.WriteStallCause != StallMemTables {
+		t.Errorf("Expected writes delayed by the MemTables, got %v (%v)", s.WriteStall, s.WriteStallCause)
+	}
+	put("b", 128)
+	waitFor("two frozen MemTables", func(s Stats) bool { return s.ImmutableMemTables == 2 })
+	if v, _ := lsm.GetProperty("lsm.num-immutable-mem-table"); v != "2" {
+		t.Errorf("Expected lsm.num-immutable-mem-table to be 2, got %s", v)
+	}
+	put("c", 1)
+	waitFor("a stopped write", func(s Stats) bool { return s.StoppedWrites == 1 })
+	if s := lsm.Stats(); s.WriteStall != WriteStallStopped || s.WriteStallCause != StallMemTables {
+		t.Errorf("Expected writes stopped by the MemTables, got %v (%v)", s.WriteStall, s.WriteStallCause)
+	}
+
+	// 2. Flushing them lets every write through
+	lsm.flushMu.Unlock()
+	for i := 0; i < 3; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	waitForStall(t, lsm, WriteStallNormal)
+	if s := lsm.Stats(); s.ImmutableMemTables != 0 || s.Flushes != 2 {
+		t.Errorf("Expected both MemTables flushed, got %d waiting after %d flushes", s.ImmutableMemTables, s.Flushes)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if _, found, _ := lsm.Get([]byte(key)); !found {
+			t.Errorf("Expected %s after the flushes", key)
+		}
+	}
+}
+
+func TestLSM_WriteStallCompactsSortedRunsOfSplitTables(t *testing.T) {
+	lsm, err := New("write_stall_runs_test", &Options{
+		FS:                      vfs.NewMem(),
+		MaxMemSize:              1 << 20,
+		BlockSize:               64,
+		MaxSubcompactions:       4,
+		L0SlowdownWritesTrigger: 2,
+		L0StopWritesTrigger:     3,
+		DelayedWriteRate:        1 << 30,
+	})
+	if err != nil {
+		t.Fatalf("Failed to init LSM: %v", err)
+	}
+	defer lsm.Close()
+	writeRun := func(round int) {
+		for i := 0; i < 300; i++ {
+			lsm.Put([]byte(fmt.Sprintf("key%03d", i)), []byte(fmt.Sprintf("value%d-%d", round, i)))
+		}
+		lsm.flush()
+	}
+	runs := func() (int, int) {
+		lsm.mu.RLock()
+		defer lsm.mu.RUnlock()
+		return len(lsm.defaultCF.sstTables), lsm.defaultCF.sortedRuns()
+	}
+
+	// 1. Two runs are compacted into one, split over several tables
+	writeRun(0)
+	writeRun(1)
+	waitForStall(t, lsm, WriteStallNormal)
+	if tables, n := runs(); tables < 2 || n != 1 {
+		t.Fatalf("Expected a single run over several tables, got %d tables in %d runs", tables, n)
+	}
+
+	// 2. Two more runs on top of it stop writes
+	lsm.compactMu.Lock()
+	writeRun(2)
+	writeRun(3)
+	if s := lsm.Stats(); s.WriteStall != WriteStallStopped || s.WriteStallCause != StallSortedRuns {
+		lsm.compactMu.Unlock()
+		t.Fatalf("Expected writes stopped by the sorted runs, got %v (%v)", s.WriteStall, s.WriteStallCause)
+	}
+	done := make(chan error)
+	go func() { done <- lsm.Put([]byte("blocked"), []byte("value")) }()
+
+	// 3. Compacting the oldest runs, not the tables of one run, lets it through
+	lsm.compactMu.Unlock()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Blocked Put failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		tables, n := runs()
+		t.Fatalf("Put stayed blocked with %d tables in %d runs", tables, n)
+	}
+	waitForStall(t, lsm, WriteStallNormal)
+	if _, n := runs(); n != 1 {
+		t.Errorf("Expected a single run after the stall, got %d", n)
+	}
+	if val, _, _ := lsm.Get([]byte("key150")); string(val) != "value3-150" {
+		t.Errorf("Expected value3-150, got %q", val)
+	}
+}